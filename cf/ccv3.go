@@ -0,0 +1,1428 @@
+package cf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// asyncPollInterval is how often asynchronous jobs are polled.
+const asyncPollInterval = 2 * time.Second
+
+// CCV3 is a testing wrapper around the Cloud Controller v3 API. It offers the
+// same operations as CF without shelling out to the cf cli. The org and space
+// it targets are held in memory rather than in CF_HOME.
+type CCV3 struct {
+	ShortTimeout time.Duration
+	LongTimeout  time.Duration
+	MaxRetries   int
+	RetryBackoff retry.Backoff
+	// AppsDomain is the domain pushed apps are routed on. The first domain
+	// the Cloud Controller lists is used if it is empty.
+	AppsDomain string
+	// AsyncPollInterval is how often the last operation of a service instance
+	// is checked while waiting up to LongTimeout for it to finish.
+	AsyncPollInterval time.Duration
+	// Resolver resolves instance hosts to security group destinations.
+	Resolver Resolver
+
+	client    *ccv3.Client
+	orgGUID   string
+	spaceGUID string
+}
+
+// API targets the Cloud Controller at endpoint, like `cf api`
+func (v *CCV3) API(endpoint string, skipSSLValidation bool) func() {
+	return func() {
+		v.run("Failed to target Cloud Foundry", func(ctx context.Context) error {
+			client, err := ccv3.NewClient(ctx, endpoint, skipSSLValidation)
+			if err != nil {
+				return err
+			}
+			v.client = client
+			return nil
+		})
+	}
+}
+
+// Auth logs in as a user, like `cf auth {user} {password}`
+func (v *CCV3) Auth(user, password string) func() {
+	return func() {
+		v.retry("Failed to `cf auth` with target Cloud Foundry", func(ctx context.Context) error {
+			if v.client == nil {
+				return ccv3.ErrNotAuthenticated
+			}
+			return v.client.AuthenticatePassword(ctx, user, password)
+		})
+	}
+}
+
+// AuthClient logs in as a client, like `cf auth {client} {client-secret} --client-credentials`
+func (v *CCV3) AuthClient(client, clientSecret string) func() {
+	return func() {
+		v.retry("Failed to `cf auth` with target Cloud Foundry", func(ctx context.Context) error {
+			if v.client == nil {
+				return ccv3.ErrNotAuthenticated
+			}
+			return v.client.AuthenticateClient(ctx, client, clientSecret)
+		})
+	}
+}
+
+// CreateQuota creates an organization quota, like `cf create-quota {name} [args...]`.
+// The -m, -i, -r and -s flags and --allow-paid-service-plans are supported.
+func (v *CCV3) CreateQuota(name string, args ...string) func() {
+	return func() {
+		quota, err := quotaFromArgs(name, args)
+		Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Unsupported cf create-quota arguments"}`)
+
+		v.retry("Failed to `cf create-quota` with target Cloud Foundry", func(ctx context.Context) error {
+			_, err := v.client.Post(ctx, "/v3/organization_quotas", quota, nil)
+			if isNameTaken(err) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// DeleteOrg deletes an org, like `cf delete-org {name} -f`
+func (v *CCV3) DeleteOrg(name string) func() {
+	return func() {
+		v.retry("Failed to delete org", func(ctx context.Context) error {
+			org, err := ccv3.FindByName[ccv3.Organization](ctx, v.client, "/v3/organizations", name)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return v.deleteAndWait(ctx, "/v3/organizations/"+org.GUID)
+		})
+	}
+}
+
+// CreateOrg creates an org with a quota, like `cf create-org {org} -q {quota}`
+func (v *CCV3) CreateOrg(org, quota string) func() {
+	return func() {
+		v.retry("Failed to create org", func(ctx context.Context) error {
+			var created ccv3.Organization
+			_, err := v.client.Post(ctx, "/v3/organizations", map[string]interface{}{"name": org}, &created)
+			if isNameTaken(err) {
+				created, err = ccv3.FindByName[ccv3.Organization](ctx, v.client, "/v3/organizations", org)
+			}
+			if err != nil {
+				return err
+			}
+
+			q, err := ccv3.FindByName[ccv3.OrganizationQuota](ctx, v.client, "/v3/organization_quotas", quota)
+			if err != nil {
+				return fmt.Errorf("quota %s: %w", quota, err)
+			}
+
+			_, err = v.client.Post(ctx, "/v3/organization_quotas/"+q.GUID+"/relationships/organizations", ccv3.ToManyRelationship{
+				Data: []ccv3.RelatedGUID{{GUID: created.GUID}},
+			}, nil)
+			return err
+		})
+	}
+}
+
+// EnableServiceAccess makes every plan of a service offering visible to an
+// org, like `cf enable-service-access -o {org} {service-offering}`
+func (v *CCV3) EnableServiceAccess(org, service string) func() {
+	return func() {
+		v.retry("Failed to enable service access for CF test org", func(ctx context.Context) error {
+			plans, err := v.servicePlans(ctx, service)
+			if err != nil {
+				return err
+			}
+			return v.enablePlans(ctx, org, plans)
+		})
+	}
+}
+
+// EnableServiceAccessForPlan makes one plan visible to an org, like
+// `cf enable-service-access -o {org} {service-offering} -p {service-plan}`
+func (v *CCV3) EnableServiceAccessForPlan(org, service, plan string) func() {
+	return func() {
+		v.retry("Failed to enable service access for CF test org", func(ctx context.Context) error {
+			plans, err := v.servicePlans(ctx, service)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range plans {
+				if p.Name == plan {
+					return v.enablePlans(ctx, org, []ccv3.ServicePlan{p})
+				}
+			}
+			return retry.Permanent(fmt.Errorf("plan %s of service offering %s: %w", plan, service, ccv3.ErrNotFound))
+		})
+	}
+}
+
+// TargetOrg targets an org, like `cf target -o {org}`
+func (v *CCV3) TargetOrg(org string) func() {
+	return func() {
+		v.retry("Failed to target test org", func(ctx context.Context) error {
+			o, err := ccv3.FindByName[ccv3.Organization](ctx, v.client, "/v3/organizations", org)
+			if err != nil {
+				return fmt.Errorf("org %s: %w", org, err)
+			}
+			v.orgGUID, v.spaceGUID = o.GUID, ""
+			return nil
+		})
+	}
+}
+
+// TargetOrgAndSpace targets an org and space, like `cf target -o {org} -s {space}`
+func (v *CCV3) TargetOrgAndSpace(org, space string) func() {
+	return func() {
+		v.retry("Failed to target test org", func(ctx context.Context) error {
+			orgGUID, spaceGUID, err := v.findSpace(ctx, org, space)
+			if err != nil {
+				return err
+			}
+			v.orgGUID, v.spaceGUID = orgGUID, spaceGUID
+			return nil
+		})
+	}
+}
+
+// CreateSpace creates a space in the targeted org, like `cf create-space {space}`
+func (v *CCV3) CreateSpace(space string) func() {
+	return func() {
+		v.retry("Failed to create CF test space", func(ctx context.Context) error {
+			if v.orgGUID == "" {
+				return retry.Permanent(errors.New("no org targeted"))
+			}
+
+			_, err := v.client.Post(ctx, "/v3/spaces", map[string]interface{}{
+				"name": space,
+				"relationships": map[string]interface{}{
+					"organization": ccv3.RelatedTo(v.orgGUID),
+				},
+			}, nil)
+			if isNameTaken(err) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// CreateAndBindSecurityGroup creates a running security group that allows
+// egress to the service instance and binds it to the space, like
+// `cf create-security-group` followed by `cf bind-security-group`
+func (v *CCV3) CreateAndBindSecurityGroup(securityGroup, serviceName, serviceKeyName, org, space string) func() {
+	return func() {
+		var credentials Credentials
+		v.GetServiceKey(serviceName, serviceKeyName, &credentials)()
+
+		var rules []ccv3.SecurityGroupRule
+		for _, rule := range resolveSecurityGroupRules(credentials, v.Resolver, v.ShortTimeout, v.MaxRetries, v.RetryBackoff) {
+			rules = append(rules, ccv3.SecurityGroupRule{Protocol: rule.Protocol, Destination: rule.Destination, Ports: rule.Ports})
+		}
+
+		var group ccv3.SecurityGroup
+		v.retry("Failed to create security group", func(ctx context.Context) error {
+			_, err := v.client.Post(ctx, "/v3/security_groups", map[string]interface{}{
+				"name":  securityGroup,
+				"rules": rules,
+			}, &group)
+			if isNameTaken(err) {
+				group, err = ccv3.FindByName[ccv3.SecurityGroup](ctx, v.client, "/v3/security_groups", securityGroup)
+			}
+			return err
+		})
+
+		v.retry("Failed to bind security group to space", func(ctx context.Context) error {
+			_, spaceGUID, err := v.findSpace(ctx, org, space)
+			if err != nil {
+				return err
+			}
+
+			_, err = v.client.Post(ctx, "/v3/security_groups/"+group.GUID+"/relationships/running_spaces", ccv3.ToManyRelationship{
+				Data: []ccv3.RelatedGUID{{GUID: spaceGUID}},
+			}, nil)
+			return err
+		})
+	}
+}
+
+// DeleteSecurityGroup deletes a security group, like `cf delete-security-group {securityGroup} -f`
+func (v *CCV3) DeleteSecurityGroup(securityGroup string) func() {
+	return func() {
+		v.retry("Failed to delete security group", func(ctx context.Context) error {
+			group, err := ccv3.FindByName[ccv3.SecurityGroup](ctx, v.client, "/v3/security_groups", securityGroup)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return v.deleteAndWait(ctx, "/v3/security_groups/"+group.GUID)
+		})
+	}
+}
+
+// CreateUser creates a UAA user known to the Cloud Controller, like `cf create-user {name} {password}`
+func (v *CCV3) CreateUser(name, password string) func() {
+	return func() {
+		v.retry("Failed to create user", func(ctx context.Context) error {
+			err := v.client.UAA(ctx, http.MethodPost, "/Users", map[string]interface{}{
+				"userName": name,
+				"password": password,
+				"origin":   "uaa",
+				"emails":   []map[string]string{{"value": name}},
+			}, nil)
+			if err != nil && !ccv3.IsStatus(err, http.StatusConflict) {
+				return err
+			}
+
+			userID, err := v.uaaUserID(ctx, name)
+			if err != nil {
+				return err
+			}
+
+			_, err = v.client.Post(ctx, "/v3/users", map[string]string{"guid": userID}, nil)
+			if ccv3.IsStatus(err, http.StatusUnprocessableEntity) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// DeleteUser deletes a user from the Cloud Controller and the UAA, like `cf delete-user -f {name}`
+func (v *CCV3) DeleteUser(name string) func() {
+	return func() {
+		v.retry("Failed to delete user", func(ctx context.Context) error {
+			userID, err := v.uaaUserID(ctx, name)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := v.deleteAndWait(ctx, "/v3/users/"+userID); err != nil && !ccv3.IsStatus(err, http.StatusNotFound) {
+				return err
+			}
+
+			err = v.client.UAA(ctx, http.MethodDelete, "/Users/"+userID, nil, nil)
+			if ccv3.IsStatus(err, http.StatusNotFound) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// SetSpaceRole gives a user a space role, like `cf set-space-role {name} {org} {space} {role}`
+func (v *CCV3) SetSpaceRole(name, org, space, role string) func() {
+	return func() {
+		v.retry("Failed to set space role", func(ctx context.Context) error {
+			roleType, ok := spaceRoleTypes[role]
+			if !ok {
+				return retry.Permanent(fmt.Errorf("unknown space role %s", role))
+			}
+
+			_, spaceGUID, err := v.findSpace(ctx, org, space)
+			if err != nil {
+				return err
+			}
+
+			_, err = v.client.Post(ctx, "/v3/roles", map[string]interface{}{
+				"type": roleType,
+				"relationships": map[string]interface{}{
+					"user":  map[string]interface{}{"data": map[string]string{"username": name}},
+					"space": ccv3.RelatedTo(spaceGUID),
+				},
+			}, nil)
+			if ccv3.IsStatus(err, http.StatusUnprocessableEntity) {
+				// the user already has the role
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// Push creates or updates an app from a directory, stages it, routes it and
+// starts it, like `cf push {appName} [args...]`. The -m, -k, -i, -p and -b
+// flags and --no-start are supported.
+func (v *CCV3) Push(appName string, args ...string) func() {
+	return func() {
+		options, err := pushOptionsFromArgs(args)
+		Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Unsupported cf push arguments"}`)
+
+		v.retry("Failed to `cf push` test app", func(ctx context.Context) error {
+			return v.push(ctx, appName, options)
+		})
+	}
+}
+
+// Delete deletes an app and its routes, like `cf delete {appName} -f -r`
+func (v *CCV3) Delete(appName string) func() {
+	return func() {
+		v.retry("Failed to `cf delete` test app", func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			routes, err := ccv3.List[ccv3.Route](ctx, v.client, "/v3/apps/"+app.GUID+"/routes")
+			if err != nil {
+				return err
+			}
+			for _, route := range routes {
+				if err := v.deleteAndWait(ctx, "/v3/routes/"+route.GUID); err != nil && !ccv3.IsStatus(err, http.StatusNotFound) {
+					return err
+				}
+			}
+
+			return v.deleteAndWait(ctx, "/v3/apps/"+app.GUID)
+		})
+	}
+}
+
+// CreateService creates a managed service instance and waits for it to be
+// provisioned, like `cf create-service {serviceName} {planName} {instanceName} -c {params}`.
+// skip is set when the broker has no capacity left for the plan.
+func (v *CCV3) CreateService(serviceName, planName, instanceName string, params Parameters, skip *bool) func() {
+	return func() {
+		v.retry("Failed to create Redis service instance", func(ctx context.Context) error {
+			plans, err := v.servicePlans(ctx, serviceName)
+			if err != nil {
+				return err
+			}
+
+			var planGUID string
+			for _, p := range plans {
+				if p.Name == planName {
+					planGUID = p.GUID
+				}
+			}
+			if planGUID == "" {
+				return retry.Permanent(fmt.Errorf("plan %s of service offering %s: %w", planName, serviceName, ccv3.ErrNotFound))
+			}
+
+			location, err := v.client.Post(ctx, "/v3/service_instances", withParameters(map[string]interface{}{
+				"type": "managed",
+				"name": instanceName,
+				"relationships": map[string]interface{}{
+					"space":        ccv3.RelatedTo(v.spaceGUID),
+					"service_plan": ccv3.RelatedTo(planGUID),
+				},
+			}, params), nil)
+			if err == nil && location != "" {
+				err = v.client.PollJob(ctx, location, asyncPollInterval)
+			}
+
+			switch {
+			case isQuotaReached(err):
+				fmt.Printf("No Plan Instances available for testing %s plan\n", planName)
+				*skip = true
+				return nil
+			case isNameTaken(err):
+				return nil
+			case ccv3.IsStatus(err, http.StatusOK):
+				// the job failed; awaitOperation reports the last operation
+				return nil
+			default:
+				return err
+			}
+		})
+
+		if !(*skip) {
+			v.asyncWait().awaitOperation(instanceName, fmt.Sprintf("Failed to create Redis service instance %s", instanceName), v.lastOperation(instanceName))
+		}
+	}
+}
+
+// UpdateService moves an instance to planName and passes it params, and then,
+// if upgrade is set, upgrades it to its plan's latest maintenance_info, like
+// `cf update-service`. Any of them may be left out. It waits for each update
+// to finish.
+func (v *CCV3) UpdateService(instanceName, planName string, params Parameters, upgrade bool) func() {
+	return func() {
+		failReason := fmt.Sprintf("Failed to update service %s", instanceName)
+
+		if planName != "" || len(params) > 0 {
+			v.retry(failReason, func(ctx context.Context) error {
+				instance, plan, err := v.instanceAndPlan(ctx, instanceName)
+				if err != nil {
+					return err
+				}
+
+				update := withParameters(map[string]interface{}{}, params)
+				if planName != "" {
+					target, err := ccv3.FindByName[ccv3.ServicePlan](ctx, v.client, "/v3/service_plans", planName,
+						"service_offering_guids", plan.Relationships.ServiceOffering.Data.GUID)
+					if err != nil {
+						return fmt.Errorf("plan %s: %w", planName, err)
+					}
+					update["relationships"] = map[string]interface{}{"service_plan": ccv3.RelatedTo(target.GUID)}
+				}
+
+				return v.updateServiceInstance(ctx, instance.GUID, update)
+			})
+			v.asyncWait().awaitOperation(instanceName, failReason, v.lastOperation(instanceName))
+		}
+
+		if upgrade {
+			upgraded := false
+			v.retry(failReason, func(ctx context.Context) error {
+				instance, plan, err := v.instanceAndPlan(ctx, instanceName)
+				if err != nil {
+					return err
+				}
+				if !instance.UpgradeAvailable {
+					fmt.Printf("No upgrade is available for service instance %s\n", instanceName)
+					return nil
+				}
+
+				upgraded = true
+				return v.updateServiceInstance(ctx, instance.GUID, map[string]interface{}{
+					"maintenance_info": map[string]string{"version": plan.MaintenanceInfo.Version},
+				})
+			})
+			if upgraded {
+				v.asyncWait().awaitOperation(instanceName, failReason, v.lastOperation(instanceName))
+			}
+		}
+	}
+}
+
+func (v *CCV3) instanceAndPlan(ctx context.Context, instanceName string) (ccv3.ServiceInstance, ccv3.ServicePlan, error) {
+	var plan ccv3.ServicePlan
+
+	instance, err := v.findServiceInstance(ctx, instanceName)
+	if err != nil {
+		return instance, plan, err
+	}
+	if instance.Relationships.ServicePlan.Data == nil {
+		return instance, plan, retry.Permanent(fmt.Errorf("service instance %s has no plan", instanceName))
+	}
+
+	err = v.client.Get(ctx, "/v3/service_plans/"+instance.Relationships.ServicePlan.Data.GUID, &plan)
+	return instance, plan, err
+}
+
+// withParameters adds params to a request body, if there are any.
+func withParameters(body map[string]interface{}, params Parameters) map[string]interface{} {
+	if len(params) > 0 {
+		body["parameters"] = params
+	}
+	return body
+}
+
+// updateServiceInstance patches an instance. A failed update job is left for
+// the last operation to report.
+func (v *CCV3) updateServiceInstance(ctx context.Context, guid string, update map[string]interface{}) error {
+	location, err := v.client.Patch(ctx, "/v3/service_instances/"+guid, update, nil)
+	if err == nil && location != "" {
+		err = v.client.PollJob(ctx, location, asyncPollInterval)
+	}
+	if ccv3.IsStatus(err, http.StatusOK) {
+		return nil
+	}
+	return err
+}
+
+// GetServiceParameters reads the parameters the broker holds for an instance.
+// supported is set to false, and params left alone, if the broker does not
+// allow fetching them.
+func (v *CCV3) GetServiceParameters(instanceName string, params *Parameters, supported *bool) func() {
+	return func() {
+		v.retry("Failed to retrieve service instance parameters", func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if err != nil {
+				return err
+			}
+
+			var fetched Parameters
+			err = v.client.Get(ctx, "/v3/service_instances/"+instance.GUID+"/parameters", &fetched)
+			var apiErr *ccv3.Error
+			if errors.As(err, &apiErr) && apiErr.HasTitle("CF-ServiceFetchInstanceParametersNotSupported") {
+				*supported = false
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			*supported = true
+			*params = fetched
+			return nil
+		})
+	}
+}
+
+// DeleteService deletes a service instance, like `cf delete-service {instanceName} -f`
+func (v *CCV3) DeleteService(instanceName string) func() {
+	return func() {
+		v.retry(fmt.Sprintf("Failed to delete service %s", instanceName), func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			location, err := v.client.Delete(ctx, "/v3/service_instances/"+instance.GUID)
+			if err != nil {
+				return err
+			}
+			if location != "" {
+				// the deletion may carry on after the job; EnsureServiceInstanceGone waits for it
+				if err := v.client.PollJob(ctx, location, asyncPollInterval); err != nil && ccv3.IsRetryable(err) {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// EnsureServiceInstanceGone waits for a service instance to be deleted
+func (v *CCV3) EnsureServiceInstanceGone(instanceName string) func() {
+	return func() {
+		v.asyncWait().awaitGone(instanceName, fmt.Sprintf("Failed to make sure service %s does not exist", instanceName), v.lastOperation(instanceName))
+	}
+}
+
+// EnsureAllServiceInstancesGone waits for the targeted space to have no service instances
+func (v *CCV3) EnsureAllServiceInstancesGone() func() {
+	return func() {
+		v.asyncWait().await("all service instances", "Failed to make sure no service instances exist", func(ctx context.Context) error {
+			instances, err := ccv3.List[ccv3.ServiceInstance](ctx, v.client, "/v3/service_instances?space_guids="+v.spaceGUID)
+			if err != nil {
+				return err
+			}
+			if len(instances) > 0 {
+				return fmt.Errorf("%d service instances remain", len(instances))
+			}
+			return nil
+		})
+	}
+}
+
+// BindService binds a service instance to an app, like `cf bind-service {appName} {instanceName} -c {params}`
+func (v *CCV3) BindService(appName, instanceName string, params Parameters) func() {
+	return func() {
+		v.retry("Failed to bind Redis service instance to test app", func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if err != nil {
+				return err
+			}
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if err != nil {
+				return err
+			}
+
+			location, err := v.client.Post(ctx, "/v3/service_credential_bindings", withParameters(map[string]interface{}{
+				"type": "app",
+				"relationships": map[string]interface{}{
+					"service_instance": ccv3.RelatedTo(instance.GUID),
+					"app":              ccv3.RelatedTo(app.GUID),
+				},
+			}, params), nil)
+			if ccv3.IsStatus(err, http.StatusUnprocessableEntity) && strings.Contains(err.Error(), "already bound") {
+				return nil
+			}
+			if err == nil && location != "" {
+				err = v.client.PollJob(ctx, location, asyncPollInterval)
+			}
+			return err
+		})
+	}
+}
+
+// UnbindService unbinds a service instance from an app, like `cf unbind-service {appName} {instanceName}`
+func (v *CCV3) UnbindService(appName, instanceName string) func() {
+	return func() {
+		v.retry(fmt.Sprintf("Failed to unbind %s instance from %s", instanceName, appName), func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			bindings, err := ccv3.List[ccv3.ServiceCredentialBinding](ctx, v.client, fmt.Sprintf(
+				"/v3/service_credential_bindings?type=app&app_guids=%s&service_instance_guids=%s", app.GUID, instance.GUID,
+			))
+			if err != nil {
+				return err
+			}
+			for _, binding := range bindings {
+				if err := v.deleteAndWait(ctx, "/v3/service_credential_bindings/"+binding.GUID); err != nil && !ccv3.IsStatus(err, http.StatusNotFound) {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// EnsureServiceUnbound waits for appName to have no binding to instanceName,
+// in whichever space the app is.
+func (v *CCV3) EnsureServiceUnbound(appName, instanceName string) func() {
+	return func() {
+		query := url.Values{"type": {"app"}, "app_names": {appName}, "service_instance_names": {instanceName}}
+		v.asyncWait().await(appName, fmt.Sprintf("Failed to make sure %s is not bound to %s", appName, instanceName), func(ctx context.Context) error {
+			bindings, err := ccv3.List[ccv3.ServiceCredentialBinding](ctx, v.client, "/v3/service_credential_bindings?"+query.Encode())
+			if err != nil {
+				return err
+			}
+			if len(bindings) > 0 {
+				return fmt.Errorf("%d bindings remain", len(bindings))
+			}
+			return nil
+		})
+	}
+}
+
+// ShareService shares a service instance with another space, like
+// `cf share-service {instanceName} -o {org} -s {space}`
+func (v *CCV3) ShareService(instanceName, org, space string) func() {
+	return func() {
+		v.retry(fmt.Sprintf("Failed to share %s instance with space %s", instanceName, space), func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if err != nil {
+				return err
+			}
+			_, spaceGUID, err := v.findSpace(ctx, org, space)
+			if err != nil {
+				return err
+			}
+
+			// sharing with a space it is already shared with succeeds
+			_, err = v.client.Post(ctx, "/v3/service_instances/"+instance.GUID+"/relationships/shared_spaces", ccv3.ToManyRelationship{
+				Data: []ccv3.RelatedGUID{{GUID: spaceGUID}},
+			}, nil)
+			return err
+		})
+	}
+}
+
+// UnshareService unshares a service instance from a space, deleting its
+// bindings there, like `cf unshare-service {instanceName} -o {org} -s {space} -f`
+func (v *CCV3) UnshareService(instanceName, org, space string) func() {
+	return func() {
+		v.retry(fmt.Sprintf("Failed to unshare %s instance from space %s", instanceName, space), func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, instanceName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			_, spaceGUID, err := v.findSpace(ctx, org, space)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			_, err = v.client.Delete(ctx, "/v3/service_instances/"+instance.GUID+"/relationships/shared_spaces/"+spaceGUID)
+			if ccv3.IsStatus(err, http.StatusUnprocessableEntity) && strings.Contains(err.Error(), "has been shared to this space") {
+				// not shared with the space
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// Start starts an app and waits for an instance to run, like `cf start {appName}`
+func (v *CCV3) Start(appName string) func() {
+	return func() {
+		v.retry("Failed to start test app", func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if err != nil {
+				return err
+			}
+			return v.startAndWait(ctx, app.GUID, "start")
+		})
+	}
+}
+
+// SetEnv sets an app environment variable, like `cf set-env {appName} {envVarName} {instanceName}`
+func (v *CCV3) SetEnv(appName, environmentVariable, instanceName string) func() {
+	return func() {
+		v.retry("Failed to set environment variable for test app", func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if err != nil {
+				return err
+			}
+
+			_, err = v.client.Patch(ctx, "/v3/apps/"+app.GUID+"/environment_variables", map[string]interface{}{
+				"var": map[string]string{environmentVariable: instanceName},
+			}, nil)
+			return err
+		})
+	}
+}
+
+// Restage stages the app's latest package again and restarts it, like `cf restage {appName}`
+func (v *CCV3) Restage(appName string) func() {
+	return func() {
+		v.retry("Failed to restage the test app", func(ctx context.Context) error {
+			app, err := v.findApp(ctx, appName)
+			if err != nil {
+				return err
+			}
+
+			packages, err := ccv3.List[ccv3.Package](ctx, v.client, "/v3/packages?order_by=-created_at&states=READY&app_guids="+app.GUID)
+			if err != nil {
+				return err
+			}
+			if len(packages) == 0 {
+				return retry.Permanent(fmt.Errorf("app %s has no package to restage", appName))
+			}
+
+			if err := v.stage(ctx, app.GUID, packages[0].GUID); err != nil {
+				return err
+			}
+			return v.startAndWait(ctx, app.GUID, "restart")
+		})
+	}
+}
+
+// Logout forgets the current token, like `cf logout`
+func (v *CCV3) Logout() func() {
+	return func() {
+		if v.client != nil {
+			v.client.Logout()
+		}
+	}
+}
+
+// GetServiceKey reads the credentials of the named service key
+func (v *CCV3) GetServiceKey(serviceInstanceName, serviceKeyName string, credentials *Credentials) func() {
+	return func() {
+		v.retry("Failed to retrieve service bindings for app", func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, serviceInstanceName)
+			if err != nil {
+				return err
+			}
+
+			key, err := ccv3.FindByName[ccv3.ServiceCredentialBinding](ctx, v.client, "/v3/service_credential_bindings", serviceKeyName,
+				"type", "key", "service_instance_guids", instance.GUID)
+			if err != nil {
+				return fmt.Errorf("service key %s: %w", serviceKeyName, err)
+			}
+
+			var details ccv3.ServiceCredentialBindingDetails
+			if err := v.client.Get(ctx, "/v3/service_credential_bindings/"+key.GUID+"/details", &details); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(details.Credentials, credentials); err != nil {
+				return retry.Permanent(fmt.Errorf("failed to decode service key: %w", err))
+			}
+			return nil
+		})
+
+		validateCredentials(*credentials)
+	}
+}
+
+// CreateServiceKey creates a service key, like `cf create-service-key {serviceInstanceName} {serviceKeyName} -c {params}`
+func (v *CCV3) CreateServiceKey(serviceInstanceName, serviceKeyName string, params Parameters) func() {
+	return func() {
+		v.retry("Failed to create service key for Redis service instance", func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, serviceInstanceName)
+			if err != nil {
+				return err
+			}
+
+			location, err := v.client.Post(ctx, "/v3/service_credential_bindings", withParameters(map[string]interface{}{
+				"type": "key",
+				"name": serviceKeyName,
+				"relationships": map[string]interface{}{
+					"service_instance": ccv3.RelatedTo(instance.GUID),
+				},
+			}, params), nil)
+			if isNameTaken(err) {
+				return nil
+			}
+			if err == nil && location != "" {
+				err = v.client.PollJob(ctx, location, asyncPollInterval)
+			}
+			return err
+		})
+	}
+}
+
+// DeleteServiceKey deletes a service key, like `cf delete-service-key -f {serviceInstanceName} {serviceKeyName}`
+func (v *CCV3) DeleteServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	return func() {
+		v.retry("Failed to delete service key for Redis service instance", func(ctx context.Context) error {
+			instance, err := v.findServiceInstance(ctx, serviceInstanceName)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			key, err := ccv3.FindByName[ccv3.ServiceCredentialBinding](ctx, v.client, "/v3/service_credential_bindings", serviceKeyName,
+				"type", "key", "service_instance_guids", instance.GUID)
+			if errors.Is(err, ccv3.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return v.deleteAndWait(ctx, "/v3/service_credential_bindings/"+key.GUID)
+		})
+	}
+}
+
+// retry runs op once a Cloud Controller has been targeted.
+func (v *CCV3) retry(failReason string, op func(ctx context.Context) error) {
+	v.run(failReason, func(ctx context.Context) error {
+		if v.client == nil {
+			return retry.Permanent(ccv3.ErrNotAuthenticated)
+		}
+		return op(ctx)
+	})
+}
+
+// run runs op with the configured retries, backoff and per-attempt timeout.
+// Errors the Cloud Controller will keep returning stop it at once.
+func (v *CCV3) run(failReason string, op func(ctx context.Context) error) {
+	retry.Do(func(ctx context.Context) error {
+		if err := op(ctx); err != nil {
+			if ccv3.IsRetryable(err) {
+				return err
+			}
+			return retry.Permanent(err)
+		}
+		return nil
+	}).Named(failReason).WithAttemptTimeout(v.ShortTimeout).AndMaxRetries(v.MaxRetries).AndBackoff(v.RetryBackoff).Run(
+		fmt.Sprintf(`{"FailReason": "%s"}`, failReason),
+	)
+}
+
+func (v *CCV3) asyncWait() asyncWait {
+	return asyncWait{timeout: v.LongTimeout, interval: v.AsyncPollInterval}
+}
+
+// lastOperation fetches an instance's last operation from the v3 API.
+func (v *CCV3) lastOperation(instanceName string) lastOperationFetcher {
+	return func(ctx context.Context) (LastOperation, error) {
+		instance, err := v.findServiceInstance(ctx, instanceName)
+		if errors.Is(err, ccv3.ErrNotFound) {
+			return LastOperation{}, errInstanceNotFound
+		}
+		if err != nil {
+			return LastOperation{}, err
+		}
+
+		return LastOperation(instance.LastOperation), nil
+	}
+}
+
+func (v *CCV3) deleteAndWait(ctx context.Context, path string) error {
+	location, err := v.client.Delete(ctx, path)
+	if err != nil || location == "" {
+		return err
+	}
+	return v.client.PollJob(ctx, location, asyncPollInterval)
+}
+
+func (v *CCV3) findSpace(ctx context.Context, org, space string) (string, string, error) {
+	o, err := ccv3.FindByName[ccv3.Organization](ctx, v.client, "/v3/organizations", org)
+	if err != nil {
+		return "", "", fmt.Errorf("org %s: %w", org, err)
+	}
+
+	s, err := ccv3.FindByName[ccv3.Space](ctx, v.client, "/v3/spaces", space, "organization_guids", o.GUID)
+	if err != nil {
+		return "", "", fmt.Errorf("space %s: %w", space, err)
+	}
+
+	return o.GUID, s.GUID, nil
+}
+
+func (v *CCV3) findApp(ctx context.Context, appName string) (ccv3.App, error) {
+	app, err := ccv3.FindByName[ccv3.App](ctx, v.client, "/v3/apps", appName, "space_guids", v.spaceGUID)
+	if err != nil {
+		return app, fmt.Errorf("app %s: %w", appName, err)
+	}
+	return app, nil
+}
+
+func (v *CCV3) findServiceInstance(ctx context.Context, instanceName string) (ccv3.ServiceInstance, error) {
+	instance, err := ccv3.FindByName[ccv3.ServiceInstance](ctx, v.client, "/v3/service_instances", instanceName, "space_guids", v.spaceGUID)
+	if err != nil {
+		return instance, fmt.Errorf("service instance %s: %w", instanceName, err)
+	}
+	return instance, nil
+}
+
+func (v *CCV3) servicePlans(ctx context.Context, service string) ([]ccv3.ServicePlan, error) {
+	offering, err := ccv3.FindByName[ccv3.ServiceOffering](ctx, v.client, "/v3/service_offerings", service)
+	if err != nil {
+		return nil, fmt.Errorf("service offering %s: %w", service, err)
+	}
+
+	return ccv3.List[ccv3.ServicePlan](ctx, v.client, "/v3/service_plans?service_offering_guids="+offering.GUID)
+}
+
+// enablePlans adds org to the visibility of each plan that is not already
+// public. Adding an org that can already see a plan is a no-op.
+func (v *CCV3) enablePlans(ctx context.Context, org string, plans []ccv3.ServicePlan) error {
+	o, err := ccv3.FindByName[ccv3.Organization](ctx, v.client, "/v3/organizations", org)
+	if err != nil {
+		return fmt.Errorf("org %s: %w", org, err)
+	}
+
+	for _, plan := range plans {
+		if plan.VisibilityType == "public" {
+			continue
+		}
+
+		_, err := v.client.Post(ctx, "/v3/service_plans/"+plan.GUID+"/visibility", map[string]interface{}{
+			"type":          "organization",
+			"organizations": []ccv3.RelatedGUID{{GUID: o.GUID}},
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *CCV3) uaaUserID(ctx context.Context, name string) (string, error) {
+	var users struct {
+		Resources []struct {
+			ID string `json:"id"`
+		} `json:"resources"`
+	}
+
+	filter := url.Values{"filter": {fmt.Sprintf("userName eq %q", name)}}
+	if err := v.client.UAA(ctx, http.MethodGet, "/Users?"+filter.Encode(), nil, &users); err != nil {
+		return "", err
+	}
+	if len(users.Resources) == 0 {
+		return "", fmt.Errorf("user %s: %w", name, ccv3.ErrNotFound)
+	}
+
+	return users.Resources[0].ID, nil
+}
+
+type pushOptions struct {
+	path       string
+	buildpack  string
+	memoryMB   int
+	diskMB     int
+	instances  int
+	noStart    bool
+	appsDomain string
+}
+
+func (v *CCV3) push(ctx context.Context, appName string, options pushOptions) error {
+	lifecycle := map[string]interface{}{"type": "buildpack", "data": map[string]interface{}{}}
+	if options.buildpack != "" {
+		lifecycle["data"] = map[string]interface{}{"buildpacks": []string{options.buildpack}}
+	}
+
+	app, err := v.findApp(ctx, appName)
+	switch {
+	case errors.Is(err, ccv3.ErrNotFound):
+		_, err = v.client.Post(ctx, "/v3/apps", map[string]interface{}{
+			"name":          appName,
+			"lifecycle":     lifecycle,
+			"relationships": map[string]interface{}{"space": ccv3.RelatedTo(v.spaceGUID)},
+		}, &app)
+	case err == nil:
+		_, err = v.client.Patch(ctx, "/v3/apps/"+app.GUID, map[string]interface{}{"lifecycle": lifecycle}, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	scale := map[string]interface{}{}
+	if options.memoryMB > 0 {
+		scale["memory_in_mb"] = options.memoryMB
+	}
+	if options.diskMB > 0 {
+		scale["disk_in_mb"] = options.diskMB
+	}
+	if options.instances > 0 {
+		scale["instances"] = options.instances
+	}
+	if len(scale) > 0 {
+		if _, err := v.client.Post(ctx, "/v3/apps/"+app.GUID+"/processes/web/actions/scale", scale, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := v.mapDefaultRoute(ctx, app.GUID, appName); err != nil {
+		return err
+	}
+
+	bits, err := zipDirectory(options.path)
+	if err != nil {
+		return retry.Permanent(fmt.Errorf("failed to zip %s: %w", options.path, err))
+	}
+
+	var pkg ccv3.Package
+	if _, err := v.client.Post(ctx, "/v3/packages", map[string]interface{}{
+		"type":          "bits",
+		"relationships": map[string]interface{}{"app": ccv3.RelatedTo(app.GUID)},
+	}, &pkg); err != nil {
+		return err
+	}
+	if err := v.client.Upload(ctx, "/v3/packages/"+pkg.GUID+"/upload", "bits", "app.zip", bits); err != nil {
+		return err
+	}
+	if err := waitFor(ctx, v.client, "/v3/packages/"+pkg.GUID, func(p ccv3.Package) (bool, error) {
+		if p.State == "FAILED" || p.State == "EXPIRED" {
+			return false, fmt.Errorf("package %s", strings.ToLower(p.State))
+		}
+		return p.State == "READY", nil
+	}); err != nil {
+		return err
+	}
+
+	if err := v.stage(ctx, app.GUID, pkg.GUID); err != nil {
+		return err
+	}
+
+	if options.noStart {
+		return nil
+	}
+	return v.startAndWait(ctx, app.GUID, "restart")
+}
+
+func (v *CCV3) stage(ctx context.Context, appGUID, packageGUID string) error {
+	var build ccv3.Build
+	if _, err := v.client.Post(ctx, "/v3/builds", map[string]interface{}{
+		"package": ccv3.RelatedGUID{GUID: packageGUID},
+	}, &build); err != nil {
+		return err
+	}
+
+	if err := waitFor(ctx, v.client, "/v3/builds/"+build.GUID, func(b ccv3.Build) (bool, error) {
+		if b.State == "FAILED" {
+			return false, fmt.Errorf("staging failed: %s", b.Error)
+		}
+		build = b
+		return b.State == "STAGED", nil
+	}); err != nil {
+		return err
+	}
+
+	_, err := v.client.Patch(ctx, "/v3/apps/"+appGUID+"/relationships/current_droplet", ccv3.Relationship{Data: build.Droplet}, nil)
+	return err
+}
+
+func (v *CCV3) startAndWait(ctx context.Context, appGUID, action string) error {
+	if _, err := v.client.Post(ctx, "/v3/apps/"+appGUID+"/actions/"+action, nil, nil); err != nil {
+		return err
+	}
+
+	return waitFor(ctx, v.client, "/v3/apps/"+appGUID+"/processes/web/stats", func(stats ccv3.ProcessStats) (bool, error) {
+		for _, instance := range stats.Resources {
+			if instance.State == "RUNNING" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+func (v *CCV3) mapDefaultRoute(ctx context.Context, appGUID, host string) error {
+	var domain ccv3.Domain
+	var err error
+	if v.AppsDomain != "" {
+		domain, err = ccv3.FindByName[ccv3.Domain](ctx, v.client, "/v3/domains", v.AppsDomain)
+	} else {
+		var domains []ccv3.Domain
+		domains, err = ccv3.List[ccv3.Domain](ctx, v.client, "/v3/domains")
+		if err == nil && len(domains) == 0 {
+			err = fmt.Errorf("domain: %w", ccv3.ErrNotFound)
+		}
+		if err == nil {
+			domain = domains[0]
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var route ccv3.Route
+	_, err = v.client.Post(ctx, "/v3/routes", map[string]interface{}{
+		"host": host,
+		"relationships": map[string]interface{}{
+			"space":  ccv3.RelatedTo(v.spaceGUID),
+			"domain": ccv3.RelatedTo(domain.GUID),
+		},
+	}, &route)
+	if ccv3.IsStatus(err, http.StatusUnprocessableEntity) {
+		var routes []ccv3.Route
+		query := url.Values{"hosts": {host}, "domain_guids": {domain.GUID}}
+		routes, err = ccv3.List[ccv3.Route](ctx, v.client, "/v3/routes?"+query.Encode())
+		if err == nil && len(routes) > 0 {
+			route = routes[0]
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = v.client.Post(ctx, "/v3/routes/"+route.GUID+"/destinations", map[string]interface{}{
+		"destinations": []map[string]interface{}{{"app": ccv3.RelatedGUID{GUID: appGUID}}},
+	}, nil)
+	return err
+}
+
+// waitFor polls path until done reports true or an error, or ctx is done.
+func waitFor[T any](ctx context.Context, client *ccv3.Client, path string, done func(T) (bool, error)) error {
+	for {
+		var resource T
+		if err := client.Get(ctx, path, &resource); err != nil {
+			return err
+		}
+
+		finished, err := done(resource)
+		if err != nil {
+			return retry.Permanent(err)
+		}
+		if finished {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(asyncPollInterval):
+		}
+	}
+}
+
+var spaceRoleTypes = map[string]string{
+	"SpaceManager":   "space_manager",
+	"SpaceDeveloper": "space_developer",
+	"SpaceAuditor":   "space_auditor",
+	"SpaceSupporter": "space_supporter",
+}
+
+func isNameTaken(err error) bool {
+	var apiErr *ccv3.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	for _, detail := range apiErr.Errors {
+		if strings.HasSuffix(detail.Title, "NameTaken") || strings.Contains(detail.Detail, "already taken") {
+			return true
+		}
+	}
+	return false
+}
+
+func isQuotaReached(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "instance limit for this service has been reached") ||
+		strings.Contains(message, "plan instance limit exceeded for service") ||
+		strings.Contains(message, "global instance limit exceeded for service")
+}
+
+func pushOptionsFromArgs(args []string) (pushOptions, error) {
+	options := pushOptions{path: "."}
+
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if flag == "--no-start" {
+			options.noStart = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return options, fmt.Errorf("flag %s needs a value", flag)
+		}
+		value := args[i+1]
+		i++
+
+		var err error
+		switch flag {
+		case "-p":
+			options.path = value
+		case "-b":
+			options.buildpack = value
+		case "-m":
+			options.memoryMB, err = megabytes(value)
+		case "-k":
+			options.diskMB, err = megabytes(value)
+		case "-i":
+			options.instances, err = strconv.Atoi(value)
+		default:
+			return options, fmt.Errorf("unsupported flag %s", flag)
+		}
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, nil
+}
+
+func quotaFromArgs(name string, args []string) (map[string]interface{}, error) {
+	apps := map[string]interface{}{}
+	services := map[string]interface{}{"paid_services_allowed": false}
+	routes := map[string]interface{}{}
+
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if flag == "--allow-paid-service-plans" {
+			services["paid_services_allowed"] = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("flag %s needs a value", flag)
+		}
+		value := args[i+1]
+		i++
+
+		var err error
+		switch flag {
+		case "-m":
+			apps["total_memory_in_mb"], err = megabytes(value)
+		case "-i":
+			apps["per_process_memory_in_mb"], err = megabytes(value)
+		case "-r":
+			routes["total_routes"], err = strconv.Atoi(value)
+		case "-s":
+			services["total_service_instances"], err = strconv.Atoi(value)
+		default:
+			return nil, fmt.Errorf("unsupported flag %s", flag)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"name":     name,
+		"apps":     apps,
+		"services": services,
+		"routes":   routes,
+	}, nil
+}
+
+// megabytes parses cf cli sizes such as 256M or 1G.
+func megabytes(size string) (int, error) {
+	upper := strings.ToUpper(strings.TrimSuffix(strings.ToUpper(size), "B"))
+
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(upper, "G"):
+		multiplier = 1024
+		upper = strings.TrimSuffix(upper, "G")
+	case strings.HasSuffix(upper, "M"):
+		upper = strings.TrimSuffix(upper, "M")
+	}
+
+	n, err := strconv.Atoi(upper)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return n * multiplier, nil
+}
+
+// zipDirectory archives dir the way cf push uploads it, leaving out version
+// control metadata.
+func zipDirectory(dir string) ([]byte, error) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || relative == "." {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relative)
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		w, err := writer.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
@@ -0,0 +1,365 @@
+// Package ccv3 is a minimal client for the Cloud Controller v3 API and the
+// UAA endpoints it needs, covering what the smoke tests do to a foundation.
+package ccv3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before expiry an access token is refreshed.
+const tokenRefreshMargin = 30 * time.Second
+
+// Client talks to a single Cloud Controller on behalf of a single UAA user or
+// client. It is safe for concurrent use.
+type Client struct {
+	api        string
+	uaa        string
+	httpClient *http.Client
+
+	lock  sync.Mutex
+	token token
+	grant url.Values
+}
+
+type token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	expiry       time.Time
+}
+
+// NewClient discovers the UAA endpoint advertised by the Cloud Controller at
+// api. api may omit the scheme, in which case https is used.
+func NewClient(ctx context.Context, api string, skipSSLValidation bool) (*Client, error) {
+	if !strings.Contains(api, "://") {
+		api = "https://" + api
+	}
+
+	c := &Client{
+		api: strings.TrimRight(api, "/"),
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSSLValidation},
+			},
+		},
+	}
+
+	var root struct {
+		Links map[string]*struct {
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := c.send(ctx, http.MethodGet, c.api+"/", nil, "", &root); err != nil {
+		return nil, fmt.Errorf("failed to read the Cloud Controller root: %w", err)
+	}
+
+	for _, name := range []string{"uaa", "login"} {
+		if link := root.Links[name]; link != nil && link.Href != "" {
+			c.uaa = strings.TrimRight(link.Href, "/")
+			break
+		}
+	}
+	if c.uaa == "" {
+		return nil, fmt.Errorf("the Cloud Controller at %s does not advertise a UAA endpoint", c.api)
+	}
+
+	return c, nil
+}
+
+// AuthenticatePassword logs in as a user, the way `cf auth` does.
+func (c *Client) AuthenticatePassword(ctx context.Context, username, password string) error {
+	return c.authenticate(ctx, url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+		"client_id":  {"cf"},
+	})
+}
+
+// AuthenticateClient logs in with client credentials, the way
+// `cf auth --client-credentials` does.
+func (c *Client) AuthenticateClient(ctx context.Context, clientID, clientSecret string) error {
+	return c.authenticate(ctx, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+}
+
+// Logout forgets the current token and how it was obtained.
+func (c *Client) Logout() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.token = token{}
+	c.grant = nil
+}
+
+func (c *Client) authenticate(ctx context.Context, grant url.Values) error {
+	t, err := c.requestToken(ctx, grant)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.token = t
+	c.grant = grant
+	return nil
+}
+
+func (c *Client) requestToken(ctx context.Context, grant url.Values) (token, error) {
+	form := url.Values{}
+	for k, v := range grant {
+		if k != "client_id" && k != "client_secret" {
+			form[k] = v
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uaa+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(grant.Get("client_id"), grant.Get("client_secret"))
+
+	var t token
+	if err := c.roundTrip(req, &t); err != nil {
+		return token{}, fmt.Errorf("failed to get a UAA token: %w", err)
+	}
+	t.expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+
+	return t, nil
+}
+
+// accessToken returns a token that is valid for at least tokenRefreshMargin,
+// refreshing it first if needed. force refreshes it regardless.
+func (c *Client) accessToken(ctx context.Context, force bool) (string, error) {
+	c.lock.Lock()
+	current, grant := c.token, c.grant
+	c.lock.Unlock()
+
+	if grant == nil {
+		return "", ErrNotAuthenticated
+	}
+	if !force && time.Until(current.expiry) > tokenRefreshMargin {
+		return current.AccessToken, nil
+	}
+
+	var refreshed token
+	var err error
+	if current.RefreshToken != "" {
+		refreshed, err = c.requestToken(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {current.RefreshToken},
+			"client_id":     grant["client_id"],
+			"client_secret": grant["client_secret"],
+		})
+	}
+	if current.RefreshToken == "" || err != nil {
+		refreshed, err = c.requestToken(ctx, grant)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.lock.Lock()
+	c.token = refreshed
+	c.lock.Unlock()
+
+	return refreshed.AccessToken, nil
+}
+
+// Get decodes the resource at path into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	_, err := c.do(ctx, http.MethodGet, c.api+path, body(nil), out)
+	return err
+}
+
+// Post creates a resource. For asynchronous operations the returned job URL is
+// non-empty and can be passed to PollJob.
+func (c *Client) Post(ctx context.Context, path string, in, out interface{}) (string, error) {
+	return c.do(ctx, http.MethodPost, c.api+path, body(in), out)
+}
+
+func (c *Client) Patch(ctx context.Context, path string, in, out interface{}) (string, error) {
+	return c.do(ctx, http.MethodPatch, c.api+path, body(in), out)
+}
+
+func (c *Client) Delete(ctx context.Context, path string) (string, error) {
+	return c.do(ctx, http.MethodDelete, c.api+path, body(nil), nil)
+}
+
+// UAA sends a request to the UAA, for the user management the Cloud
+// Controller does not do itself.
+func (c *Client) UAA(ctx context.Context, method, path string, in, out interface{}) error {
+	_, err := c.do(ctx, method, c.uaa+path, body(in), out)
+	return err
+}
+
+// Upload posts a multipart form with a single file field, as package bit
+// uploads require.
+func (c *Client) Upload(ctx context.Context, path, field, filename string, contents []byte) error {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(contents); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	_, err = c.do(ctx, http.MethodPost, c.api+path, requestBody{
+		contents:    form.Bytes(),
+		contentType: writer.FormDataContentType(),
+	}, nil)
+	return err
+}
+
+// PollJob waits for an asynchronous job to finish, failing if it fails.
+func (c *Client) PollJob(ctx context.Context, jobURL string, interval time.Duration) error {
+	for {
+		var job Job
+		if _, err := c.do(ctx, http.MethodGet, jobURL, body(nil), &job); err != nil {
+			return err
+		}
+
+		switch job.State {
+		case JobComplete:
+			return nil
+		case JobFailed:
+			return &Error{StatusCode: http.StatusOK, Errors: job.Errors}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+type requestBody struct {
+	contents    []byte
+	contentType string
+	err         error
+}
+
+func body(in interface{}) requestBody {
+	if in == nil {
+		return requestBody{}
+	}
+
+	contents, err := json.Marshal(in)
+	return requestBody{contents: contents, contentType: "application/json", err: err}
+}
+
+// do sends an authenticated request, refreshing the token and trying once more
+// if the first attempt is rejected as unauthorized.
+func (c *Client) do(ctx context.Context, method, target string, in requestBody, out interface{}) (string, error) {
+	if in.err != nil {
+		return "", in.err
+	}
+
+	var location string
+	var err error
+	for _, force := range []bool{false, true} {
+		var accessToken string
+		accessToken, err = c.accessToken(ctx, force)
+		if err != nil {
+			return "", err
+		}
+
+		location, err = c.sendWithToken(ctx, method, target, in, accessToken, out)
+		if !IsStatus(err, http.StatusUnauthorized) {
+			break
+		}
+	}
+
+	return location, err
+}
+
+func (c *Client) sendWithToken(ctx context.Context, method, target string, in requestBody, accessToken string, out interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(in.contents))
+	if err != nil {
+		return "", err
+	}
+	if in.contentType != "" {
+		req.Header.Set("Content-Type", in.contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "bearer "+accessToken)
+
+	location := ""
+	err = c.roundTripWith(req, out, func(resp *http.Response) {
+		if resp.StatusCode == http.StatusAccepted {
+			location = resp.Header.Get("Location")
+		}
+	})
+	return location, err
+}
+
+// send makes an unauthenticated request.
+func (c *Client) send(ctx context.Context, method, target string, in []byte, contentType string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(in))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	return c.roundTrip(req, out)
+}
+
+func (c *Client) roundTrip(req *http.Request, out interface{}) error {
+	return c.roundTripWith(req, out, func(*http.Response) {})
+}
+
+func (c *Client) roundTripWith(req *http.Request, out interface{}, inspect func(*http.Response)) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(contents, apiErr) != nil || len(apiErr.Errors) == 0 {
+			apiErr.Errors = []ErrorDetail{{Title: http.StatusText(resp.StatusCode), Detail: strings.TrimSpace(string(contents))}}
+		}
+		return apiErr
+	}
+
+	inspect(resp)
+
+	if out == nil || len(contents) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(contents, out)
+}
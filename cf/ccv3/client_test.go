@@ -0,0 +1,251 @@
+package ccv3_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/ccv3"
+)
+
+// fakeCloudController serves the root document, a UAA token endpoint and
+// whatever handlers a spec registers.
+type fakeCloudController struct {
+	*httptest.Server
+	mux *http.ServeMux
+
+	lock          sync.Mutex
+	tokens        int
+	grants        []string
+	rejectedToken string
+}
+
+func newFakeCloudController() *fakeCloudController {
+	fake := &fakeCloudController{mux: http.NewServeMux()}
+	fake.Server = httptest.NewServer(fake.mux)
+
+	fake.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"links": {"login": {"href": "%s/login"}, "uaa": {"href": "%s/uaa"}}}`, fake.URL, fake.URL)
+	})
+
+	fake.mux.HandleFunc("/uaa/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		Expect(r.ParseForm()).To(Succeed())
+
+		fake.lock.Lock()
+		fake.tokens++
+		fake.grants = append(fake.grants, r.PostForm.Get("grant_type"))
+		n := fake.tokens
+		fake.lock.Unlock()
+
+		fmt.Fprintf(w, `{"access_token": "token-%d", "refresh_token": "refresh-%d", "expires_in": 3600}`, n, n)
+	})
+
+	return fake
+}
+
+func (fake *fakeCloudController) handle(path string, handler http.HandlerFunc) {
+	fake.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		fake.lock.Lock()
+		rejected := r.Header.Get("Authorization") == "bearer "+fake.rejectedToken
+		fake.lock.Unlock()
+
+		if rejected {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors": [{"code": 1000, "title": "CF-InvalidAuthToken", "detail": "Invalid Auth Token"}]}`)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func (fake *fakeCloudController) grantTypes() []string {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return append([]string(nil), fake.grants...)
+}
+
+var _ = Describe("Client", func() {
+	var (
+		ctx    context.Context
+		fake   *fakeCloudController
+		client *ccv3.Client
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		fake = newFakeCloudController()
+		DeferCleanup(fake.Close)
+
+		var err error
+		client, err = ccv3.NewClient(ctx, fake.URL, false)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("refuses to make requests before authenticating", func() {
+		err := client.Get(ctx, "/v3/organizations", nil)
+		Expect(errors.Is(err, ccv3.ErrNotAuthenticated)).To(BeTrue())
+		Expect(ccv3.IsRetryable(err)).To(BeFalse())
+	})
+
+	It("fails when the Cloud Controller does not advertise a UAA", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"links": {}}`)
+		}))
+		defer server.Close()
+
+		_, err := ccv3.NewClient(ctx, server.URL, false)
+		Expect(err).To(MatchError(ContainSubstring("does not advertise a UAA endpoint")))
+	})
+
+	Context("when authenticated", func() {
+		BeforeEach(func() {
+			Expect(client.AuthenticatePassword(ctx, "admin", "secret")).To(Succeed())
+		})
+
+		It("sends the access token", func() {
+			fake.handle("/v3/organizations/some-guid", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("Authorization")).To(Equal("bearer token-1"))
+				fmt.Fprint(w, `{"guid": "some-guid", "name": "some-org"}`)
+			})
+
+			var org ccv3.Organization
+			Expect(client.Get(ctx, "/v3/organizations/some-guid", &org)).To(Succeed())
+			Expect(org.Name).To(Equal("some-org"))
+		})
+
+		It("refreshes a rejected token and tries once more", func() {
+			fake.lock.Lock()
+			fake.rejectedToken = "token-1"
+			fake.lock.Unlock()
+
+			fake.handle("/v3/spaces/some-guid", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"guid": "some-guid"}`)
+			})
+
+			Expect(client.Get(ctx, "/v3/spaces/some-guid", nil)).To(Succeed())
+			Expect(fake.grantTypes()).To(Equal([]string{"password", "refresh_token"}))
+		})
+
+		It("returns the job URL of asynchronous operations", func() {
+			fake.handle("/v3/service_instances/some-guid", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Method).To(Equal(http.MethodDelete))
+				w.Header().Set("Location", fake.URL+"/v3/jobs/some-job")
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			location, err := client.Delete(ctx, "/v3/service_instances/some-guid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(location).To(Equal(fake.URL + "/v3/jobs/some-job"))
+		})
+
+		It("follows pagination", func() {
+			fake.handle("/v3/apps", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("page") == "2" {
+					fmt.Fprint(w, `{"pagination": {"next": null}, "resources": [{"guid": "app-2"}]}`)
+					return
+				}
+				fmt.Fprintf(w, `{"pagination": {"next": {"href": "%s/v3/apps?page=2"}}, "resources": [{"guid": "app-1"}]}`, fake.URL)
+			})
+
+			apps, err := ccv3.List[ccv3.App](ctx, client, "/v3/apps")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apps).To(HaveLen(2))
+			Expect(apps[1].GUID).To(Equal("app-2"))
+		})
+
+		It("finds resources by name", func() {
+			fake.handle("/v3/spaces", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("organization_guids")).To(Equal("org-guid"))
+				if r.URL.Query().Get("names") != "some-space" {
+					fmt.Fprint(w, `{"resources": []}`)
+					return
+				}
+				fmt.Fprint(w, `{"resources": [{"guid": "space-guid", "name": "some-space"}]}`)
+			})
+
+			space, err := ccv3.FindByName[ccv3.Space](ctx, client, "/v3/spaces", "some-space", "organization_guids", "org-guid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(space.GUID).To(Equal("space-guid"))
+
+			_, err = ccv3.FindByName[ccv3.Space](ctx, client, "/v3/spaces", "other-space", "organization_guids", "org-guid")
+			Expect(errors.Is(err, ccv3.ErrNotFound)).To(BeTrue())
+		})
+
+		It("decodes error responses", func() {
+			fake.handle("/v3/service_instances", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprint(w, `{"errors": [{"code": 60002, "title": "CF-ServiceInstanceNameTaken", "detail": "The service instance name is taken"}]}`)
+			})
+
+			_, err := client.Post(ctx, "/v3/service_instances", map[string]string{"name": "taken"}, nil)
+
+			var apiErr *ccv3.Error
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.HasTitle("CF-ServiceInstanceNameTaken")).To(BeTrue())
+			Expect(ccv3.IsStatus(err, http.StatusUnprocessableEntity)).To(BeTrue())
+			Expect(ccv3.IsRetryable(err)).To(BeFalse())
+		})
+
+		It("treats server errors as retryable", func() {
+			fake.handle("/v3/organizations", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			})
+
+			err := client.Get(ctx, "/v3/organizations", nil)
+			Expect(ccv3.IsStatus(err, http.StatusBadGateway)).To(BeTrue())
+			Expect(ccv3.IsRetryable(err)).To(BeTrue())
+		})
+
+		Describe("PollJob", func() {
+			It("waits for the job to complete", func() {
+				polls := 0
+				fake.handle("/v3/jobs/some-job", func(w http.ResponseWriter, r *http.Request) {
+					polls++
+					state := ccv3.JobProcessing
+					if polls == 3 {
+						state = ccv3.JobComplete
+					}
+					json.NewEncoder(w).Encode(ccv3.Job{GUID: "some-job", State: state})
+				})
+
+				Expect(client.PollJob(ctx, fake.URL+"/v3/jobs/some-job", time.Millisecond)).To(Succeed())
+				Expect(polls).To(Equal(3))
+			})
+
+			It("returns the errors of a failed job, which are not retryable", func() {
+				fake.handle("/v3/jobs/some-job", func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, `{"state": "FAILED", "errors": [{"title": "CF-ServiceBrokerRequestRejected", "detail": "instance limit for this service has been reached"}]}`)
+				})
+
+				err := client.PollJob(ctx, fake.URL+"/v3/jobs/some-job", time.Millisecond)
+				Expect(err).To(MatchError(ContainSubstring("instance limit for this service has been reached")))
+				Expect(ccv3.IsRetryable(err)).To(BeFalse())
+			})
+
+			It("stops when the context is done", func() {
+				fake.handle("/v3/jobs/some-job", func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprint(w, `{"state": "PROCESSING"}`)
+				})
+
+				cancelled, cancel := context.WithCancel(ctx)
+				cancel()
+
+				err := client.PollJob(cancelled, fake.URL+"/v3/jobs/some-job", time.Hour)
+				Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			})
+		})
+	})
+})
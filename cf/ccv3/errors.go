@@ -0,0 +1,80 @@
+package ccv3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNotAuthenticated is returned for requests made before logging in.
+var ErrNotAuthenticated = errors.New("not logged in to the Cloud Controller")
+
+// ErrNotFound is returned by lookups by name that match nothing.
+var ErrNotFound = errors.New("not found")
+
+// Error is an error response from the Cloud Controller or the UAA, or a
+// failed asynchronous job.
+type Error struct {
+	StatusCode int           `json:"-"`
+	Errors     []ErrorDetail `json:"errors"`
+}
+
+type ErrorDetail struct {
+	Code   int    `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	details := make([]string, len(e.Errors))
+	for i, detail := range e.Errors {
+		details[i] = fmt.Sprintf("%s: %s", detail.Title, detail.Detail)
+	}
+
+	return fmt.Sprintf("%d %s", e.StatusCode, strings.Join(details, "; "))
+}
+
+// HasTitle reports whether any of the errors has the given title, e.g.
+// "CF-ServiceInstanceNameTaken".
+func (e *Error) HasTitle(title string) bool {
+	for _, detail := range e.Errors {
+		if detail.Title == title {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsStatus reports whether err is an API error with the given status code.
+func IsStatus(err error, statusCode int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// IsRetryable reports whether err may go away if the request is sent again:
+// network errors, rate limiting and server side failures. Other client errors
+// and failed jobs will not.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrNotAuthenticated) || errors.Is(err, ErrNotFound) {
+		return false
+	}
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusOK:
+		// a failed job
+		return false
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return true
+	case apiErr.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
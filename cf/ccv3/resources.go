@@ -0,0 +1,218 @@
+package ccv3
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const (
+	JobComplete   = "COMPLETE"
+	JobFailed     = "FAILED"
+	JobProcessing = "PROCESSING"
+
+	OperationInProgress = "in progress"
+	OperationSucceeded  = "succeeded"
+	OperationFailed     = "failed"
+)
+
+type Job struct {
+	GUID   string        `json:"guid"`
+	State  string        `json:"state"`
+	Errors []ErrorDetail `json:"errors"`
+}
+
+// Relationship is a to-one relationship, e.g. a space's organization.
+type Relationship struct {
+	Data *RelatedGUID `json:"data"`
+}
+
+// ToManyRelationship is a to-many relationship, e.g. the spaces a security
+// group is bound to.
+type ToManyRelationship struct {
+	Data []RelatedGUID `json:"data"`
+}
+
+type RelatedGUID struct {
+	GUID string `json:"guid"`
+}
+
+func RelatedTo(guid string) Relationship {
+	return Relationship{Data: &RelatedGUID{GUID: guid}}
+}
+
+type LastOperation struct {
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+type Organization struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type Space struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type OrganizationQuota struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type ServiceOffering struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+// MaintenanceInfo versions the broker's deployment of a plan. An instance
+// whose version is behind its plan's can be upgraded.
+type MaintenanceInfo struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type ServicePlan struct {
+	GUID            string          `json:"guid"`
+	Name            string          `json:"name"`
+	VisibilityType  string          `json:"visibility_type"`
+	MaintenanceInfo MaintenanceInfo `json:"maintenance_info"`
+	Relationships   struct {
+		ServiceOffering Relationship `json:"service_offering"`
+	} `json:"relationships"`
+}
+
+type ServiceInstance struct {
+	GUID             string          `json:"guid"`
+	Name             string          `json:"name"`
+	Type             string          `json:"type"`
+	LastOperation    LastOperation   `json:"last_operation"`
+	MaintenanceInfo  MaintenanceInfo `json:"maintenance_info"`
+	UpgradeAvailable bool            `json:"upgrade_available"`
+	Relationships    struct {
+		ServicePlan Relationship `json:"service_plan"`
+	} `json:"relationships"`
+}
+
+type ServiceCredentialBinding struct {
+	GUID          string        `json:"guid"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	LastOperation LastOperation `json:"last_operation"`
+}
+
+// ServiceCredentialBindingDetails holds the credentials of a binding or key.
+type ServiceCredentialBindingDetails struct {
+	Credentials json.RawMessage `json:"credentials"`
+}
+
+type App struct {
+	GUID  string `json:"guid"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+type Package struct {
+	GUID  string `json:"guid"`
+	State string `json:"state"`
+}
+
+type Build struct {
+	GUID    string       `json:"guid"`
+	State   string       `json:"state"`
+	Error   string       `json:"error"`
+	Droplet *RelatedGUID `json:"droplet"`
+}
+
+type ProcessStats struct {
+	Resources []struct {
+		Index int    `json:"index"`
+		State string `json:"state"`
+	} `json:"resources"`
+}
+
+type Domain struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type Route struct {
+	GUID string `json:"guid"`
+	URL  string `json:"url"`
+}
+
+type SecurityGroupRule struct {
+	Protocol    string `json:"protocol"`
+	Destination string `json:"destination"`
+	Ports       string `json:"ports,omitempty"`
+}
+
+type SecurityGroup struct {
+	GUID  string              `json:"guid"`
+	Name  string              `json:"name"`
+	Rules []SecurityGroupRule `json:"rules"`
+}
+
+type User struct {
+	GUID     string `json:"guid"`
+	Username string `json:"username"`
+}
+
+type page[T any] struct {
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
+	Resources []T `json:"resources"`
+}
+
+// List fetches every page of a list endpoint.
+func List[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	var all []T
+	target := c.api + path
+
+	for target != "" {
+		var p page[T]
+		if _, err := c.do(ctx, "GET", target, body(nil), &p); err != nil {
+			return nil, err
+		}
+		all = append(all, p.Resources...)
+
+		target = ""
+		if p.Pagination.Next != nil {
+			target = p.Pagination.Next.Href
+		}
+	}
+
+	return all, nil
+}
+
+// FindByName returns the single resource named name from a list endpoint,
+// or ErrNotFound.
+func FindByName[T any](ctx context.Context, c *Client, path, name string, query ...string) (T, error) {
+	values := url.Values{"names": {name}}
+	for i := 0; i+1 < len(query); i += 2 {
+		values.Set(query[i], query[i+1])
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	resources, err := List[T](ctx, c, path+separator+values.Encode())
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if len(resources) == 0 {
+		var zero T
+		return zero, ErrNotFound
+	}
+
+	return resources[0], nil
+}
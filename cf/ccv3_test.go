@@ -0,0 +1,376 @@
+package cf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// fakeCloudController serves the root document, a UAA token endpoint and
+// whatever handlers a spec registers, recording each request it is sent.
+type fakeCloudController struct {
+	*httptest.Server
+	mux *http.ServeMux
+
+	lock     sync.Mutex
+	requests []string
+}
+
+func newFakeCloudController() *fakeCloudController {
+	fake := &fakeCloudController{mux: http.NewServeMux()}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/uaa/oauth/token" {
+			fake.lock.Lock()
+			fake.requests = append(fake.requests, r.Method+" "+r.URL.Path)
+			fake.lock.Unlock()
+		}
+		fake.mux.ServeHTTP(w, r)
+	}))
+
+	fake.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"links": {"uaa": {"href": "%s/uaa"}}}`, fake.URL)
+	})
+	fake.mux.HandleFunc("POST /uaa/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token": "token", "refresh_token": "refresh", "expires_in": 3600}`)
+	})
+
+	return fake
+}
+
+// respond registers a handler that answers pattern with status and body.
+func (fake *fakeCloudController) respond(pattern string, status int, body string) {
+	fake.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	})
+}
+
+func (fake *fakeCloudController) requested() []string {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	return append([]string(nil), fake.requests...)
+}
+
+// decodeBody decodes a JSON request body into a map.
+func decodeBody(r *http.Request) map[string]interface{} {
+	var body map[string]interface{}
+	Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+	return body
+}
+
+// zipEntries lists the names in a zip archive and the contents of its files.
+func zipEntries(archive []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	Expect(err).NotTo(HaveOccurred())
+
+	entries := map[string]string{}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		Expect(err).NotTo(HaveOccurred())
+		contents, err := io.ReadAll(f)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		entries[file.Name] = string(contents)
+	}
+	return entries
+}
+
+var _ = Describe("CCV3", func() {
+	var (
+		fake *fakeCloudController
+		v    *CCV3
+	)
+
+	BeforeEach(func() {
+		fake = newFakeCloudController()
+		DeferCleanup(fake.Close)
+
+		v = &CCV3{
+			ShortTimeout:      5 * time.Second,
+			LongTimeout:       5 * time.Second,
+			RetryBackoff:      retry.None(time.Millisecond),
+			AsyncPollInterval: time.Millisecond,
+		}
+		v.API(fake.URL, false)()
+		v.AuthClient("smoke-tests", "secret")()
+		v.spaceGUID = "space-guid"
+	})
+
+	Describe("Push", func() {
+		var (
+			appDir     string
+			created    map[string]interface{}
+			scaled     map[string]interface{}
+			uploaded   map[string]string
+			droplet    map[string]interface{}
+			destined   map[string]interface{}
+			lookedUpBy string
+		)
+
+		BeforeEach(func() {
+			created, scaled, uploaded, droplet, destined, lookedUpBy = nil, nil, nil, nil, nil, ""
+			appDir = GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(appDir, "app.rb"), []byte("puts 'hello'"), 0o644)).To(Succeed())
+
+			fake.mux.HandleFunc("GET /v3/apps", func(w http.ResponseWriter, r *http.Request) {
+				lookedUpBy = r.URL.RawQuery
+				fmt.Fprint(w, `{"resources": []}`)
+			})
+			fake.mux.HandleFunc("POST /v3/apps", func(w http.ResponseWriter, r *http.Request) {
+				created = decodeBody(r)
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprint(w, `{"guid": "app-guid", "name": "smoke-app"}`)
+			})
+			fake.mux.HandleFunc("POST /v3/apps/app-guid/processes/web/actions/scale", func(w http.ResponseWriter, r *http.Request) {
+				scaled = decodeBody(r)
+				fmt.Fprint(w, `{}`)
+			})
+			fake.respond("GET /v3/domains", http.StatusOK, `{"resources": [{"guid": "domain-guid", "name": "apps.example.com"}]}`)
+			fake.respond("POST /v3/routes", http.StatusCreated, `{"guid": "route-guid"}`)
+			fake.mux.HandleFunc("POST /v3/routes/route-guid/destinations", func(w http.ResponseWriter, r *http.Request) {
+				destined = decodeBody(r)
+				fmt.Fprint(w, `{}`)
+			})
+			fake.respond("POST /v3/packages", http.StatusCreated, `{"guid": "package-guid", "state": "AWAITING_UPLOAD"}`)
+			fake.mux.HandleFunc("POST /v3/packages/package-guid/upload", func(w http.ResponseWriter, r *http.Request) {
+				file, _, err := r.FormFile("bits")
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := io.ReadAll(file)
+				Expect(err).NotTo(HaveOccurred())
+				uploaded = zipEntries(contents)
+				fmt.Fprint(w, `{}`)
+			})
+			fake.respond("GET /v3/packages/package-guid", http.StatusOK, `{"guid": "package-guid", "state": "READY"}`)
+			fake.respond("POST /v3/builds", http.StatusCreated, `{"guid": "build-guid", "state": "STAGING"}`)
+			fake.respond("GET /v3/builds/build-guid", http.StatusOK, `{"guid": "build-guid", "state": "STAGED", "droplet": {"guid": "droplet-guid"}}`)
+			fake.mux.HandleFunc("PATCH /v3/apps/app-guid/relationships/current_droplet", func(w http.ResponseWriter, r *http.Request) {
+				droplet = decodeBody(r)
+				fmt.Fprint(w, `{}`)
+			})
+			fake.respond("POST /v3/apps/app-guid/actions/restart", http.StatusOK, `{}`)
+			fake.respond("GET /v3/apps/app-guid/processes/web/stats", http.StatusOK, `{"resources": [{"index": 0, "state": "RUNNING"}]}`)
+		})
+
+		It("creates, scales, routes, uploads, stages and starts the app", func() {
+			v.Push("smoke-app", "-m", "256M", "-k", "1G", "-i", "2", "-p", appDir, "-b", "ruby_buildpack")()
+
+			Expect(fake.requested()).To(Equal([]string{
+				"GET /v3/apps",
+				"POST /v3/apps",
+				"POST /v3/apps/app-guid/processes/web/actions/scale",
+				"GET /v3/domains",
+				"POST /v3/routes",
+				"POST /v3/routes/route-guid/destinations",
+				"POST /v3/packages",
+				"POST /v3/packages/package-guid/upload",
+				"GET /v3/packages/package-guid",
+				"POST /v3/builds",
+				"GET /v3/builds/build-guid",
+				"PATCH /v3/apps/app-guid/relationships/current_droplet",
+				"POST /v3/apps/app-guid/actions/restart",
+				"GET /v3/apps/app-guid/processes/web/stats",
+			}))
+
+			Expect(lookedUpBy).To(Equal("names=smoke-app&space_guids=space-guid"))
+			Expect(created).To(HaveKeyWithValue("lifecycle", HaveKeyWithValue("data", HaveKeyWithValue("buildpacks", ConsistOf("ruby_buildpack")))))
+			Expect(scaled).To(Equal(map[string]interface{}{"memory_in_mb": 256.0, "disk_in_mb": 1024.0, "instances": 2.0}))
+			Expect(destined).To(HaveKeyWithValue("destinations", ConsistOf(HaveKeyWithValue("app", HaveKeyWithValue("guid", "app-guid")))))
+			Expect(uploaded).To(Equal(map[string]string{"app.rb": "puts 'hello'"}))
+			Expect(droplet).To(Equal(map[string]interface{}{"data": map[string]interface{}{"guid": "droplet-guid"}}))
+		})
+
+		It("stages without starting the app with --no-start", func() {
+			v.Push("smoke-app", "-p", appDir, "--no-start")()
+
+			Expect(fake.requested()).To(ContainElement("PATCH /v3/apps/app-guid/relationships/current_droplet"))
+			Expect(fake.requested()).NotTo(ContainElement("POST /v3/apps/app-guid/actions/restart"))
+			Expect(scaled).To(BeNil())
+		})
+	})
+
+	Describe("mapDefaultRoute", func() {
+		var routeQuery map[string][]string
+
+		BeforeEach(func() {
+			v.AppsDomain = "apps.example.com"
+			fake.respond("GET /v3/domains", http.StatusOK, `{"resources": [{"guid": "domain-guid", "name": "apps.example.com"}]}`)
+			fake.respond("POST /v3/routes", http.StatusUnprocessableEntity,
+				`{"errors": [{"code": 210003, "title": "CF-RouteHostTaken", "detail": "Route already exists with host 'smoke+app' for domain 'apps.example.com'."}]}`)
+			fake.mux.HandleFunc("GET /v3/routes", func(w http.ResponseWriter, r *http.Request) {
+				routeQuery = r.URL.Query()
+				fmt.Fprint(w, `{"resources": [{"guid": "existing-route-guid"}]}`)
+			})
+			fake.respond("POST /v3/routes/existing-route-guid/destinations", http.StatusOK, `{}`)
+		})
+
+		It("maps the app to the route that already exists", func() {
+			Expect(v.mapDefaultRoute(context.Background(), "app-guid", "smoke+app")).To(Succeed())
+
+			Expect(routeQuery).To(Equal(map[string][]string{"hosts": {"smoke+app"}, "domain_guids": {"domain-guid"}}))
+			Expect(fake.requested()).To(ContainElement("POST /v3/routes/existing-route-guid/destinations"))
+		})
+	})
+
+	Describe("CreateService", func() {
+		var skip bool
+
+		BeforeEach(func() {
+			skip = false
+			fake.respond("GET /v3/service_offerings", http.StatusOK, `{"resources": [{"guid": "offering-guid", "name": "p-redis"}]}`)
+			fake.respond("GET /v3/service_plans", http.StatusOK, `{"resources": [{"guid": "plan-guid", "name": "shared-vm"}]}`)
+			fake.mux.HandleFunc("POST /v3/service_instances", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", fake.URL+"/v3/jobs/job-guid")
+				w.WriteHeader(http.StatusAccepted)
+			})
+		})
+
+		It("skips the plan when the broker has no instances left", func() {
+			fake.respond("GET /v3/jobs/job-guid", http.StatusOK,
+				`{"guid": "job-guid", "state": "FAILED", "errors": [{"title": "CF-ServiceBrokerBadResponse", "detail": "Service broker error: plan instance limit exceeded for service"}]}`)
+
+			v.CreateService("p-redis", "shared-vm", "smoke-instance", nil, &skip)()
+
+			Expect(skip).To(BeTrue())
+			Expect(fake.requested()).NotTo(ContainElement("GET /v3/service_instances"))
+		})
+
+		It("waits for the instance's last operation to succeed", func() {
+			fake.respond("GET /v3/jobs/job-guid", http.StatusOK, `{"guid": "job-guid", "state": "COMPLETE"}`)
+			fake.respond("GET /v3/service_instances", http.StatusOK,
+				`{"resources": [{"guid": "instance-guid", "name": "smoke-instance", "last_operation": {"type": "create", "state": "succeeded"}}]}`)
+
+			v.CreateService("p-redis", "shared-vm", "smoke-instance", nil, &skip)()
+
+			Expect(skip).To(BeFalse())
+			Expect(fake.requested()).To(ContainElement("GET /v3/service_instances"))
+		})
+	})
+
+	Describe("isQuotaReached", func() {
+		It("recognises each broker's quota message", func() {
+			Expect(isQuotaReached(fmt.Errorf("The service instance limit for this service has been reached"))).To(BeTrue())
+			Expect(isQuotaReached(fmt.Errorf("plan instance limit exceeded for service"))).To(BeTrue())
+			Expect(isQuotaReached(fmt.Errorf("global instance limit exceeded for service"))).To(BeTrue())
+			Expect(isQuotaReached(fmt.Errorf("broker unavailable"))).To(BeFalse())
+			Expect(isQuotaReached(nil)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("cf cli arguments", func() {
+	Describe("pushOptionsFromArgs", func() {
+		It("parses the supported flags", func() {
+			options, err := pushOptionsFromArgs([]string{"-m", "256M", "-k", "1G", "-i", "2", "-p", "app", "-b", "ruby_buildpack", "--no-start"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options).To(Equal(pushOptions{
+				path:      "app",
+				buildpack: "ruby_buildpack",
+				memoryMB:  256,
+				diskMB:    1024,
+				instances: 2,
+				noStart:   true,
+			}))
+		})
+
+		It("pushes the current directory by default", func() {
+			options, err := pushOptionsFromArgs(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(options.path).To(Equal("."))
+		})
+
+		It("rejects unsupported flags, missing values and bad sizes", func() {
+			_, err := pushOptionsFromArgs([]string{"-f", "manifest.yml"})
+			Expect(err).To(MatchError("unsupported flag -f"))
+
+			_, err = pushOptionsFromArgs([]string{"-p"})
+			Expect(err).To(MatchError("flag -p needs a value"))
+
+			_, err = pushOptionsFromArgs([]string{"-m", "lots"})
+			Expect(err).To(MatchError("invalid size lots"))
+		})
+	})
+
+	Describe("quotaFromArgs", func() {
+		It("builds an organization quota from the supported flags", func() {
+			quota, err := quotaFromArgs("smoke-quota", []string{"-m", "10G", "-i", "1G", "-r", "1000", "-s", "100", "--allow-paid-service-plans"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quota).To(Equal(map[string]interface{}{
+				"name":     "smoke-quota",
+				"apps":     map[string]interface{}{"total_memory_in_mb": 10240, "per_process_memory_in_mb": 1024},
+				"services": map[string]interface{}{"paid_services_allowed": true, "total_service_instances": 100},
+				"routes":   map[string]interface{}{"total_routes": 1000},
+			}))
+		})
+
+		It("disallows paid plans by default", func() {
+			quota, err := quotaFromArgs("smoke-quota", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quota["services"]).To(Equal(map[string]interface{}{"paid_services_allowed": false}))
+		})
+
+		It("rejects unsupported flags and bad numbers", func() {
+			_, err := quotaFromArgs("smoke-quota", []string{"-a", "10"})
+			Expect(err).To(MatchError("unsupported flag -a"))
+
+			_, err = quotaFromArgs("smoke-quota", []string{"-r", "many"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("megabytes", func() {
+		It("parses cf cli sizes", func() {
+			for size, expected := range map[string]int{"256M": 256, "256MB": 256, "1G": 1024, "2gb": 2048, "512": 512} {
+				Expect(megabytes(size)).To(Equal(expected), size)
+			}
+		})
+
+		It("rejects sizes that are not numbers", func() {
+			_, err := megabytes("1T")
+			Expect(err).To(MatchError("invalid size 1T"))
+		})
+	})
+
+	Describe("zipDirectory", func() {
+		It("archives the directory without version control metadata", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, "Gemfile"), []byte("source 'https://rubygems.org'"), 0o644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(dir, "lib"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "lib", "app.rb"), []byte("puts 'hello'"), 0o644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(dir, ".git"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main"), 0o644)).To(Succeed())
+
+			archive, err := zipDirectory(dir)
+			Expect(err).NotTo(HaveOccurred())
+
+			entries := zipEntries(archive)
+			names := make([]string, 0, len(entries))
+			for name := range entries {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			Expect(names).To(Equal([]string{"Gemfile", "lib/", "lib/app.rb"}))
+			Expect(entries["lib/app.rb"]).To(Equal("puts 'hello'"))
+		})
+
+		It("fails for a directory that does not exist", func() {
+			_, err := zipDirectory(filepath.Join(GinkgoT().TempDir(), "missing"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
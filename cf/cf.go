@@ -1,8 +1,9 @@
 package cf
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,9 +12,9 @@ import (
 	"time"
 
 	helpersCF "github.com/cloudfoundry/cf-test-helpers/v2/cf"
-	"github.com/cloudfoundry/cf-test-helpers/v2/helpers"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 )
 
@@ -23,22 +24,19 @@ type CF struct {
 	LongTimeout  time.Duration
 	MaxRetries   int
 	RetryBackoff retry.Backoff
-}
-
-type HostPort struct {
-	Host    string `json:"host"`
-	Port    int    `json:"port"`
-	TLSPort int    `json:"tls_port"`
-}
-
-type Credentials struct {
-	Host         string     `json:"host"`
-	Port         int        `json:"port"`
-	TLS_Port     int        `json:"tls_port"`
-	TLS_Versions []string   `json:"tls_versions"`
-	MasterName   string     `json:"master_name,omitempty"`
-	Sentinels    []HostPort `json:"sentinels,omitempty"`
-}
+	// AsyncPollInterval is how often the last operation of a service instance
+	// is checked while waiting up to LongTimeout for it to finish.
+	AsyncPollInterval time.Duration
+	// Resolver resolves instance hosts to security group destinations.
+	Resolver Resolver
+}
+
+// HostPort and Credentials are the credentials package's, so Platform
+// methods can name them without importing it.
+type (
+	HostPort    = credentials.HostPort
+	Credentials = credentials.Credentials
+)
 
 type SecurityGroup struct {
 	Protocol    string `json:"protocol"`
@@ -59,7 +57,7 @@ func (cf *CF) API(endpoint string, skipSSLValidation bool) func() {
 	}
 
 	return func() {
-		retry.Session(cfApiFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(cfApiFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to target Cloud Foundry"}`,
 		)
@@ -73,7 +71,7 @@ func (cf *CF) Auth(user, password string) func() {
 	}
 
 	return func() {
-		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			"{\"FailReason\": \"Failed to `cf auth` with target Cloud Foundry\"}",
 		)
@@ -87,7 +85,7 @@ func (cf *CF) AuthClient(client, clientSecret string) func() {
 	}
 
 	return func() {
-		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(authFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			"{\"FailReason\": \"Failed to `cf auth` with target Cloud Foundry\"}",
 		)
@@ -103,7 +101,7 @@ func (cf *CF) CreateQuota(name string, args ...string) func() {
 	}
 
 	return func() {
-		retry.Session(createQuotaFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createQuotaFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			"{\"FailReason\": \"Failed to `cf create-quota` with target Cloud Foundry\"}",
 		)
@@ -117,7 +115,7 @@ func (cf *CF) DeleteOrg(name string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteOrg).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteOrg).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to delete org"}`,
 		)
@@ -131,7 +129,7 @@ func (cf *CF) CreateOrg(org, quota string) func() {
 	}
 
 	return func() {
-		retry.Session(createOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to create org"}`,
 		)
@@ -149,11 +147,11 @@ func (cf *CF) EnableServiceAccess(org, service string) func() {
 	}
 
 	return func() {
-		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to disable service access for CF test org"}`,
 		)
-		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to enable service access for CF test org"}`,
 		)
@@ -172,11 +170,11 @@ func (cf *CF) EnableServiceAccessForPlan(org, service, plan string) func() {
 
 	return func() {
 		conditions := []retry.Condition{retry.Succeeds, retry.MatchesErrorOutput(regexp.MustCompile(`.*Cannot remove organization level access for public plans.*`))}
-		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).UntilAny(
+		retry.Session(disableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().UntilAny(
 			conditions,
 			`{"FailReason": "Failed to disable service access for CF test org"}`,
 		)
-		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(enableServiceAccessFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to enable service access for CF test org"}`,
 		)
@@ -189,7 +187,7 @@ func (cf *CF) TargetOrg(org string) func() {
 		return helpersCF.Cf("target", "-o", org)
 	}
 	return func() {
-		retry.Session(targetOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(targetOrgFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to target test org"}`,
 		)
@@ -203,7 +201,7 @@ func (cf *CF) TargetOrgAndSpace(org, space string) func() {
 	}
 
 	return func() {
-		retry.Session(targetFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(targetFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to target test org"}`,
 		)
@@ -217,7 +215,7 @@ func (cf *CF) CreateSpace(space string) func() {
 	}
 
 	return func() {
-		retry.Session(createSpaceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createSpaceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to create CF test space"}`,
 		)
@@ -225,24 +223,15 @@ func (cf *CF) CreateSpace(space string) func() {
 }
 
 // CreateSecurityGroup is equivalent to `cf create-security-group {securityGroup} {configPath}`
-func (cf *CF) CreateAndBindSecurityGroup(securityGroup, serviceName, org, space string) func() {
+func (cf *CF) CreateAndBindSecurityGroup(securityGroup, serviceName, serviceKeyName, org, space string) func() {
 	return func() {
-		destinations, ports := cf.securityGroupDestination(serviceName)
+		sgs := cf.securityGroupRules(serviceName, serviceKeyName)
 
 		sgFile, err := ioutil.TempFile("", "smoke-test-security-group-")
 		Expect(err).NotTo(HaveOccurred())
 		defer sgFile.Close()
 		defer os.Remove(sgFile.Name())
 
-		sgs := make([]SecurityGroup, 0)
-
-		for _, destination := range destinations {
-			dest := strings.TrimSpace(destination)
-			if dest != "" {
-				sgs = append(sgs, SecurityGroup{Protocol: "tcp", Destination: dest, Ports: ports})
-			}
-		}
-
 		err = json.NewEncoder(sgFile).Encode(sgs)
 		Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Failed to encode security groups"}`)
 
@@ -258,84 +247,10 @@ func (cf *CF) CreateAndBindSecurityGroup(securityGroup, serviceName, org, space
 	}
 }
 
-func (cf *CF) securityGroupDestination(serviceName string) ([]string, string) {
+func (cf *CF) securityGroupRules(serviceName, serviceKeyName string) []SecurityGroup {
 	serviceGuid := cf.getServiceInstanceGuid(serviceName)
-	creds := cf.getServiceKeyCredentials(serviceGuid)
-
-	var destinations []string
-	var ports string
-
-	if creds.Host != "" {
-		destinations, ports = getDefaultHostsPorts(creds)
-	} else {
-		destinations, ports = getSentinelHostPorts(creds)
-	}
-
-	return destinations, ports
-}
-
-func getDefaultHostsPorts(creds Credentials) ([]string, string) {
-	destinations := []string{"0.0.0.0/0"}
-
-	if os.Getenv("ENABLE_ALL_DESTINATIONS") != "true" {
-		session := helpers.Run("dig", "+short", creds.Host)
-		Eventually(session, 10*time.Second).Should(gexec.Exit(0))
-		ips := strings.Split(string(session.Out.Contents()), "\n")
-		if len(ips) != 0 {
-			destinations = ips
-		} else {
-			destinations = []string{creds.Host}
-		}
-	}
-
-	var ports string
-	if creds.Port != 0 {
-		ports = fmt.Sprintf("%d", creds.Port)
-	}
-	if creds.TLS_Port != 0 {
-		if ports != "" {
-			ports += fmt.Sprintf(",%d", creds.TLS_Port)
-		} else {
-			ports = fmt.Sprintf("%d", creds.TLS_Port)
-		}
-	}
-
-	return destinations, ports
-}
-
-func getSentinelHostPorts(creds Credentials) ([]string, string) {
-	destinations := []string{"0.0.0.0/0"}
-	for _, sentinel := range creds.Sentinels {
-		destination := sentinel.Host
-
-		session := helpers.Run("dig", "+short", sentinel.Host)
-		Eventually(session, 10*time.Second).Should(gexec.Exit(0))
-
-		ip := strings.TrimSpace(string(session.Out.Contents()))
-		if ip != "" {
-			destination = ip
-		}
-
-		destinations = append(destinations, destination)
-	}
-
-	var ports string
-
-	Expect(creds.Sentinels).To(HaveLen(3))
-
-	sentinel := creds.Sentinels[0]
-	redisPort, redisTLSPort := 6379, 16379 //TODO: check if there's a better way
-	if sentinel.Port != 0 {
-		ports = fmt.Sprintf("%d,%d", sentinel.Port, redisPort)
-	}
-	if sentinel.TLSPort != 0 {
-		if ports != "" {
-			ports += ","
-		}
-		ports += fmt.Sprintf("%d,%d", sentinel.TLSPort, redisTLSPort)
-	}
-
-	return destinations, ports
+	creds := cf.getServiceKeyCredentials(serviceGuid, serviceKeyName)
+	return resolveSecurityGroupRules(creds, cf.Resolver, cf.ShortTimeout, cf.MaxRetries, cf.RetryBackoff)
 }
 
 // DeleteSecurityGroup is equivalent to `cf delete-security-group {securityGroup} -f`
@@ -345,7 +260,7 @@ func (cf *CF) DeleteSecurityGroup(securityGroup string) func() {
 	}
 
 	return func() {
-		retry.Session(delSecGroupFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(delSecGroupFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to delete security group"}`,
 		)
@@ -361,7 +276,7 @@ func (cf *CF) CreateUser(name, password string) func() {
 
 	// if the user already exists, `cf create-user {name} {password}` is still OK
 	return func() {
-		retry.Session(createUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(createUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to create user"}`,
 		)
@@ -375,7 +290,7 @@ func (cf *CF) DeleteUser(name string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteUserFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to delete user"}`,
 		)
@@ -389,7 +304,7 @@ func (cf *CF) SetSpaceRole(name, org, space, role string) func() {
 	}
 
 	return func() {
-		retry.Session(setSpaceRoleFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(setSpaceRoleFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to set space role"}`,
 		)
@@ -406,7 +321,7 @@ func (cf *CF) Push(appName string, args ...string) func() {
 	}
 
 	return func() {
-		retry.Session(pushFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(pushFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			"{\"FailReason\": \"Failed to `cf push` test app\"}",
 		)
@@ -420,65 +335,109 @@ func (cf *CF) Delete(appName string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteAppFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteAppFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			"{\"FailReason\": \"Failed to `cf delete` test app\"}",
 		)
 	}
 }
 
-// CreateService is equivalent to `cf create-service {serviceName} {planName} {instanceName}`
-func (cf *CF) CreateService(serviceName, planName, instanceName string, skip *bool) func() {
+// CreateService is equivalent to `cf create-service {serviceName} {planName} {instanceName} [-c {params}]`
+func (cf *CF) CreateService(serviceName, planName, instanceName string, params Parameters, skip *bool) func() {
 	createServiceFn := func() *gexec.Session {
-		return helpersCF.Cf("create-service", serviceName, planName, instanceName)
+		return helpersCF.Cf(append([]string{"create-service", serviceName, planName, instanceName}, params.cliArgs()...)...)
 	}
 
-	succeeds := func(session *gexec.Session) bool {
-		return regexp.MustCompile("OK").Match(session.Out.Contents()) && session.ExitCode() == 0
-	}
+	succeeds := retry.And(retry.Succeeds, retry.OutputContains("OK"))
 
-	quotaReached := func(session *gexec.Session) bool {
-		failureBecauseQuotaReached :=
-			regexp.MustCompile("FAILED").Match(session.Out.Contents()) && session.ExitCode() == 1 && (
+	quotaExhausted := retry.And(
+		retry.ExitCode(1),
+		retry.OutputContains("FAILED"),
+		retry.Or(
 			// legacy release
-			regexp.MustCompile("instance limit for this service has been reached").Match(session.Out.Contents()) ||
-				// ODB plan quota
-				regexp.MustCompile("plan instance limit exceeded for service").Match(session.Out.Contents()) ||
-				// ODB global quota
-				regexp.MustCompile("global instance limit exceeded for service").Match(session.Out.Contents()))
-		if failureBecauseQuotaReached {
+			retry.OutputContains("instance limit for this service has been reached"),
+			// ODB plan quota
+			retry.OutputContains("plan instance limit exceeded for service"),
+			// ODB global quota
+			retry.OutputContains("global instance limit exceeded for service"),
+		),
+	)
+
+	quotaReached := func(session *gexec.Session) bool {
+		if quotaExhausted(session) {
 			fmt.Printf("No Plan Instances available for testing %s plan\n", planName)
 			*skip = true
+			return true
 		}
-		return failureBecauseQuotaReached
+		return false
 	}
 
 	successfulCreateServiceConditions := []retry.Condition{succeeds, quotaReached}
 
 	return func() {
-		retry.Session(createServiceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).UntilAny(
+		retry.Session(createServiceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().UntilAny(
 			successfulCreateServiceConditions,
 			`{"FailReason": "Failed to create Redis service instance"}`,
 		)
 		if !(*skip) {
-			cf.awaitServiceCreation(instanceName)
+			cf.asyncWait().awaitOperation(instanceName, fmt.Sprintf("Failed to create Redis service instance %s", instanceName), cf.lastOperation(instanceName))
 		}
 	}
 }
 
-func (cf *CF) awaitServiceCreation(instanceName string) {
-	serviceFn := func() *gexec.Session {
-		return helpersCF.Cf("service", instanceName)
+// UpdateService moves an instance to planName and passes it params, like
+// `cf update-service {instanceName} -p {planName} -c {params}`, and then, if
+// upgrade is set, upgrades it like `cf update-service {instanceName} --upgrade --force`.
+// Any of them may be left out. It waits for each update to finish.
+func (cf *CF) UpdateService(instanceName, planName string, params Parameters, upgrade bool) func() {
+	var updates [][]string
+	if planName != "" || len(params) > 0 {
+		update := []string{"update-service", instanceName}
+		if planName != "" {
+			update = append(update, "-p", planName)
+		}
+		updates = append(updates, append(update, params.cliArgs()...))
+	}
+	if upgrade {
+		updates = append(updates, []string{"update-service", instanceName, "--upgrade", "--force"})
 	}
 
-	// longer retry backoff due to asynchronous creates
-	backoff := retry.Exponential(time.Second)
-	maxRetries := 10
+	return func() {
+		for _, args := range updates {
+			updateFn := func() *gexec.Session {
+				return helpersCF.Cf(args...)
+			}
 
-	retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
-		retry.MatchesOutput(regexp.MustCompile("create succeeded")),
-		fmt.Sprintf(`{"FailReason": "Failed to create Redis service instance %s"}`, instanceName),
-	)
+			retry.Session(updateFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
+				retry.Succeeds,
+				fmt.Sprintf(`{"FailReason": "Failed to update service %s"}`, instanceName),
+			)
+			cf.asyncWait().awaitOperation(instanceName, fmt.Sprintf("Failed to update service %s", instanceName), cf.lastOperation(instanceName))
+		}
+	}
+}
+
+// GetServiceParameters reads the parameters the broker holds for an instance.
+// supported is set to false, and params left alone, if the broker does not
+// allow fetching them.
+func (cf *CF) GetServiceParameters(instanceName string, params *Parameters, supported *bool) func() {
+	return func() {
+		guid := cf.getServiceInstanceGuid(instanceName)
+
+		path := fmt.Sprintf("/v2/service_instances/%s/parameters", guid)
+		if advertisesV3(cf.curl("/", `{"FailReason": "Failed to read the Cloud Controller root"}`)) {
+			path = fmt.Sprintf("/v3/service_instances/%s/parameters", guid)
+		}
+		contents := cf.curl(path, `{"FailReason": "Failed to retrieve service instance parameters"}`)
+
+		fetched, ok, err := parametersFromResponse(contents)
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprintf(`{"FailReason": "Failed to retrieve service instance parameters: %s"}`, err))
+
+		*supported = ok
+		if ok {
+			*params = fetched
+		}
+	}
 }
 
 // DeleteService is equivalent to `cf delete-service {instanceName} -f`
@@ -488,55 +447,47 @@ func (cf *CF) DeleteService(instanceName string) func() {
 	}
 
 	return func() {
-		retry.Session(deleteFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(deleteFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			fmt.Sprintf(`{"FailReason": "Failed to delete service %s"}`, instanceName),
 		)
 	}
 }
 
+// EnsureServiceInstanceGone waits for an asynchronous delete to finish
 func (cf *CF) EnsureServiceInstanceGone(instanceName string) func() {
-	serviceFn := func() *gexec.Session {
-		return helpersCF.Cf("service", instanceName)
-	}
-
-	// longer retry backoff due to asynchronous deletes
-	backoff := retry.Exponential(time.Second)
-	maxRetries := 10
-
 	return func() {
-		retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
-			retry.MatchesErrorOutput(regexp.MustCompile(fmt.Sprintf("Service instance '?%s'? not found", instanceName))),
-			fmt.Sprintf(`{"FailReason": "Failed to make sure service %s does not exist"}`, instanceName),
-		)
+		cf.asyncWait().awaitGone(instanceName, fmt.Sprintf("Failed to make sure service %s does not exist", instanceName), cf.lastOperation(instanceName))
 	}
 }
 
 func (cf *CF) EnsureAllServiceInstancesGone() func() {
-	serviceFn := func() *gexec.Session {
-		return helpersCF.Cf("services")
-	}
-
-	// longer retry backoff due to asynchronous deletes
-	backoff := retry.Exponential(time.Second)
-	maxRetries := 10
-
 	return func() {
-		retry.Session(serviceFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Until(
-			retry.MatchesOutput(regexp.MustCompile("No services found")),
-			`{"FailReason": "Failed to make sure no service instances exist"}`,
-		)
+		cf.asyncWait().await("all service instances", "Failed to make sure no service instances exist", func(ctx context.Context) error {
+			services, err := cfOutput(ctx, "services")
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(services, "No services found") {
+				return errors.New("service instances remain")
+			}
+			return nil
+		})
 	}
 }
 
-// BindService is equivalent to `cf bind-service {appName} {instanceName}`
-func (cf *CF) BindService(appName, instanceName string) func() {
+func (cf *CF) asyncWait() asyncWait {
+	return asyncWait{timeout: cf.LongTimeout, interval: cf.AsyncPollInterval}
+}
+
+// BindService is equivalent to `cf bind-service {appName} {instanceName} [-c {params}]`
+func (cf *CF) BindService(appName, instanceName string, params Parameters) func() {
 	bindFn := func() *gexec.Session {
-		return helpersCF.Cf("bind-service", appName, instanceName)
+		return helpersCF.Cf(append([]string{"bind-service", appName, instanceName}, params.cliArgs()...)...)
 	}
 
 	return func() {
-		retry.Session(bindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(bindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to bind Redis service instance to test app"}`,
 		)
@@ -555,13 +506,95 @@ func (cf *CF) UnbindService(appName, instanceName string) func() {
 	}
 
 	return func() {
-		retry.Session(unbindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).UntilAny(
+		retry.Session(unbindFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().UntilAny(
 			successfulUnbindConditions,
 			fmt.Sprintf(`{"FailReason": "Failed to unbind %s instance from %s"}`, instanceName, appName),
 		)
 	}
 }
 
+// ShareService is equivalent to `cf share-service {instanceName} -o {org} -s {space}`
+func (cf *CF) ShareService(instanceName, org, space string) func() {
+	shareFn := func() *gexec.Session {
+		return helpersCF.Cf("share-service", instanceName, "-o", org, "-s", space)
+	}
+
+	successfulShareConditions := []retry.Condition{
+		retry.MatchesOutput(regexp.MustCompile("OK")),
+		retry.MatchesOutput(regexp.MustCompile("is already shared")),
+	}
+
+	return func() {
+		retry.Session(shareFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().UntilAny(
+			successfulShareConditions,
+			fmt.Sprintf(`{"FailReason": "Failed to share %s instance with space %s"}`, instanceName, space),
+		)
+	}
+}
+
+// UnshareService is equivalent to `cf unshare-service {instanceName} -o {org} -s {space} -f`.
+// Unsharing deletes the instance's bindings in space.
+func (cf *CF) UnshareService(instanceName, org, space string) func() {
+	unshareFn := func() *gexec.Session {
+		return helpersCF.Cf("unshare-service", instanceName, "-o", org, "-s", space, "-f")
+	}
+
+	successfulUnshareConditions := []retry.Condition{
+		retry.MatchesOutput(regexp.MustCompile("OK")),
+		retry.MatchesOutput(regexp.MustCompile("is not shared")),
+		retry.MatchesErrorOutput(regexp.MustCompile(fmt.Sprintf("Service instance '?%s'? not found", instanceName))),
+	}
+
+	return func() {
+		retry.Session(unshareFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().UntilAny(
+			successfulUnshareConditions,
+			fmt.Sprintf(`{"FailReason": "Failed to unshare %s instance from space %s"}`, instanceName, space),
+		)
+	}
+}
+
+// EnsureServiceUnbound waits for appName to have no binding to instanceName
+func (cf *CF) EnsureServiceUnbound(appName, instanceName string) func() {
+	return func() {
+		path := fmt.Sprintf("/v3/service_credential_bindings?type=app&app_names=%s&service_instance_names=%s", appName, instanceName)
+		cf.asyncWait().await(appName, fmt.Sprintf("Failed to make sure %s is not bound to %s", appName, instanceName), func(ctx context.Context) error {
+			contents, err := cfOutput(ctx, "curl", path)
+			if err != nil {
+				return err
+			}
+
+			count, err := bindingCount([]byte(contents))
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			if count > 0 {
+				return fmt.Errorf("%d bindings remain", count)
+			}
+			return nil
+		})
+	}
+}
+
+// bindingCount reads the number of bindings from a v3 list response.
+func bindingCount(contents []byte) (int, error) {
+	var bindings struct {
+		Pagination struct {
+			TotalResults int `json:"total_results"`
+		} `json:"pagination"`
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(contents, &bindings); err != nil {
+		return 0, fmt.Errorf("failed to decode service bindings: %w", err)
+	}
+	if len(bindings.Errors) > 0 {
+		return 0, fmt.Errorf("%s: %s", bindings.Errors[0].Title, bindings.Errors[0].Detail)
+	}
+	return bindings.Pagination.TotalResults, nil
+}
+
 // Start is equivalent to `cf start {appName}`
 func (cf *CF) Start(appName string) func() {
 	startFn := func() *gexec.Session {
@@ -569,7 +602,7 @@ func (cf *CF) Start(appName string) func() {
 	}
 
 	return func() {
-		retry.Session(startFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(startFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to start test app"}`,
 		)
@@ -583,7 +616,7 @@ func (cf *CF) SetEnv(appName, environmentVariable, instanceName string) func() {
 	}
 
 	return func() {
-		retry.Session(setEnvFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(setEnvFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to set environment variable for test app"}`,
 		)
@@ -596,7 +629,7 @@ func (cf *CF) Restage(appName string) func() {
 		return helpersCF.Cf("restage", appName)
 	}
 	return func() {
-		retry.Session(restageFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(restageFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to restage the test app"}`,
 		)
@@ -610,27 +643,29 @@ func (cf *CF) Logout() func() {
 	}
 
 	return func() {
-		retry.Session(logoutFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(logoutFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to logout"}`,
 		)
 	}
 }
 
-func (cf CF) GetServiceKey(serviceInstanceName string, credentials *Credentials) func() {
+// GetServiceKey reads the credentials of the named service key
+func (cf CF) GetServiceKey(serviceInstanceName, serviceKeyName string, credentials *Credentials) func() {
 	return func() {
 		serviceGUID := cf.getServiceInstanceGuid(serviceInstanceName)
-		*credentials = cf.getServiceKeyCredentials(serviceGUID)
+		*credentials = cf.getServiceKeyCredentials(serviceGUID, serviceKeyName)
 	}
 }
 
-func (cf CF) CreateServiceKey(serviceInstanceName, serviceKeyName string) func() {
+// CreateServiceKey is equivalent to `cf create-service-key {serviceInstanceName} {serviceKeyName} [-c {params}]`
+func (cf CF) CreateServiceKey(serviceInstanceName, serviceKeyName string, params Parameters) func() {
 	serviceKeyFn := func() *gexec.Session {
-		return helpersCF.Cf("create-service-key", serviceInstanceName, serviceKeyName)
+		return helpersCF.Cf(append([]string{"create-service-key", serviceInstanceName, serviceKeyName}, params.cliArgs()...)...)
 	}
 
 	return func() {
-		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to create service key for Redis service instance"}`,
 		)
@@ -643,7 +678,7 @@ func (cf CF) DeleteServiceKey(serviceInstanceName, serviceKeyName string) func()
 	}
 
 	return func() {
-		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).Until(
+		retry.Session(serviceKeyFn).WithSessionTimeout(cf.ShortTimeout).AndMaxRetries(cf.MaxRetries).AndBackoff(cf.RetryBackoff).FailFast().Until(
 			retry.Succeeds,
 			`{"FailReason": "Failed to delete service key for Redis service instance"}`,
 		)
@@ -657,40 +692,8 @@ func (cf *CF) getServiceInstanceGuid(serviceName string) string {
 	return strings.Trim(string(session.Out.Contents()), " \n")
 }
 
-func (cf *CF) getServiceKeyCredentials(serviceGuid string) Credentials {
-	session := helpersCF.Cf("curl", fmt.Sprintf("/v2/service_keys?q=service_instance_guid:%s", serviceGuid))
-	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), `{"FailReason": "Failed to retrieve service bindings for app"}`)
-
-	var resp = new(struct {
-		Resources []struct {
-			Entity struct {
-				Credentials Credentials
-			}
-		}
-	})
-
-	err := json.NewDecoder(bytes.NewBuffer(session.Out.Contents())).Decode(resp)
-	Expect(err).NotTo(HaveOccurred(), `{"FailReason": "Failed to decode service key response"}`)
-	Expect(resp.Resources).To(HaveLen(1), `{"FailReason": "Invalid service key response, expected exactly one service key"}`)
-
-	host, port := resp.Resources[0].Entity.Credentials.Host, resp.Resources[0].Entity.Credentials.Port
-	tlsPort := resp.Resources[0].Entity.Credentials.TLS_Port
-	sentinels := resp.Resources[0].Entity.Credentials.Sentinels
-
-	if len(sentinels) == 0 {
-		Expect(host).NotTo(BeEmpty(), `{"FailReason": "Invalid service key, missing host"}`)
-		if tlsPort == 0 {
-			Expect(port).NotTo(BeZero(), `{"FailReason": "Invalid service key, missing port"}`)
-		}
-	} else {
-		Expect(sentinels).To(HaveLen(3))
-		for _, sentinel := range sentinels {
-			Expect(sentinel.Host).NotTo(BeEmpty(), `{"FailReason": "Invalid service key, missing sentinel host"}`)
-			if sentinel.TLSPort == 0 {
-				Expect(sentinel.Port).NotTo(BeZero(), `{"FailReason": "Invalid service key, missing sentinel port"}`)
-			}
-		}
-	}
-
-	return resp.Resources[0].Entity.Credentials
+// validateCredentials fails the spec unless creds name a reachable instance.
+func validateCredentials(creds Credentials) {
+	err := creds.Validate()
+	Expect(err).NotTo(HaveOccurred(), fmt.Sprintf(`{"FailReason": "Invalid service key, %s"}`, err))
 }
@@ -0,0 +1,13 @@
+package cf
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCF(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CF Suite")
+}
@@ -0,0 +1,171 @@
+package fake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// App is a fake of the example app for an app pushed to a Platform. It reads
+// and writes the data of the service instance the app is bound to.
+type App struct {
+	platform *Platform
+	name     string
+}
+
+// App returns the fake example app for appName.
+func (p *Platform) App(appName string) *App {
+	return &App{platform: p, name: appName}
+}
+
+func (a *App) IsRunning() func() {
+	return a.task("Test app is not running", func(p *Platform) error {
+		app, err := p.app(a.name)
+		if err != nil {
+			return err
+		}
+		if !app.running {
+			return fmt.Errorf("app %s is stopped", a.name)
+		}
+		return nil
+	})
+}
+
+func (a *App) Write(key, value string) func() {
+	return a.task("Failed to write to test app", func(p *Platform) error {
+		instance, err := a.boundInstance(p)
+		if err != nil {
+			return err
+		}
+		instance.Data[key] = value
+		return nil
+	})
+}
+
+func (a *App) ReadAssert(key, expectedValue string) func() {
+	return a.task("Failed to read from test app", func(p *Platform) error {
+		instance, err := a.boundInstance(p)
+		if err != nil {
+			return err
+		}
+		return expect(instance.Data[key], expectedValue)
+	})
+}
+
+// ReadTLSAssert reads over TLS. Versions missing from the plan's credentials
+// answer "protocol not supported", as the example app does.
+func (a *App) ReadTLSAssert(tlsVersion, key, expectedValue string) func() {
+	return a.task("Failed to read from test app over TLS", func(p *Platform) error {
+		instance, err := a.boundInstance(p)
+		if err != nil {
+			return err
+		}
+
+		actual := "protocol not supported"
+		if p.Plans[instance.Plan].Credentials.HasTLSVersion(tlsVersion) {
+			actual = instance.Data[key]
+		}
+		return expect(actual, expectedValue)
+	})
+}
+
+func (a *App) CheckList(key string, values ...string) func() {
+	return a.dataTypeTask("RPUSH", key, strings.Join(values, ","))
+}
+
+func (a *App) CheckHash(key string, fields map[string]string) func() {
+	var pairs []string
+	for field, value := range fields {
+		pairs = append(pairs, field+":"+value)
+	}
+	sort.Strings(pairs)
+	return a.dataTypeTask("HSET", key, strings.Join(pairs, ","))
+}
+
+func (a *App) CheckSet(key string, members ...string) func() {
+	return a.dataTypeTask("SADD", key, strings.Join(members, ","))
+}
+
+func (a *App) CheckSortedSet(key string, scores map[string]float64) func() {
+	var pairs []string
+	for member, score := range scores {
+		pairs = append(pairs, fmt.Sprintf("%s:%g", member, score))
+	}
+	sort.Strings(pairs)
+	return a.dataTypeTask("ZADD", key, strings.Join(pairs, ","))
+}
+
+func (a *App) CheckStream(key, group, consumer string, values ...string) func() {
+	return a.dataTypeTask("XREADGROUP", key, strings.Join(values, ","))
+}
+
+// CheckExpiry leaves the key unset, as it would be once expired.
+func (a *App) CheckExpiry(key, value string, ttl time.Duration) func() {
+	return a.dataTypeTask("EXPIRE", key, "")
+}
+
+func (a *App) CheckIncr(key string, concurrency int) func() {
+	return a.dataTypeTask("INCR", key, fmt.Sprint(concurrency))
+}
+
+// dataTypeTask stores a summary of what a data type check wrote under key.
+// It fails as Redis would if the plan disables command.
+func (a *App) dataTypeTask(command, key, summary string) func() {
+	return a.task("Failed to check a data type through the test app", func(p *Platform) error {
+		instance, err := a.boundInstance(p)
+		if err != nil {
+			return err
+		}
+		for _, disabled := range p.Plans[instance.Plan].DisabledCommands {
+			if disabled == command {
+				return fmt.Errorf("ERR unknown command '%s'", command)
+			}
+		}
+
+		if summary == "" {
+			delete(instance.Data, key)
+		} else {
+			instance.Data[key] = summary
+		}
+		return nil
+	})
+}
+
+func (a *App) boundInstance(p *Platform) (*Instance, error) {
+	app, err := p.app(a.name)
+	if err != nil {
+		return nil, err
+	}
+	if !app.running {
+		return nil, fmt.Errorf("app %s is stopped", a.name)
+	}
+
+	for _, instance := range p.instances {
+		for _, bound := range instance.BoundApps {
+			if bound == a.name {
+				return instance, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("app %s is not bound to a service instance", a.name)
+}
+
+func (a *App) task(failReason string, op func(p *Platform) error) func() {
+	return func() {
+		a.platform.lock.Lock()
+		err := op(a.platform)
+		a.platform.lock.Unlock()
+
+		if err != nil {
+			a.platform.FailHandler(fmt.Sprintf(`{"FailReason": "%s: %s"}`, failReason, err), 1)
+		}
+	}
+}
+
+func expect(actual, expected string) error {
+	if actual != expected {
+		return fmt.Errorf("expected %q, got %q", expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,865 @@
+// Package fake is an in-memory cf.Platform for testing smoke test flows
+// without a Cloud Foundry. It simulates orgs, spaces, apps, service instances
+// with asynchronous last operations, service keys, plan quotas and injected
+// failures.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/onsi/ginkgo/v2"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+)
+
+// Plan describes how the fake broker behaves for one service plan.
+type Plan struct {
+	// Credentials are returned for every service key of the plan's instances.
+	Credentials cf.Credentials
+	// Exhausted makes CreateService report that the plan's instance quota is
+	// reached, which skips the spec.
+	Exhausted bool
+	// ProvisionPolls is how many times the create operation is seen in
+	// progress before it finishes.
+	ProvisionPolls int
+	// ProvisionError makes the create operation fail with this broker
+	// description.
+	ProvisionError string
+	// DeprovisionError makes the delete operation fail with this broker
+	// description, leaving the instance behind.
+	DeprovisionError string
+	// UpdatePolls and UpdateError do for updates to the plan, and upgrades
+	// of its instances, what ProvisionPolls and ProvisionError do for creates.
+	UpdatePolls int
+	UpdateError string
+	// MaintenanceVersion is the plan's current maintenance_info version.
+	// Instances created at an older version can be upgraded.
+	MaintenanceVersion string
+	// ParametersNotRetrievable makes GetServiceParameters report that the
+	// broker does not support fetching instance parameters.
+	ParametersNotRetrievable bool
+	// DisabledCommands are the Redis commands the plan's instances have
+	// renamed or disabled, e.g. "XREADGROUP" when streams are unavailable.
+	DisabledCommands []string
+}
+
+// Instance is a simulated service instance.
+type Instance struct {
+	Service       string
+	Plan          string
+	Space         string
+	LastOperation cf.LastOperation
+	Keys          map[string]cf.Credentials
+	BoundApps     []string
+	// SharedSpaces are the spaces, as org/space, the instance is shared with.
+	SharedSpaces []string
+	// Polls counts how often the last operation was checked.
+	Polls int
+	// MaintenanceVersion is the plan version the instance was last
+	// created, updated or upgraded at.
+	MaintenanceVersion string
+	// Data is what apps bound to the instance have written.
+	Data map[string]string
+	// Parameters are those the instance was created with, overlaid with
+	// those of later updates.
+	Parameters cf.Parameters
+	// KeyParameters and BindingParameters are the parameters each service
+	// key and app binding was created with, by key and app name.
+	KeyParameters     map[string]cf.Parameters
+	BindingParameters map[string]cf.Parameters
+}
+
+// Call is an operation the fake was asked to perform.
+type Call struct {
+	Operation string
+	Args      []string
+}
+
+func (c Call) String() string {
+	return strings.TrimSpace(c.Operation + " " + strings.Join(c.Args, " "))
+}
+
+type app struct {
+	space     string
+	running   bool
+	restages  int
+	env       map[string]string
+	buildpack string
+}
+
+// Platform is an in-memory cf.Platform. The zero value is not usable; call
+// New. It is safe for concurrent use.
+type Platform struct {
+	// FailHandler is called with a {"FailReason": ...} message when an
+	// operation fails. It defaults to ginkgo.Fail.
+	FailHandler func(message string, callerSkip ...int)
+	// Plans configures the fake broker, keyed by plan name. Plans that are
+	// not listed do not exist.
+	Plans map[string]Plan
+
+	lock           sync.Mutex
+	calls          []Call
+	failures       map[string]string
+	api            string
+	user           string
+	quotas         map[string]bool
+	orgs           map[string]map[string]bool
+	org            string
+	space          string
+	users          map[string]string
+	roles          map[string]bool
+	planAccess     map[string]bool
+	securityGroups map[string][]string
+	apps           map[string]*app
+	instances      map[string]*Instance
+}
+
+var _ cf.Platform = &Platform{}
+
+func New() *Platform {
+	return &Platform{
+		FailHandler:    ginkgo.Fail,
+		Plans:          map[string]Plan{},
+		failures:       map[string]string{},
+		quotas:         map[string]bool{},
+		orgs:           map[string]map[string]bool{},
+		users:          map[string]string{},
+		roles:          map[string]bool{},
+		planAccess:     map[string]bool{},
+		securityGroups: map[string][]string{},
+		apps:           map[string]*app{},
+		instances:      map[string]*Instance{},
+	}
+}
+
+// FailOn makes every later call to operation, e.g. "BindService", fail with
+// reason until Recover is called.
+func (p *Platform) FailOn(operation, reason string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.failures[operation] = reason
+}
+
+// Recover undoes FailOn.
+func (p *Platform) Recover(operation string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.failures, operation)
+}
+
+// Calls lists the operations performed so far, in order.
+func (p *Platform) Calls() []Call {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return append([]Call(nil), p.calls...)
+}
+
+// Operations lists the names of the operations performed so far, in order.
+func (p *Platform) Operations() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	operations := make([]string, len(p.calls))
+	for i, call := range p.calls {
+		operations[i] = call.Operation
+	}
+	return operations
+}
+
+// Instance returns a copy of the named service instance.
+func (p *Platform) Instance(name string) (Instance, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	instance, ok := p.instances[name]
+	if !ok {
+		return Instance{}, false
+	}
+	return *instance, true
+}
+
+// Instances lists the names of the service instances that exist.
+func (p *Platform) Instances() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	names := make([]string, 0, len(p.instances))
+	for name := range p.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apps lists the names of the apps that exist.
+func (p *Platform) Apps() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	names := make([]string, 0, len(p.apps))
+	for name := range p.apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Env returns an app's environment variable.
+func (p *Platform) Env(appName, name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if a, ok := p.apps[appName]; ok {
+		return a.env[name]
+	}
+	return ""
+}
+
+// SecurityGroup returns the spaces a security group is bound to, as org/space.
+func (p *Platform) SecurityGroup(name string) ([]string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	spaces, ok := p.securityGroups[name]
+	return append([]string(nil), spaces...), ok
+}
+
+func (p *Platform) API(endpoint string, skipSSLValidation bool) func() {
+	return p.task("API", []string{endpoint}, "Failed to target Cloud Foundry", func() error {
+		p.api = endpoint
+		return nil
+	})
+}
+
+func (p *Platform) Auth(user, password string) func() {
+	return p.task("Auth", []string{user}, "Failed to `cf auth` with target Cloud Foundry", func() error {
+		if p.api == "" {
+			return fmt.Errorf("no API endpoint set")
+		}
+		if known, ok := p.users[user]; ok && known != password {
+			return fmt.Errorf("credentials were rejected")
+		}
+		p.user = user
+		return nil
+	})
+}
+
+func (p *Platform) AuthClient(client, clientSecret string) func() {
+	return p.task("AuthClient", []string{client}, "Failed to `cf auth` with target Cloud Foundry", func() error {
+		if p.api == "" {
+			return fmt.Errorf("no API endpoint set")
+		}
+		p.user = client
+		return nil
+	})
+}
+
+func (p *Platform) Logout() func() {
+	return p.task("Logout", nil, "Failed to logout", func() error {
+		p.user, p.org, p.space = "", "", ""
+		return nil
+	})
+}
+
+func (p *Platform) CreateQuota(name string, args ...string) func() {
+	return p.loggedIn("CreateQuota", append([]string{name}, args...), "Failed to `cf create-quota` with target Cloud Foundry", func() error {
+		p.quotas[name] = true
+		return nil
+	})
+}
+
+func (p *Platform) CreateOrg(org, quota string) func() {
+	return p.loggedIn("CreateOrg", []string{org, quota}, "Failed to create org", func() error {
+		if !p.quotas[quota] {
+			return fmt.Errorf("quota %s not found", quota)
+		}
+		if _, ok := p.orgs[org]; !ok {
+			p.orgs[org] = map[string]bool{}
+		}
+		return nil
+	})
+}
+
+func (p *Platform) DeleteOrg(name string) func() {
+	return p.loggedIn("DeleteOrg", []string{name}, "Failed to delete org", func() error {
+		delete(p.orgs, name)
+		if p.org == name {
+			p.org, p.space = "", ""
+		}
+		return nil
+	})
+}
+
+func (p *Platform) CreateSpace(space string) func() {
+	return p.loggedIn("CreateSpace", []string{space}, "Failed to create CF test space", func() error {
+		if p.org == "" {
+			return fmt.Errorf("no org targeted")
+		}
+		p.orgs[p.org][space] = true
+		return nil
+	})
+}
+
+func (p *Platform) TargetOrg(org string) func() {
+	return p.loggedIn("TargetOrg", []string{org}, "Failed to target test org", func() error {
+		if _, ok := p.orgs[org]; !ok {
+			return fmt.Errorf("org %s not found", org)
+		}
+		p.org, p.space = org, ""
+		return nil
+	})
+}
+
+func (p *Platform) TargetOrgAndSpace(org, space string) func() {
+	return p.loggedIn("TargetOrgAndSpace", []string{org, space}, "Failed to target test org", func() error {
+		if _, ok := p.orgs[org]; !ok {
+			p.orgs[org] = map[string]bool{}
+		}
+		p.orgs[org][space] = true
+		p.org, p.space = org, space
+		return nil
+	})
+}
+
+func (p *Platform) CreateUser(name, password string) func() {
+	return p.loggedIn("CreateUser", []string{name}, "Failed to create user", func() error {
+		p.users[name] = password
+		return nil
+	})
+}
+
+func (p *Platform) DeleteUser(name string) func() {
+	return p.loggedIn("DeleteUser", []string{name}, "Failed to delete user", func() error {
+		delete(p.users, name)
+		return nil
+	})
+}
+
+func (p *Platform) SetSpaceRole(name, org, space, role string) func() {
+	return p.loggedIn("SetSpaceRole", []string{name, org, space, role}, "Failed to set space role", func() error {
+		if _, ok := p.users[name]; !ok {
+			return fmt.Errorf("user %s not found", name)
+		}
+		if !p.orgs[org][space] {
+			return fmt.Errorf("space %s not found in org %s", space, org)
+		}
+		p.roles[strings.Join([]string{name, org, space, role}, "/")] = true
+		return nil
+	})
+}
+
+func (p *Platform) EnableServiceAccess(org, service string) func() {
+	return p.loggedIn("EnableServiceAccess", []string{org, service}, "Failed to enable service access for CF test org", func() error {
+		for plan := range p.Plans {
+			p.planAccess[org+"/"+plan] = true
+		}
+		return nil
+	})
+}
+
+func (p *Platform) EnableServiceAccessForPlan(org, service, plan string) func() {
+	return p.loggedIn("EnableServiceAccessForPlan", []string{org, service, plan}, "Failed to enable service access for CF test org", func() error {
+		if _, ok := p.Plans[plan]; !ok {
+			return fmt.Errorf("service plan %s not found", plan)
+		}
+		p.planAccess[org+"/"+plan] = true
+		return nil
+	})
+}
+
+func (p *Platform) CreateAndBindSecurityGroup(securityGroup, serviceName, serviceKeyName, org, space string) func() {
+	return p.loggedIn("CreateAndBindSecurityGroup", []string{securityGroup, serviceName, serviceKeyName, org, space}, "Failed to bind security group to space", func() error {
+		instance, err := p.instance(serviceName)
+		if err != nil {
+			return err
+		}
+		if _, ok := instance.Keys[serviceKeyName]; !ok {
+			return fmt.Errorf("service key %s not found", serviceKeyName)
+		}
+		if !p.orgs[org][space] {
+			return fmt.Errorf("space %s not found in org %s", space, org)
+		}
+		p.securityGroups[securityGroup] = append(p.securityGroups[securityGroup], org+"/"+space)
+		return nil
+	})
+}
+
+func (p *Platform) DeleteSecurityGroup(securityGroup string) func() {
+	return p.loggedIn("DeleteSecurityGroup", []string{securityGroup}, "Failed to delete security group", func() error {
+		delete(p.securityGroups, securityGroup)
+		return nil
+	})
+}
+
+func (p *Platform) Push(appName string, args ...string) func() {
+	return p.targeted("Push", append([]string{appName}, args...), "Failed to `cf push` test app", func() error {
+		a, ok := p.apps[appName]
+		if !ok {
+			a = &app{space: p.org + "/" + p.space, env: map[string]string{}}
+			p.apps[appName] = a
+		}
+
+		a.running = true
+		for i, arg := range args {
+			switch {
+			case arg == "--no-start":
+				a.running = false
+			case arg == "-b" && i+1 < len(args):
+				a.buildpack = args[i+1]
+			}
+		}
+		return nil
+	})
+}
+
+func (p *Platform) Delete(appName string) func() {
+	return p.targeted("Delete", []string{appName}, "Failed to `cf delete` test app", func() error {
+		delete(p.apps, appName)
+		return nil
+	})
+}
+
+func (p *Platform) Start(appName string) func() {
+	return p.targeted("Start", []string{appName}, "Failed to start test app", func() error {
+		a, err := p.app(appName)
+		if err != nil {
+			return err
+		}
+		a.running = true
+		return nil
+	})
+}
+
+func (p *Platform) SetEnv(appName, environmentVariable, instanceName string) func() {
+	return p.targeted("SetEnv", []string{appName, environmentVariable, instanceName}, "Failed to set environment variable for test app", func() error {
+		a, err := p.app(appName)
+		if err != nil {
+			return err
+		}
+		a.env[environmentVariable] = instanceName
+		return nil
+	})
+}
+
+func (p *Platform) Restage(appName string) func() {
+	return p.targeted("Restage", []string{appName}, "Failed to restage the test app", func() error {
+		a, err := p.app(appName)
+		if err != nil {
+			return err
+		}
+		a.restages++
+		a.running = true
+		return nil
+	})
+}
+
+// CreateService provisions an instance and polls its last operation until it
+// is no longer in progress, as the real backends do.
+func (p *Platform) CreateService(serviceName, planName, instanceName string, params cf.Parameters, skip *bool) func() {
+	return p.targeted("CreateService", withParameters([]string{serviceName, planName, instanceName}, params), "Failed to create Redis service instance", func() error {
+		plan, ok := p.Plans[planName]
+		if !ok {
+			return fmt.Errorf("service plan %s not found", planName)
+		}
+		if !p.planAccess[p.org+"/"+planName] {
+			return fmt.Errorf("service plan %s is not available to org %s", planName, p.org)
+		}
+		if plan.Exhausted {
+			fmt.Printf("No Plan Instances available for testing %s plan\n", planName)
+			*skip = true
+			return nil
+		}
+
+		if instance, exists := p.instances[instanceName]; exists {
+			if instance.LastOperation.State == cf.OperationFailed {
+				return fmt.Errorf("%s", instance.LastOperation)
+			}
+			return nil
+		}
+
+		instance := &Instance{
+			Service:            serviceName,
+			Plan:               planName,
+			Space:              p.org + "/" + p.space,
+			MaintenanceVersion: plan.MaintenanceVersion,
+			Keys:               map[string]cf.Credentials{},
+			Data:               map[string]string{},
+			Parameters:         cf.Parameters{},
+			KeyParameters:      map[string]cf.Parameters{},
+			BindingParameters:  map[string]cf.Parameters{},
+		}
+		for name, value := range params {
+			instance.Parameters[name] = value
+		}
+		p.instances[instanceName] = instance
+
+		return runOperation(instance, "create", plan.ProvisionPolls, plan.ProvisionError)
+	})
+}
+
+// UpdateService moves an instance to planName and merges params into its
+// parameters, if either is given, and then upgrades it to its plan's
+// MaintenanceVersion if upgrade is set, waiting for each.
+func (p *Platform) UpdateService(instanceName, planName string, params cf.Parameters, upgrade bool) func() {
+	return p.targeted("UpdateService", withParameters([]string{instanceName, planName, strconv.FormatBool(upgrade)}, params), fmt.Sprintf("Failed to update service %s", instanceName), func() error {
+		instance, err := p.instance(instanceName)
+		if err != nil {
+			return err
+		}
+
+		if planName != "" || len(params) > 0 {
+			if planName != "" {
+				plan, ok := p.Plans[planName]
+				if !ok {
+					return fmt.Errorf("service plan %s not found", planName)
+				}
+				if !p.planAccess[p.org+"/"+planName] {
+					return fmt.Errorf("service plan %s is not available to org %s", planName, p.org)
+				}
+
+				instance.Plan = planName
+				instance.MaintenanceVersion = plan.MaintenanceVersion
+			}
+			for name, value := range params {
+				instance.Parameters[name] = value
+			}
+
+			plan := p.Plans[instance.Plan]
+			if err := runOperation(instance, "update", plan.UpdatePolls, plan.UpdateError); err != nil {
+				return err
+			}
+		}
+
+		plan := p.Plans[instance.Plan]
+		if upgrade && instance.MaintenanceVersion != plan.MaintenanceVersion {
+			instance.MaintenanceVersion = plan.MaintenanceVersion
+			return runOperation(instance, "update", plan.UpdatePolls, plan.UpdateError)
+		}
+		return nil
+	})
+}
+
+// runOperation starts an asynchronous operation on instance and polls it
+// until it finishes, which happens after polls checks.
+func runOperation(instance *Instance, operationType string, polls int, failure string) error {
+	instance.LastOperation = cf.LastOperation{Type: operationType, State: cf.OperationInProgress}
+
+	for i := 0; instance.LastOperation.State == cf.OperationInProgress; i++ {
+		instance.Polls++
+		if i < polls {
+			continue
+		}
+
+		instance.LastOperation.State = cf.OperationSucceeded
+		if failure != "" {
+			instance.LastOperation.State = cf.OperationFailed
+			instance.LastOperation.Description = failure
+		}
+	}
+
+	if instance.LastOperation.State == cf.OperationFailed {
+		return fmt.Errorf("%s", instance.LastOperation)
+	}
+	return nil
+}
+
+// GetServiceParameters returns the instance's parameters, unless its plan
+// is ParametersNotRetrievable.
+func (p *Platform) GetServiceParameters(instanceName string, params *cf.Parameters, supported *bool) func() {
+	return p.targeted("GetServiceParameters", []string{instanceName}, "Failed to retrieve service instance parameters", func() error {
+		instance, err := p.instance(instanceName)
+		if err != nil {
+			return err
+		}
+
+		*supported = !p.Plans[instance.Plan].ParametersNotRetrievable
+		if *supported {
+			*params = cf.Parameters{}
+			for name, value := range instance.Parameters {
+				(*params)[name] = value
+			}
+		}
+		return nil
+	})
+}
+
+func (p *Platform) DeleteService(instanceName string) func() {
+	return p.targeted("DeleteService", []string{instanceName}, fmt.Sprintf("Failed to delete service %s", instanceName), func() error {
+		instance, ok := p.instances[instanceName]
+		if !ok {
+			return nil
+		}
+		if len(instance.Keys) > 0 || len(instance.BoundApps) > 0 {
+			return fmt.Errorf("service instance %s has bindings or keys", instanceName)
+		}
+
+		if description := p.Plans[instance.Plan].DeprovisionError; description != "" {
+			instance.LastOperation = cf.LastOperation{Type: "delete", State: cf.OperationFailed, Description: description}
+			return nil
+		}
+
+		delete(p.instances, instanceName)
+		return nil
+	})
+}
+
+func (p *Platform) EnsureServiceInstanceGone(instanceName string) func() {
+	return p.targeted("EnsureServiceInstanceGone", []string{instanceName}, fmt.Sprintf("Failed to make sure service %s does not exist", instanceName), func() error {
+		instance, ok := p.instances[instanceName]
+		if !ok {
+			return nil
+		}
+		return fmt.Errorf("service instance %s still exists: %s %s", instanceName, instance.LastOperation.Type, instance.LastOperation.State)
+	})
+}
+
+func (p *Platform) EnsureAllServiceInstancesGone() func() {
+	return p.targeted("EnsureAllServiceInstancesGone", nil, "Failed to make sure no service instances exist", func() error {
+		for name, instance := range p.instances {
+			if instance.Space == p.org+"/"+p.space {
+				return fmt.Errorf("service instance %s still exists", name)
+			}
+		}
+		return nil
+	})
+}
+
+func (p *Platform) BindService(appName, instanceName string, params cf.Parameters) func() {
+	return p.targeted("BindService", withParameters([]string{appName, instanceName}, params), "Failed to bind Redis service instance to test app", func() error {
+		a, err := p.app(appName)
+		if err != nil {
+			return err
+		}
+		instance, err := p.instance(instanceName)
+		if err != nil {
+			return err
+		}
+		if a.space != instance.Space && !contains(instance.SharedSpaces, a.space) {
+			return fmt.Errorf("service instance %s is not available in space %s", instanceName, a.space)
+		}
+
+		if contains(instance.BoundApps, appName) {
+			return nil
+		}
+		instance.BoundApps = append(instance.BoundApps, appName)
+		instance.BindingParameters[appName] = params
+		return nil
+	})
+}
+
+func (p *Platform) UnbindService(appName, instanceName string) func() {
+	return p.targeted("UnbindService", []string{appName, instanceName}, fmt.Sprintf("Failed to unbind %s instance from %s", instanceName, appName), func() error {
+		instance, ok := p.instances[instanceName]
+		if !ok {
+			return nil
+		}
+
+		remaining := instance.BoundApps[:0]
+		for _, bound := range instance.BoundApps {
+			if bound != appName {
+				remaining = append(remaining, bound)
+			}
+		}
+		instance.BoundApps = remaining
+		delete(instance.BindingParameters, appName)
+		return nil
+	})
+}
+
+func (p *Platform) EnsureServiceUnbound(appName, instanceName string) func() {
+	return p.loggedIn("EnsureServiceUnbound", []string{appName, instanceName}, fmt.Sprintf("Failed to make sure %s is not bound to %s", appName, instanceName), func() error {
+		instance, ok := p.instances[instanceName]
+		if ok && contains(instance.BoundApps, appName) {
+			return fmt.Errorf("app %s is still bound", appName)
+		}
+		return nil
+	})
+}
+
+func (p *Platform) ShareService(instanceName, org, space string) func() {
+	return p.targeted("ShareService", []string{instanceName, org, space}, fmt.Sprintf("Failed to share %s instance with space %s", instanceName, space), func() error {
+		instance, err := p.owned(instanceName)
+		if err != nil {
+			return err
+		}
+		if !p.orgs[org][space] {
+			return fmt.Errorf("space %s not found in org %s", space, org)
+		}
+
+		if !contains(instance.SharedSpaces, org+"/"+space) {
+			instance.SharedSpaces = append(instance.SharedSpaces, org+"/"+space)
+		}
+		return nil
+	})
+}
+
+// UnshareService stops sharing an instance with a space, deleting the
+// bindings of the space's apps.
+func (p *Platform) UnshareService(instanceName, org, space string) func() {
+	return p.targeted("UnshareService", []string{instanceName, org, space}, fmt.Sprintf("Failed to unshare %s instance from space %s", instanceName, space), func() error {
+		if _, ok := p.instances[instanceName]; !ok {
+			return nil
+		}
+		instance, err := p.owned(instanceName)
+		if err != nil {
+			return err
+		}
+
+		remainingSpaces := instance.SharedSpaces[:0]
+		for _, shared := range instance.SharedSpaces {
+			if shared != org+"/"+space {
+				remainingSpaces = append(remainingSpaces, shared)
+			}
+		}
+		instance.SharedSpaces = remainingSpaces
+
+		remainingApps := instance.BoundApps[:0]
+		for _, bound := range instance.BoundApps {
+			if a, ok := p.apps[bound]; ok && a.space == org+"/"+space {
+				delete(instance.BindingParameters, bound)
+				continue
+			}
+			remainingApps = append(remainingApps, bound)
+		}
+		instance.BoundApps = remainingApps
+		return nil
+	})
+}
+
+func (p *Platform) CreateServiceKey(serviceInstanceName, serviceKeyName string, params cf.Parameters) func() {
+	return p.targeted("CreateServiceKey", withParameters([]string{serviceInstanceName, serviceKeyName}, params), "Failed to create service key for Redis service instance", func() error {
+		instance, err := p.instance(serviceInstanceName)
+		if err != nil {
+			return err
+		}
+		instance.Keys[serviceKeyName] = p.Plans[instance.Plan].Credentials
+		instance.KeyParameters[serviceKeyName] = params
+		return nil
+	})
+}
+
+func (p *Platform) GetServiceKey(serviceInstanceName, serviceKeyName string, credentials *cf.Credentials) func() {
+	return p.targeted("GetServiceKey", []string{serviceInstanceName, serviceKeyName}, "Failed to retrieve service bindings for app", func() error {
+		instance, err := p.instance(serviceInstanceName)
+		if err != nil {
+			return err
+		}
+
+		key, ok := instance.Keys[serviceKeyName]
+		if !ok {
+			return fmt.Errorf("service key %s not found", serviceKeyName)
+		}
+		*credentials = key
+		return nil
+	})
+}
+
+func (p *Platform) DeleteServiceKey(serviceInstanceName, serviceKeyName string) func() {
+	return p.targeted("DeleteServiceKey", []string{serviceInstanceName, serviceKeyName}, "Failed to delete service key for Redis service instance", func() error {
+		if instance, ok := p.instances[serviceInstanceName]; ok {
+			delete(instance.Keys, serviceKeyName)
+			delete(instance.KeyParameters, serviceKeyName)
+		}
+		return nil
+	})
+}
+
+// withParameters appends params to a call's args the way the cli takes them,
+// if there are any.
+func withParameters(args []string, params cf.Parameters) []string {
+	if len(params) == 0 {
+		return args
+	}
+
+	encoded, _ := json.Marshal(params)
+	return append(args, "-c", string(encoded))
+}
+
+// instance returns a service instance that finished being created.
+func (p *Platform) instance(name string) (*Instance, error) {
+	instance, ok := p.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("service instance %s not found", name)
+	}
+	if instance.LastOperation.Type == "create" && instance.LastOperation.State != cf.OperationSucceeded {
+		return nil, fmt.Errorf("service instance %s is not ready: create %s", name, instance.LastOperation.State)
+	}
+	return instance, nil
+}
+
+// owned returns a service instance that is in the targeted space, rather
+// than shared with it.
+func (p *Platform) owned(name string) (*Instance, error) {
+	instance, err := p.instance(name)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Space != p.org+"/"+p.space {
+		return nil, fmt.Errorf("service instance %s is not in space %s", name, p.org+"/"+p.space)
+	}
+	return instance, nil
+}
+
+func (p *Platform) app(name string) (*app, error) {
+	a, ok := p.apps[name]
+	if !ok {
+		return nil, fmt.Errorf("app %s not found", name)
+	}
+	return a, nil
+}
+
+func (p *Platform) targeted(operation string, args []string, failReason string, op func() error) func() {
+	return p.loggedIn(operation, args, failReason, func() error {
+		if p.space == "" {
+			return fmt.Errorf("no space targeted")
+		}
+		return op()
+	})
+}
+
+func (p *Platform) loggedIn(operation string, args []string, failReason string, op func() error) func() {
+	return p.task(operation, args, failReason, func() error {
+		if p.user == "" {
+			return fmt.Errorf("not logged in")
+		}
+		return op()
+	})
+}
+
+// task records the call and runs op under the lock, reporting a failure the
+// way the real backends do.
+func (p *Platform) task(operation string, args []string, failReason string, op func() error) func() {
+	return func() {
+		p.lock.Lock()
+		p.calls = append(p.calls, Call{Operation: operation, Args: args})
+
+		var err error
+		if reason, ok := p.failures[operation]; ok {
+			err = fmt.Errorf("%s", reason)
+		} else {
+			err = op()
+		}
+		p.lock.Unlock()
+
+		if err != nil {
+			p.FailHandler(fmt.Sprintf(`{"FailReason": "%s: %s"}`, failReason, err), 1)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package cf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	helpersCF "github.com/cloudfoundry/cf-test-helpers/v2/cf"
+	"github.com/onsi/ginkgo/v2"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// Last operation states, as brokers report them.
+const (
+	OperationInProgress = "in progress"
+	OperationSucceeded  = "succeeded"
+	OperationFailed     = "failed"
+)
+
+// defaultAsyncPollInterval is how often asynchronous service operations are
+// checked when no interval is configured.
+const defaultAsyncPollInterval = 10 * time.Second
+
+// errInstanceNotFound is returned by a lastOperationFetcher for an instance
+// that does not exist.
+var errInstanceNotFound = errors.New("service instance not found")
+
+// LastOperation is the most recent asynchronous operation on a service
+// instance, e.g. {create, in progress, "Instance provisioning in progress"}.
+type LastOperation struct {
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+func (op LastOperation) String() string {
+	s := strings.TrimSpace(op.Type + " " + op.State)
+	if op.Description != "" {
+		s += ": " + op.Description
+	}
+	return s
+}
+
+// lastOperationFetcher returns the last operation of a service instance, or
+// errInstanceNotFound.
+type lastOperationFetcher func(ctx context.Context) (LastOperation, error)
+
+// asyncWait is how long and how often to poll a service instance's last
+// operation.
+type asyncWait struct {
+	timeout  time.Duration
+	interval time.Duration
+	// fail defaults to ginkgo.Fail.
+	fail func(message string, callerSkip ...int)
+}
+
+func (w asyncWait) pollInterval() time.Duration {
+	if w.interval <= 0 {
+		return defaultAsyncPollInterval
+	}
+	return w.interval
+}
+
+// awaitOperation waits for the instance's last operation to succeed, printing
+// progress while it is in progress. A failed operation fails the spec at once
+// with the broker's description.
+func (w asyncWait) awaitOperation(instanceName, failReason string, fetch lastOperationFetcher) {
+	w.await(instanceName, failReason, func(ctx context.Context) error {
+		op, err := fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch op.State {
+		case OperationSucceeded:
+			return nil
+		case OperationFailed:
+			return retry.Permanent(fmt.Errorf("%s", op))
+		default:
+			fmt.Printf("Waiting for service instance %s: %s\n", instanceName, op)
+			return fmt.Errorf("%s", op)
+		}
+	})
+}
+
+// awaitGone waits for the instance to no longer exist. A failed delete fails
+// the spec at once with the broker's description.
+func (w asyncWait) awaitGone(instanceName, failReason string, fetch lastOperationFetcher) {
+	w.await(instanceName, failReason, func(ctx context.Context) error {
+		op, err := fetch(ctx)
+		if errors.Is(err, errInstanceNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if op.Type == "delete" && op.State == OperationFailed {
+			return retry.Permanent(fmt.Errorf("%s", op))
+		}
+		fmt.Printf("Waiting for service instance %s to be deleted: %s\n", instanceName, op)
+		return fmt.Errorf("service instance still exists: %s", op)
+	})
+}
+
+func (w asyncWait) await(instanceName, failReason string, check func(ctx context.Context) error) {
+	outcome := retry.Do(check).
+		Named(fmt.Sprintf("last operation of %s", instanceName)).
+		WithinTotal(w.timeout).
+		WithMaxRetries(math.MaxInt32).
+		WithBackoff(retry.None(w.pollInterval())).
+		WithFailHandler(func(string, ...int) {}).
+		Run()
+
+	if outcome.Succeeded() {
+		return
+	}
+
+	reason := failReason
+	if attempt, ok := outcome.LastAttempt(); ok && attempt.Err != nil {
+		reason = fmt.Sprintf("%s: %v", failReason, attempt.Err)
+	}
+	fail := w.fail
+	if fail == nil {
+		fail = ginkgo.Fail
+	}
+	// the broker's description is free text, so it is quoted to keep the
+	// FailReason intact
+	fail(fmt.Sprintf(`{"FailReason": %s}`+"\n%s\n%s", strconv.Quote(reason), outcome.Reason, outcome.History()), 1)
+}
+
+// lastOperation fetches an instance's last operation with the cf cli, from
+// the v3 API where the foundation advertises it and v2 otherwise.
+func (cf *CF) lastOperation(instanceName string) lastOperationFetcher {
+	return lastOperationWith(cfOutput, instanceName)
+}
+
+// cfRunner runs the cf cli and returns its stdout, as cfOutput does.
+type cfRunner func(ctx context.Context, args ...string) (string, error)
+
+// lastOperationWith looks up the instance's GUID and the API version on its
+// first successful call only. Later calls just curl the instance.
+func lastOperationWith(cf cfRunner, instanceName string) lastOperationFetcher {
+	var path string
+	return func(ctx context.Context) (LastOperation, error) {
+		if path == "" {
+			guid, err := cf(ctx, "service", "--guid", instanceName)
+			if err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					return LastOperation{}, errInstanceNotFound
+				}
+				return LastOperation{}, err
+			}
+			guid = strings.TrimSpace(guid)
+
+			root, err := cf(ctx, "curl", "/")
+			if err != nil {
+				return LastOperation{}, err
+			}
+
+			path = "/v2/service_instances/" + guid
+			if advertisesV3([]byte(root)) {
+				path = "/v3/service_instances/" + guid
+			}
+		}
+
+		instance, err := cf(ctx, "curl", path)
+		if err != nil {
+			return LastOperation{}, err
+		}
+
+		return lastOperationFromInstance([]byte(instance))
+	}
+}
+
+// lastOperationFromInstance decodes the last operation of a v3 service
+// instance, or of a v2 one, whose fields are nested under entity.
+func lastOperationFromInstance(contents []byte) (LastOperation, error) {
+	var resp struct {
+		LastOperation *LastOperation `json:"last_operation"`
+		Entity        struct {
+			LastOperation *LastOperation `json:"last_operation"`
+		} `json:"entity"`
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(contents, &resp); err != nil {
+		return LastOperation{}, fmt.Errorf("failed to decode service instance: %w", err)
+	}
+
+	switch {
+	case resp.LastOperation != nil:
+		return *resp.LastOperation, nil
+	case resp.Entity.LastOperation != nil:
+		return *resp.Entity.LastOperation, nil
+	case len(resp.Errors) > 0 && strings.Contains(resp.Errors[0].Title, "NotFound"),
+		strings.Contains(resp.ErrorCode, "NotFound"):
+		return LastOperation{}, errInstanceNotFound
+	default:
+		return LastOperation{}, fmt.Errorf("service instance has no last operation")
+	}
+}
+
+// cfOutput runs the cf cli until it exits or ctx is done, returning its
+// stdout, or an error holding its output if it exits non-zero.
+func cfOutput(ctx context.Context, args ...string) (string, error) {
+	session := helpersCF.Cf(args...)
+
+	select {
+	case <-session.Exited:
+	case <-ctx.Done():
+		session.Kill()
+		return "", ctx.Err()
+	}
+
+	if session.ExitCode() != 0 {
+		return "", fmt.Errorf("cf %s exited %d: %s %s", strings.Join(args, " "), session.ExitCode(),
+			strings.TrimSpace(string(session.Out.Contents())), strings.TrimSpace(string(session.Err.Contents())))
+	}
+	return string(session.Out.Contents()), nil
+}
@@ -0,0 +1,184 @@
+package cf
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("last operation", func() {
+	Describe("lastOperationFromInstance", func() {
+		It("decodes v3 service instances", func() {
+			op, err := lastOperationFromInstance([]byte(`{"last_operation": {"type": "create", "state": "in progress", "description": "provisioning"}}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op).To(Equal(LastOperation{Type: "create", State: OperationInProgress, Description: "provisioning"}))
+		})
+
+		It("decodes v2 service instances", func() {
+			op, err := lastOperationFromInstance([]byte(`{"entity": {"last_operation": {"type": "delete", "state": "failed", "description": "VM stuck"}}}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op.String()).To(Equal("delete failed: VM stuck"))
+		})
+
+		It("reports instances that are gone", func() {
+			_, err := lastOperationFromInstance([]byte(`{"errors": [{"title": "CF-ResourceNotFound", "detail": "Service instance not found"}]}`))
+			Expect(errors.Is(err, errInstanceNotFound)).To(BeTrue())
+
+			_, err = lastOperationFromInstance([]byte(`{"code": 60004, "description": "The service instance could not be found", "error_code": "CF-ServiceInstanceNotFound"}`))
+			Expect(errors.Is(err, errInstanceNotFound)).To(BeTrue())
+		})
+	})
+
+	Describe("lastOperationWith", func() {
+		var calls [][]string
+
+		cf := func(root string) cfRunner {
+			return func(_ context.Context, args ...string) (string, error) {
+				calls = append(calls, args)
+				switch {
+				case args[0] == "service":
+					return "instance-guid\n", nil
+				case args[1] == "/":
+					return root, nil
+				default:
+					return `{"last_operation": {"type": "create", "state": "in progress"}}`, nil
+				}
+			}
+		}
+
+		BeforeEach(func() {
+			calls = nil
+		})
+
+		It("looks up the GUID and API version once, then polls only the instance", func() {
+			fetch := lastOperationWith(cf(`{"links": {"cloud_controller_v3": {"href": "https://api.example.com/v3"}}}`), "some-instance")
+			for range 3 {
+				op, err := fetch(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(op.State).To(Equal(OperationInProgress))
+			}
+
+			Expect(calls).To(Equal([][]string{
+				{"service", "--guid", "some-instance"},
+				{"curl", "/"},
+				{"curl", "/v3/service_instances/instance-guid"},
+				{"curl", "/v3/service_instances/instance-guid"},
+				{"curl", "/v3/service_instances/instance-guid"},
+			}))
+		})
+
+		It("polls the v2 instance where v3 is not advertised", func() {
+			_, err := lastOperationWith(cf(`{"links": {}}`), "some-instance")(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(calls).To(ContainElement([]string{"curl", "/v2/service_instances/instance-guid"}))
+		})
+
+		It("reports an instance that does not exist yet without remembering it", func() {
+			missing := true
+			fetch := lastOperationWith(func(ctx context.Context, args ...string) (string, error) {
+				if args[0] == "service" && missing {
+					return "", errors.New("cf service --guid some-instance exited 1: Service instance some-instance not found")
+				}
+				return cf(`{"links": {}}`)(ctx, args...)
+			}, "some-instance")
+
+			_, err := fetch(context.Background())
+			Expect(errors.Is(err, errInstanceNotFound)).To(BeTrue())
+
+			missing = false
+			_, err = fetch(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("asyncWait", func() {
+		var (
+			wait     asyncWait
+			failures []string
+		)
+
+		sequence := func(ops ...LastOperation) lastOperationFetcher {
+			return func(context.Context) (LastOperation, error) {
+				op := ops[0]
+				if len(ops) > 1 {
+					ops = ops[1:]
+				}
+				return op, nil
+			}
+		}
+
+		BeforeEach(func() {
+			failures = nil
+			wait = asyncWait{
+				timeout:  time.Second,
+				interval: time.Millisecond,
+				fail:     func(message string, _ ...int) { failures = append(failures, message) },
+			}
+		})
+
+		It("waits while the operation is in progress", func() {
+			polls := 0
+			fetch := sequence(
+				LastOperation{Type: "create", State: OperationInProgress},
+				LastOperation{Type: "create", State: OperationInProgress},
+				LastOperation{Type: "create", State: OperationSucceeded},
+			)
+
+			wait.awaitOperation("some-instance", "Failed to create", func(ctx context.Context) (LastOperation, error) {
+				polls++
+				return fetch(ctx)
+			})
+
+			Expect(failures).To(BeEmpty())
+			Expect(polls).To(Equal(3))
+		})
+
+		It("fails at once with the broker's description", func() {
+			polls := 0
+			wait.awaitOperation("some-instance", "Failed to create", func(context.Context) (LastOperation, error) {
+				polls++
+				return LastOperation{Type: "create", State: OperationFailed, Description: "no capacity in az1"}, nil
+			})
+
+			Expect(polls).To(Equal(1))
+			Expect(failures).To(ConsistOf(HavePrefix(`{"FailReason": "Failed to create: create failed: no capacity in az1"}`)))
+		})
+
+		It("gives up after the timeout", func() {
+			wait.timeout = 20 * time.Millisecond
+			wait.awaitOperation("some-instance", "Failed to create", sequence(LastOperation{Type: "create", State: OperationInProgress}))
+
+			Expect(failures).To(ConsistOf(ContainSubstring("create in progress")))
+		})
+
+		It("waits for the instance to be deleted", func() {
+			calls := 0
+			wait.awaitGone("some-instance", "Failed to delete", func(context.Context) (LastOperation, error) {
+				calls++
+				if calls < 3 {
+					return LastOperation{Type: "delete", State: OperationInProgress}, nil
+				}
+				return LastOperation{}, errInstanceNotFound
+			})
+
+			Expect(failures).To(BeEmpty())
+			Expect(calls).To(Equal(3))
+		})
+
+		It("fails at once when the delete failed", func() {
+			wait.awaitGone("some-instance", "Failed to delete", sequence(LastOperation{Type: "delete", State: OperationFailed, Description: "VM stuck"}))
+
+			Expect(failures).To(ConsistOf(HavePrefix(`{"FailReason": "Failed to delete: delete failed: VM stuck"}`)))
+		})
+
+		It("quotes the broker's description in the fail reason", func() {
+			wait.awaitOperation("some-instance", "Failed to create", sequence(LastOperation{Type: "create", State: OperationFailed, Description: `quota "small" exceeded`}))
+
+			Expect(failures).To(ConsistOf(HavePrefix(`{"FailReason": "Failed to create: create failed: quota \"small\" exceeded"}`)))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Parameters are arbitrary parameters for the broker, as passed with
+// `cf create-service -c`. A nil Parameters passes none.
+type Parameters map[string]interface{}
+
+// cliArgs returns the -c flag carrying the parameters, or nothing if there
+// are none.
+func (p Parameters) cliArgs() []string {
+	if len(p) == 0 {
+		return nil
+	}
+
+	// values decoded from JSON always encode
+	encoded, _ := json.Marshal(p)
+	return []string{"-c", string(encoded)}
+}
+
+// Mismatches lists the requested parameters that p is missing or holds a
+// different value for. Parameters the broker added are ignored.
+func (p Parameters) Mismatches(requested Parameters) []string {
+	var mismatches []string
+	for name, want := range requested {
+		got, ok := p[name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s is missing", name))
+			continue
+		}
+
+		wantJSON, _ := json.Marshal(want)
+		gotJSON, _ := json.Marshal(got)
+		if string(wantJSON) != string(gotJSON) {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %v, expected %v", name, got, want))
+		}
+	}
+
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// parametersFromResponse decodes the parameters of a service instance as the
+// v2 or v3 API returns them. supported is false if the broker does not allow
+// fetching them.
+func parametersFromResponse(contents []byte) (params Parameters, supported bool, err error) {
+	var failure struct {
+		ErrorCode string `json:"error_code"`
+		Errors    []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(contents, &failure); err != nil {
+		return nil, false, fmt.Errorf("failed to decode service instance parameters: %w", err)
+	}
+
+	titles := []string{failure.ErrorCode}
+	for _, e := range failure.Errors {
+		titles = append(titles, e.Title)
+	}
+	for _, title := range titles {
+		if strings.HasSuffix(title, "ParametersNotSupported") {
+			return nil, false, nil
+		}
+	}
+	if len(failure.Errors) > 0 {
+		return nil, false, fmt.Errorf("%s: %s", failure.Errors[0].Title, failure.Errors[0].Detail)
+	}
+	if failure.ErrorCode != "" {
+		return nil, false, fmt.Errorf("%s", failure.ErrorCode)
+	}
+
+	if err := json.Unmarshal(contents, &params); err != nil {
+		return nil, false, fmt.Errorf("failed to decode service instance parameters: %w", err)
+	}
+	return params, true, nil
+}
@@ -0,0 +1,47 @@
+package cf
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameters", func() {
+	It("is passed to the cli with -c only when set", func() {
+		Expect(Parameters(nil).cliArgs()).To(BeEmpty())
+		Expect(Parameters{"maxclients": 100}.cliArgs()).To(Equal([]string{"-c", `{"maxclients":100}`}))
+	})
+
+	It("lists requested parameters that are missing or differ, ignoring extra ones", func() {
+		actual := Parameters{"maxclients": 100.0, "tags": []interface{}{"a"}, "added-by-broker": true}
+
+		Expect(actual.Mismatches(Parameters{"maxclients": 100, "tags": []string{"a"}})).To(BeEmpty())
+		Expect(actual.Mismatches(Parameters{"maxclients": 200, "policy": "noeviction"})).To(Equal([]string{
+			"maxclients is 100, expected 200",
+			"policy is missing",
+		}))
+	})
+
+	Describe("parametersFromResponse", func() {
+		It("decodes the parameters", func() {
+			params, supported, err := parametersFromResponse([]byte(`{"maxclients": 100}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supported).To(BeTrue())
+			Expect(params).To(Equal(Parameters{"maxclients": 100.0}))
+		})
+
+		It("reports brokers that do not support fetching them", func() {
+			_, supported, err := parametersFromResponse([]byte(`{"errors": [{"title": "CF-ServiceFetchInstanceParametersNotSupported", "detail": "not retrievable"}]}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supported).To(BeFalse())
+
+			_, supported, err = parametersFromResponse([]byte(`{"error_code": "CF-ServiceFetchInstanceParametersNotSupported"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(supported).To(BeFalse())
+		})
+
+		It("fails on other errors", func() {
+			_, _, err := parametersFromResponse([]byte(`{"errors": [{"title": "CF-ResourceNotFound", "detail": "not found"}]}`))
+			Expect(err).To(MatchError("CF-ResourceNotFound: not found"))
+		})
+	})
+})
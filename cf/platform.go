@@ -0,0 +1,55 @@
+package cf
+
+// Platform is every Cloud Foundry operation the smoke tests perform. Each
+// method returns a task to run as a reporter step; the task fails the running
+// spec when the operation fails.
+type Platform interface {
+	API(endpoint string, skipSSLValidation bool) func()
+	Auth(user, password string) func()
+	AuthClient(client, clientSecret string) func()
+	Logout() func()
+
+	CreateQuota(name string, args ...string) func()
+	CreateOrg(org, quota string) func()
+	DeleteOrg(name string) func()
+	CreateSpace(space string) func()
+	TargetOrg(org string) func()
+	TargetOrgAndSpace(org, space string) func()
+
+	CreateUser(name, password string) func()
+	DeleteUser(name string) func()
+	SetSpaceRole(name, org, space, role string) func()
+
+	EnableServiceAccess(org, service string) func()
+	EnableServiceAccessForPlan(org, service, plan string) func()
+
+	CreateAndBindSecurityGroup(securityGroup, serviceName, serviceKeyName, org, space string) func()
+	DeleteSecurityGroup(securityGroup string) func()
+
+	Push(appName string, args ...string) func()
+	Delete(appName string) func()
+	Start(appName string) func()
+	SetEnv(appName, environmentVariable, instanceName string) func()
+	Restage(appName string) func()
+
+	CreateService(serviceName, planName, instanceName string, params Parameters, skip *bool) func()
+	UpdateService(instanceName, planName string, params Parameters, upgrade bool) func()
+	GetServiceParameters(instanceName string, params *Parameters, supported *bool) func()
+	DeleteService(instanceName string) func()
+	EnsureServiceInstanceGone(instanceName string) func()
+	EnsureAllServiceInstancesGone() func()
+	BindService(appName, instanceName string, params Parameters) func()
+	UnbindService(appName, instanceName string) func()
+	EnsureServiceUnbound(appName, instanceName string) func()
+	ShareService(instanceName, org, space string) func()
+	UnshareService(instanceName, org, space string) func()
+
+	CreateServiceKey(serviceInstanceName, serviceKeyName string, params Parameters) func()
+	GetServiceKey(serviceInstanceName, serviceKeyName string, credentials *Credentials) func()
+	DeleteServiceKey(serviceInstanceName, serviceKeyName string) func()
+}
+
+var (
+	_ Platform = &CF{}
+	_ Platform = &CCV3{}
+)
@@ -0,0 +1,84 @@
+package cf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// defaultResolveTimeout bounds a lookup when Resolver.Timeout is unset.
+const defaultResolveTimeout = 10 * time.Second
+
+// Resolver resolves the hosts in service keys to security group
+// destinations. The zero value uses the system's DNS servers.
+type Resolver struct {
+	// Server is the host:port of the DNS server to query instead of the
+	// system's.
+	Server string
+	// Timeout bounds each lookup, including any CNAMEs followed.
+	Timeout time.Duration
+}
+
+// Destinations returns a CIDR for every IPv4 and IPv6 address host resolves
+// to, following CNAMEs. An IP address is its own destination.
+func (r Resolver) Destinations(ctx context.Context, host string) ([]string, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []string{hostCIDR(addr)}, nil
+	}
+
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = defaultResolveTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addrs, err := r.resolver().LookupNetIP(ctx, "ip", host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, fmt.Errorf("host %s does not resolve", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve host %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("host %s does not resolve", host)
+	}
+
+	seen := map[string]bool{}
+	var destinations []string
+	for _, addr := range addrs {
+		destination := hostCIDR(addr)
+		if !seen[destination] {
+			seen[destination] = true
+			destinations = append(destinations, destination)
+		}
+	}
+	sort.Strings(destinations)
+
+	return destinations, nil
+}
+
+func (r Resolver) resolver() *net.Resolver {
+	if r.Server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, r.Server)
+		},
+	}
+}
+
+// hostCIDR is the CIDR matching just addr: a /32 for IPv4 and a /128 for IPv6.
+func hostCIDR(addr netip.Addr) string {
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()).String()
+}
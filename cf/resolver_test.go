@@ -0,0 +1,201 @@
+package cf
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolver", func() {
+	var (
+		server   *dnsServer
+		resolver Resolver
+	)
+
+	BeforeEach(func() {
+		server = startDNSServer(map[string][]dnsRecord{
+			"redis.example.com.": {{Type: typeA, Addr: "10.0.0.1"}, {Type: typeA, Addr: "10.0.0.2"}},
+			"alias.example.com.": {{Type: typeCNAME, Target: "redis.example.com."}},
+			"dual.example.com.":  {{Type: typeA, Addr: "10.0.0.3"}, {Type: typeAAAA, Addr: "fd00::3"}},
+		})
+		DeferCleanup(server.Close)
+
+		resolver = Resolver{Server: server.Addr(), Timeout: 2 * time.Second}
+	})
+
+	It("returns a /32 for each IPv4 address", func() {
+		Expect(resolver.Destinations(context.Background(), "redis.example.com")).To(Equal([]string{"10.0.0.1/32", "10.0.0.2/32"}))
+	})
+
+	It("follows CNAMEs", func() {
+		Expect(resolver.Destinations(context.Background(), "alias.example.com")).To(Equal([]string{"10.0.0.1/32", "10.0.0.2/32"}))
+	})
+
+	It("returns a /128 for each IPv6 address", func() {
+		Expect(resolver.Destinations(context.Background(), "dual.example.com")).To(Equal([]string{"10.0.0.3/32", "fd00::3/128"}))
+	})
+
+	It("passes IP addresses through without a lookup", func() {
+		Expect(resolver.Destinations(context.Background(), "192.168.1.5")).To(Equal([]string{"192.168.1.5/32"}))
+		Expect(resolver.Destinations(context.Background(), "fd00::5")).To(Equal([]string{"fd00::5/128"}))
+		Expect(server.Queries()).To(BeZero())
+	})
+
+	It("fails clearly when a host does not resolve", func() {
+		_, err := resolver.Destinations(context.Background(), "missing.example.com")
+		Expect(err).To(MatchError("host missing.example.com does not resolve"))
+	})
+
+	It("gives up after the timeout", func() {
+		resolver.Server = server.SilentAddr()
+		resolver.Timeout = 100 * time.Millisecond
+
+		start := time.Now()
+		_, err := resolver.Destinations(context.Background(), "redis.example.com")
+		Expect(err).To(MatchError(ContainSubstring("failed to resolve host redis.example.com")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
+
+const (
+	typeA     = 1
+	typeCNAME = 5
+	typeAAAA  = 28
+)
+
+type dnsRecord struct {
+	Type   uint16
+	Addr   string
+	Target string
+}
+
+// dnsServer answers A, AAAA and CNAME queries over UDP from a fixed zone, the
+// way a recursive resolver would: a CNAME answer carries the target's records.
+type dnsServer struct {
+	conn    net.PacketConn
+	silent  net.PacketConn
+	zone    map[string][]dnsRecord
+	queries chan struct{}
+}
+
+func startDNSServer(zone map[string][]dnsRecord) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	s := &dnsServer{conn: conn, silent: silent, zone: zone, queries: make(chan struct{}, 1000)}
+	go s.serve()
+	return s
+}
+
+func (s *dnsServer) Addr() string       { return s.conn.LocalAddr().String() }
+func (s *dnsServer) SilentAddr() string { return s.silent.LocalAddr().String() }
+func (s *dnsServer) Queries() int       { return len(s.queries) }
+
+func (s *dnsServer) Close() {
+	s.conn.Close()
+	s.silent.Close()
+}
+
+func (s *dnsServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.queries <- struct{}{}
+
+		if response := s.answer(buf[:n]); response != nil {
+			s.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (s *dnsServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	name, end := readName(query, 12)
+	if end+4 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end:])
+	question := query[12 : end+4]
+
+	var answers [][]byte
+	records, found := s.zone[name]
+	for owner := name; found; {
+		next := ""
+		for _, record := range records {
+			switch {
+			case record.Type == typeCNAME:
+				answers = append(answers, resourceRecord(owner, typeCNAME, encodeName(record.Target)))
+				next = record.Target
+			case record.Type == qtype:
+				answers = append(answers, resourceRecord(owner, record.Type, netip.MustParseAddr(record.Addr).AsSlice()))
+			}
+		}
+		if next == "" {
+			break
+		}
+		owner = next
+		records = s.zone[next]
+	}
+
+	flags := uint16(0x8180)
+	if !found {
+		flags |= 3 // NXDOMAIN
+	}
+
+	response := make([]byte, 12, 512)
+	copy(response, query[:2])
+	binary.BigEndian.PutUint16(response[2:], flags)
+	binary.BigEndian.PutUint16(response[4:], 1)
+	binary.BigEndian.PutUint16(response[6:], uint16(len(answers)))
+	response = append(response, question...)
+	for _, answer := range answers {
+		response = append(response, answer...)
+	}
+	return response
+}
+
+func readName(message []byte, offset int) (string, int) {
+	var labels []string
+	for offset < len(message) {
+		length := int(message[offset])
+		offset++
+		if length == 0 {
+			break
+		}
+		labels = append(labels, strings.ToLower(string(message[offset:offset+length])))
+		offset += length
+	}
+	return strings.Join(labels, ".") + ".", offset
+}
+
+func encodeName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+func resourceRecord(owner string, rrType uint16, data []byte) []byte {
+	record := encodeName(owner)
+	record = binary.BigEndian.AppendUint16(record, rrType)
+	record = binary.BigEndian.AppendUint16(record, 1) // IN
+	record = binary.BigEndian.AppendUint32(record, 60)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	return append(record, data...)
+}
@@ -0,0 +1,112 @@
+package cf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// resolveSecurityGroupRules is buildSecurityGroupRules, retried while DNS or the
+// sentinels are unavailable.
+func resolveSecurityGroupRules(creds Credentials, resolver Resolver, timeout time.Duration, maxRetries int, backoff retry.Backoff) []SecurityGroup {
+	var rules []SecurityGroup
+
+	retry.Do(func(ctx context.Context) error {
+		var err error
+		rules, err = buildSecurityGroupRules(ctx, creds, resolver)
+		return err
+	}).Named("Resolve security group destinations").WithAttemptTimeout(timeout).AndMaxRetries(maxRetries).AndBackoff(backoff).Run(
+		`{"FailReason": "Failed to resolve security group destinations"}`,
+	)
+
+	return rules
+}
+
+// buildSecurityGroupRules builds a rule for each address and port the app
+// needs to reach the instance described by creds: its host, its sentinels
+// and the data nodes behind them. The ports are opened to 0.0.0.0/0 instead
+// of the resolved addresses if ENABLE_ALL_DESTINATIONS is "true".
+func buildSecurityGroupRules(ctx context.Context, creds Credentials, resolver Resolver) ([]SecurityGroup, error) {
+	allDestinations := os.Getenv("ENABLE_ALL_DESTINATIONS") == "true"
+
+	endpoints, err := instanceEndpoints(ctx, creds, !allDestinations)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[SecurityGroup]bool{}
+	var rules []SecurityGroup
+	for _, endpoint := range endpoints {
+		destinations := []string{"0.0.0.0/0"}
+		if !allDestinations {
+			destinations, err = resolver.Destinations(ctx, endpoint.Host)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, port := range []int{endpoint.Port, endpoint.TLSPort} {
+			if port == 0 {
+				continue
+			}
+			for _, destination := range destinations {
+				rule := SecurityGroup{Protocol: "tcp", Destination: destination, Ports: strconv.Itoa(port)}
+				if !seen[rule] {
+					seen[rule] = true
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, retry.Permanent(errors.New("the service key has no host or sentinel ports"))
+	}
+	return rules, nil
+}
+
+// defaultDataPort and defaultDataTLSPort are the data nodes' ports behind
+// sentinels, when the nodes are not discovered.
+const (
+	defaultDataPort    = 6379
+	defaultDataTLSPort = 16379
+)
+
+// instanceEndpoints lists the hosts and ports in creds. Unless the
+// credentials list the data nodes, the sentinels are asked for them if
+// discover is set. Otherwise, as the runner may not reach the sentinels,
+// the nodes are taken to use the default ports.
+func instanceEndpoints(ctx context.Context, creds Credentials, discover bool) ([]HostPort, error) {
+	endpoints := creds.Endpoints()
+
+	if len(creds.Sentinels) > 0 && len(creds.Nodes) == 0 {
+		if !discover {
+			if creds.IsSentinelTLS() {
+				return append(endpoints, HostPort{TLSPort: defaultDataTLSPort}), nil
+			}
+			return append(endpoints, HostPort{Port: defaultDataPort}), nil
+		}
+
+		nodes, err := discoverDataNodes(ctx, creds)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, nodes...)
+	}
+
+	return endpoints, nil
+}
+
+// discoverDataNodes asks the sentinels for the master and its replicas.
+func discoverDataNodes(ctx context.Context, creds Credentials) ([]HostPort, error) {
+	master, replicas, err := redis.DiscoverNodes(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	return append([]HostPort{master}, replicas...), nil
+}
@@ -0,0 +1,178 @@
+package cf
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+var _ = Describe("buildSecurityGroupRules", func() {
+	var (
+		ctx      = context.Background()
+		resolver Resolver
+	)
+
+	BeforeEach(func() {
+		server := startDNSServer(map[string][]dnsRecord{
+			"redis.example.com.": {{Type: typeA, Addr: "10.0.0.1"}},
+			"node.example.com.":  {{Type: typeA, Addr: "10.0.2.1"}, {Type: typeAAAA, Addr: "fd00::21"}},
+		})
+		DeferCleanup(server.Close)
+
+		resolver = Resolver{Server: server.Addr()}
+	})
+
+	It("opens the standard and TLS ports of the host", func() {
+		rules, err := buildSecurityGroupRules(ctx, Credentials{Host: "redis.example.com", Port: 6379, TLSPort: 16379}, resolver)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]SecurityGroup{
+			{Protocol: "tcp", Destination: "10.0.0.1/32", Ports: "6379"},
+			{Protocol: "tcp", Destination: "10.0.0.1/32", Ports: "16379"},
+		}))
+	})
+
+	It("opens every sentinel and the data nodes listed in the credentials", func() {
+		creds := Credentials{
+			MasterName: "some-master",
+			Sentinels: []HostPort{
+				{Host: "10.0.1.1", Port: 26379},
+				{Host: "10.0.1.2", Port: 26379},
+			},
+			Nodes: []HostPort{{Host: "node.example.com", Port: 6379, TLSPort: 16379}},
+		}
+
+		rules, err := buildSecurityGroupRules(ctx, creds, resolver)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]SecurityGroup{
+			{Protocol: "tcp", Destination: "10.0.1.1/32", Ports: "26379"},
+			{Protocol: "tcp", Destination: "10.0.1.2/32", Ports: "26379"},
+			{Protocol: "tcp", Destination: "10.0.2.1/32", Ports: "6379"},
+			{Protocol: "tcp", Destination: "fd00::21/128", Ports: "6379"},
+			{Protocol: "tcp", Destination: "10.0.2.1/32", Ports: "16379"},
+			{Protocol: "tcp", Destination: "fd00::21/128", Ports: "16379"},
+		}))
+	})
+
+	It("asks the sentinels for the data nodes when the credentials do not list them", func() {
+		sentinel := startSentinel("some-master", HostPort{Host: "10.0.2.1", Port: 6380}, HostPort{Host: "10.0.2.2", Port: 6380})
+		DeferCleanup(sentinel.Close)
+
+		unreachable := HostPort{Host: "127.0.0.1", Port: closedPort()}
+		creds := Credentials{MasterName: "some-master", Sentinels: []HostPort{unreachable, sentinel.HostPort()}}
+
+		rules, err := buildSecurityGroupRules(ctx, creds, resolver)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(ContainElements(
+			SecurityGroup{Protocol: "tcp", Destination: "10.0.2.1/32", Ports: "6380"},
+			SecurityGroup{Protocol: "tcp", Destination: "10.0.2.2/32", Ports: "6380"},
+		))
+		Expect(rules).NotTo(ContainElement(HaveField("Destination", "0.0.0.0/0")))
+	})
+
+	It("fails when no sentinel knows the master", func() {
+		sentinel := startSentinel("other-master")
+		DeferCleanup(sentinel.Close)
+
+		_, err := buildSecurityGroupRules(ctx, Credentials{MasterName: "some-master", Sentinels: []HostPort{sentinel.HostPort()}}, resolver)
+		Expect(err).To(MatchError(ContainSubstring("does not monitor master some-master")))
+	})
+
+	It("opens the ports to any destination only when ENABLE_ALL_DESTINATIONS is set", func() {
+		os.Setenv("ENABLE_ALL_DESTINATIONS", "true")
+		DeferCleanup(os.Unsetenv, "ENABLE_ALL_DESTINATIONS")
+
+		rules, err := buildSecurityGroupRules(ctx, Credentials{Host: "unresolvable.example.com", Port: 6379}, resolver)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]SecurityGroup{{Protocol: "tcp", Destination: "0.0.0.0/0", Ports: "6379"}}))
+	})
+
+	It("does not ask the sentinels for the data nodes when ENABLE_ALL_DESTINATIONS is set", func() {
+		os.Setenv("ENABLE_ALL_DESTINATIONS", "true")
+		DeferCleanup(os.Unsetenv, "ENABLE_ALL_DESTINATIONS")
+
+		creds := Credentials{MasterName: "some-master", Sentinels: []HostPort{{Host: "sentinel.unreachable.example.com", Port: 26379}}}
+		rules, err := buildSecurityGroupRules(ctx, creds, resolver)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]SecurityGroup{
+			{Protocol: "tcp", Destination: "0.0.0.0/0", Ports: "26379"},
+			{Protocol: "tcp", Destination: "0.0.0.0/0", Ports: "6379"},
+		}))
+	})
+})
+
+// fakeSentinel answers the sentinel commands used to discover data nodes.
+type fakeSentinel struct {
+	listener net.Listener
+	master   string
+	nodes    []HostPort
+}
+
+func startSentinel(master string, nodes ...HostPort) *fakeSentinel {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	s := &fakeSentinel{listener: listener, master: master, nodes: nodes}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSentinel) HostPort() HostPort {
+	return HostPort{Host: "127.0.0.1", Port: s.listener.Addr().(*net.TCPAddr).Port}
+}
+
+func (s *fakeSentinel) Close() { s.listener.Close() }
+
+func (s *fakeSentinel) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSentinel) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		reply, err := redis.ReadReply(reader)
+		if err != nil {
+			return
+		}
+		args, _ := reply.([]interface{})
+		if len(args) != 3 || args[2] != s.master {
+			conn.Write([]byte("*-1\r\n"))
+			continue
+		}
+
+		switch args[1] {
+		case "get-master-addr-by-name":
+			master := s.nodes[0]
+			conn.Write([]byte(redis.EncodeCommand(master.Host, strconv.Itoa(master.Port))))
+		case "slaves":
+			var replicas strings.Builder
+			replicas.WriteString("*" + strconv.Itoa(len(s.nodes)-1) + "\r\n")
+			for _, replica := range s.nodes[1:] {
+				replicas.WriteString(redis.EncodeCommand("name", "replica", "ip", replica.Host, "port", strconv.Itoa(replica.Port)))
+			}
+			conn.Write([]byte(replicas.String()))
+		}
+	}
+}
+
+func closedPort() int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
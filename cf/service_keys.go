@@ -0,0 +1,154 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	helpersCF "github.com/cloudfoundry/cf-test-helpers/v2/cf"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+// getServiceKeyCredentials looks up a service key through the v3 credential
+// bindings API, or through /v2/service_keys on foundations that do not
+// advertise v3.
+func (cf *CF) getServiceKeyCredentials(serviceGuid, serviceKeyName string) Credentials {
+	var creds Credentials
+	var err error
+
+	root := cf.curl("/", `{"FailReason": "Failed to read the Cloud Controller root"}`)
+	if advertisesV3(root) {
+		query := url.Values{
+			"type":                   {"key"},
+			"service_instance_guids": {serviceGuid},
+			"names":                  {serviceKeyName},
+		}
+		bindings := cf.curl("/v3/service_credential_bindings?"+query.Encode(), `{"FailReason": "Failed to retrieve service bindings for app"}`)
+
+		var bindingGUID string
+		bindingGUID, err = serviceKeyGUIDFromV3(bindings, serviceKeyName)
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprintf(`{"FailReason": "Invalid service key response, %s"}`, err))
+
+		details := cf.curl(fmt.Sprintf("/v3/service_credential_bindings/%s/details", bindingGUID), `{"FailReason": "Failed to retrieve service key details"}`)
+		creds, err = credentialsFromV3Details(details)
+	} else {
+		keys := cf.curl(fmt.Sprintf("/v2/service_keys?q=service_instance_guid:%s", serviceGuid), `{"FailReason": "Failed to retrieve service bindings for app"}`)
+		creds, err = credentialsFromV2ServiceKeys(keys, serviceKeyName)
+	}
+	Expect(err).NotTo(HaveOccurred(), fmt.Sprintf(`{"FailReason": "Invalid service key response, %s"}`, err))
+
+	validateCredentials(creds)
+
+	return creds
+}
+
+// curl is `cf curl {path}`, failing with failReason unless it exits 0.
+func (cf *CF) curl(path, failReason string) []byte {
+	session := helpersCF.Cf("curl", path)
+	Eventually(session, cf.ShortTimeout).Should(gexec.Exit(0), failReason)
+
+	return session.Out.Contents()
+}
+
+// advertisesV3 reports whether the Cloud Controller root document links to
+// the v3 API.
+func advertisesV3(root []byte) bool {
+	var resp struct {
+		Links map[string]*struct {
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(root, &resp); err != nil {
+		return false
+	}
+
+	link := resp.Links["cloud_controller_v3"]
+	return link != nil && link.Href != ""
+}
+
+func serviceKeyGUIDFromV3(contents []byte, serviceKeyName string) (string, error) {
+	var resp struct {
+		Resources []struct {
+			GUID string `json:"guid"`
+			Name string `json:"name"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(contents, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode service key response: %w", err)
+	}
+	if err := cloudControllerError(contents); err != nil {
+		return "", err
+	}
+
+	for _, resource := range resp.Resources {
+		if resource.Name == serviceKeyName {
+			return resource.GUID, nil
+		}
+	}
+	return "", fmt.Errorf("service key %s not found", serviceKeyName)
+}
+
+func credentialsFromV3Details(contents []byte) (Credentials, error) {
+	var resp struct {
+		Credentials Credentials `json:"credentials"`
+	}
+	if err := json.Unmarshal(contents, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode service key details: %w", err)
+	}
+
+	return resp.Credentials, nil
+}
+
+func credentialsFromV2ServiceKeys(contents []byte, serviceKeyName string) (Credentials, error) {
+	var resp struct {
+		Resources []struct {
+			Entity struct {
+				Name        string      `json:"name"`
+				Credentials Credentials `json:"credentials"`
+			} `json:"entity"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(contents, &resp); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode service key response: %w", err)
+	}
+	if err := cloudControllerError(contents); err != nil {
+		return Credentials{}, err
+	}
+
+	for _, resource := range resp.Resources {
+		if resource.Entity.Name == serviceKeyName {
+			return resource.Entity.Credentials, nil
+		}
+	}
+	return Credentials{}, fmt.Errorf("service key %s not found", serviceKeyName)
+}
+
+// cloudControllerError returns the error a Cloud Controller response
+// reports, if any: the v3 errors array, or a v2 error code and description.
+func cloudControllerError(contents []byte) error {
+	var resp struct {
+		Errors []struct {
+			Title  string `json:"title"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+		ErrorCode   string `json:"error_code"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(contents, &resp) != nil {
+		return nil
+	}
+
+	var messages []string
+	for _, e := range resp.Errors {
+		messages = append(messages, e.Title+": "+e.Detail)
+	}
+	if resp.ErrorCode != "" {
+		messages = append(messages, resp.ErrorCode+": "+resp.Description)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the Cloud Controller returned %s", strings.Join(messages, "; "))
+}
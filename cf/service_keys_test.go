@@ -0,0 +1,70 @@
+package cf
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("service key lookup", func() {
+	Describe("advertisesV3", func() {
+		It("is true when the root links to the v3 API", func() {
+			root := []byte(`{"links": {"cloud_controller_v2": null, "cloud_controller_v3": {"href": "https://api.example.com/v3"}}}`)
+			Expect(advertisesV3(root)).To(BeTrue())
+		})
+
+		It("is false for v2 only foundations", func() {
+			root := []byte(`{"links": {"cloud_controller_v2": {"href": "https://api.example.com/v2"}}}`)
+			Expect(advertisesV3(root)).To(BeFalse())
+		})
+	})
+
+	It("selects the v3 key binding by name", func() {
+		bindings := []byte(`{"resources": [
+			{"guid": "other-guid", "name": "other-key"},
+			{"guid": "key-guid", "name": "some-key"}
+		]}`)
+
+		guid, err := serviceKeyGUIDFromV3(bindings, "some-key")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(guid).To(Equal("key-guid"))
+
+		_, err = serviceKeyGUIDFromV3(bindings, "missing-key")
+		Expect(err).To(MatchError("service key missing-key not found"))
+	})
+
+	It("reports the Cloud Controller's v3 errors rather than a missing key", func() {
+		errorBody := []byte(`{"errors": [{"code": 10003, "title": "CF-NotAuthorized", "detail": "You are not authorized to perform the requested action"}]}`)
+
+		_, err := serviceKeyGUIDFromV3(errorBody, "some-key")
+		Expect(err).To(MatchError("the Cloud Controller returned CF-NotAuthorized: You are not authorized to perform the requested action"))
+	})
+
+	It("decodes v3 binding details", func() {
+		details := []byte(`{"credentials": {"host": "10.0.0.1", "port": 6379, "tls_versions": ["tlsv1.2"]}}`)
+
+		creds, err := credentialsFromV3Details(details)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds).To(Equal(Credentials{Host: "10.0.0.1", Port: 6379, TLSVersions: []string{"tlsv1.2"}}))
+	})
+
+	It("selects the v2 service key by name", func() {
+		keys := []byte(`{"resources": [
+			{"entity": {"name": "other-key", "credentials": {"host": "10.0.0.2", "port": 6379}}},
+			{"entity": {"name": "some-key", "credentials": {"host": "10.0.0.1", "port": 6379}}}
+		]}`)
+
+		creds, err := credentialsFromV2ServiceKeys(keys, "some-key")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(creds.Host).To(Equal("10.0.0.1"))
+
+		_, err = credentialsFromV2ServiceKeys(keys, "missing-key")
+		Expect(err).To(MatchError("service key missing-key not found"))
+	})
+
+	It("reports the Cloud Controller's v2 errors rather than a missing key", func() {
+		errorBody := []byte(`{"code": 1000, "description": "Invalid Auth Token", "error_code": "CF-InvalidAuthToken"}`)
+
+		_, err := credentialsFromV2ServiceKeys(errorBody, "some-key")
+		Expect(err).To(MatchError("the Cloud Controller returned CF-InvalidAuthToken: Invalid Auth Token"))
+	})
+})
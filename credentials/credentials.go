@@ -0,0 +1,247 @@
+// Package credentials models the credentials the cf-redis and on-demand Redis
+// brokers put in service keys and bindings, and checks they describe an
+// instance that can be connected to.
+package credentials
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// defaultRedisPort is used for redis:// and rediss:// URIs without a port.
+const defaultRedisPort = 6379
+
+// ErrUnresolvedCredHubRef is returned for credentials that are only a CredHub
+// reference, which happens when the Cloud Controller could not fetch them.
+var ErrUnresolvedCredHubRef = errors.New("credentials are an unresolved CredHub reference")
+
+// FieldError is a missing or malformed credential field.
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Problem)
+}
+
+type HostPort struct {
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	TLSPort int    `json:"tls_port"`
+}
+
+// Credentials are a standalone instance's host and ports, or the sentinels
+// watching a replicated one. Host, Port and Password are filled in from URI
+// when the broker only sends that.
+type Credentials struct {
+	Host        string   `json:"host,omitempty"`
+	Port        int      `json:"port,omitempty"`
+	TLSPort     int      `json:"tls_port,omitempty"`
+	TLSVersions []string `json:"tls_versions,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	// URI is a redis:// or rediss:// URI for the instance.
+	URI string `json:"uri,omitempty"`
+	// CACert is the PEM encoded CA the instance's TLS certificate is
+	// signed by, if the broker sends one.
+	CACert string `json:"ca_cert,omitempty"`
+
+	MasterName string     `json:"master_name,omitempty"`
+	Sentinels  []HostPort `json:"sentinels,omitempty"`
+	// Nodes are the data nodes behind the sentinels, if the broker lists
+	// them.
+	Nodes []HostPort `json:"nodes,omitempty"`
+
+	// CredHubRef is all the broker sent if the credentials are kept in
+	// CredHub.
+	CredHubRef string `json:"credhub-ref,omitempty"`
+}
+
+// Parse decodes and validates credentials.
+func Parse(contents []byte) (Credentials, error) {
+	var creds Credentials
+	if err := json.Unmarshal(contents, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	return creds, creds.Validate()
+}
+
+// UnmarshalJSON accepts every shape the brokers emit: tls_ca_cert for
+// ca_cert, and a URI in place of, or alongside, host, port and password.
+func (c *Credentials) UnmarshalJSON(contents []byte) error {
+	type plain Credentials
+	var decoded struct {
+		plain
+		TLSCACert string `json:"tls_ca_cert"`
+	}
+	if err := json.Unmarshal(contents, &decoded); err != nil {
+		return err
+	}
+
+	*c = Credentials(decoded.plain)
+	if c.CACert == "" {
+		c.CACert = decoded.TLSCACert
+	}
+
+	// a malformed URI is reported by Validate
+	c.fillFromURI()
+	return nil
+}
+
+func (c *Credentials) fillFromURI() {
+	u, err := c.parseURI()
+	if err != nil || u == nil {
+		return
+	}
+
+	if c.Host == "" {
+		c.Host = u.Hostname()
+	}
+
+	port := defaultRedisPort
+	if u.Port() != "" {
+		port, _ = strconv.Atoi(u.Port())
+	}
+	if u.Scheme == "rediss" && c.TLSPort == 0 {
+		c.TLSPort = port
+	}
+	if u.Scheme == "redis" && c.Port == 0 {
+		c.Port = port
+	}
+
+	if password, ok := u.User.Password(); ok && c.Password == "" {
+		c.Password = password
+	}
+}
+
+func (c Credentials) parseURI() (*url.URL, error) {
+	if c.URI == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(c.URI)
+	if err != nil {
+		return nil, &FieldError{Field: "uri", Problem: "is not a URI"}
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, &FieldError{Field: "uri", Problem: fmt.Sprintf("has scheme %q, expected redis or rediss", u.Scheme)}
+	}
+	if u.Hostname() == "" {
+		return nil, &FieldError{Field: "uri", Problem: "has no host"}
+	}
+	if u.Port() != "" {
+		if _, err := parsePort(u.Port()); err != nil {
+			return nil, &FieldError{Field: "uri", Problem: "has an invalid port"}
+		}
+	}
+	return u, nil
+}
+
+// Validate checks the credentials name a standalone instance or its
+// sentinels, with a port to connect on.
+func (c Credentials) Validate() error {
+	if c.CredHubRef != "" && c.Host == "" && len(c.Sentinels) == 0 {
+		return fmt.Errorf("%w: %s", ErrUnresolvedCredHubRef, c.CredHubRef)
+	}
+	if _, err := c.parseURI(); err != nil {
+		return err
+	}
+
+	if c.IsSentinel() {
+		for i, sentinel := range c.Sentinels {
+			if err := validateHostPort(fmt.Sprintf("sentinels[%d].", i), sentinel); err != nil {
+				return err
+			}
+		}
+		for i, node := range c.Nodes {
+			if err := validateHostPort(fmt.Sprintf("nodes[%d].", i), node); err != nil {
+				return err
+			}
+		}
+	} else if err := validateHostPort("", HostPort{Host: c.Host, Port: c.Port, TLSPort: c.TLSPort}); err != nil {
+		return err
+	}
+
+	if c.CACert != "" {
+		block, _ := pem.Decode([]byte(c.CACert))
+		if block == nil {
+			return &FieldError{Field: "ca_cert", Problem: "is not PEM encoded"}
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return &FieldError{Field: "ca_cert", Problem: "is not a certificate"}
+		}
+	}
+
+	return nil
+}
+
+func validateHostPort(prefix string, hp HostPort) error {
+	if hp.Host == "" {
+		return &FieldError{Field: prefix + "host", Problem: "is missing"}
+	}
+	if hp.Port == 0 && hp.TLSPort == 0 {
+		return &FieldError{Field: prefix + "port", Problem: "is missing"}
+	}
+	if hp.Port < 0 || hp.Port > 65535 {
+		return &FieldError{Field: prefix + "port", Problem: "is out of range"}
+	}
+	if hp.TLSPort < 0 || hp.TLSPort > 65535 {
+		return &FieldError{Field: prefix + "tls_port", Problem: "is out of range"}
+	}
+	return nil
+}
+
+func parsePort(port string) (int, error) {
+	n, err := strconv.Atoi(port)
+	if err == nil && (n < 1 || n > 65535) {
+		err = errors.New("port out of range")
+	}
+	return n, err
+}
+
+// TLSEnabled reports whether the instance has a TLS port.
+func (c Credentials) TLSEnabled() bool {
+	return c.TLSPort > 0
+}
+
+// TLSEnforced reports whether the instance only has a TLS port.
+func (c Credentials) TLSEnforced() bool {
+	return c.TLSPort > 0 && c.Port == 0
+}
+
+// IsSentinel reports whether the instance is reached through sentinels.
+func (c Credentials) IsSentinel() bool {
+	return len(c.Sentinels) > 0
+}
+
+// IsSentinelTLS reports whether the sentinels are reached over TLS.
+func (c Credentials) IsSentinelTLS() bool {
+	return c.IsSentinel() && c.Sentinels[0].TLSPort > 0
+}
+
+// HasTLSVersion reports whether the instance accepts the TLS version, e.g.
+// "tlsv1.2".
+func (c Credentials) HasTLSVersion(version string) bool {
+	for _, v := range c.TLSVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Endpoints lists every host and its ports: the instance's host, its
+// sentinels and any data nodes listed.
+func (c Credentials) Endpoints() []HostPort {
+	var endpoints []HostPort
+	if c.Host != "" {
+		endpoints = append(endpoints, HostPort{Host: c.Host, Port: c.Port, TLSPort: c.TLSPort})
+	}
+	endpoints = append(endpoints, c.Sentinels...)
+	return append(endpoints, c.Nodes...)
+}
@@ -0,0 +1,128 @@
+package credentials_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+)
+
+var _ = Describe("Credentials", func() {
+	Describe("Parse", func() {
+		It("parses a standalone instance with a TLS port", func() {
+			creds, err := credentials.Parse([]byte(`{
+				"host": "10.0.0.1", "port": 6379, "tls_port": 16379,
+				"tls_versions": ["tlsv1.2", "tlsv1.3"], "password": "secret"
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds).To(Equal(credentials.Credentials{
+				Host: "10.0.0.1", Port: 6379, TLSPort: 16379,
+				TLSVersions: []string{"tlsv1.2", "tlsv1.3"}, Password: "secret",
+			}))
+			Expect(creds.TLSEnabled()).To(BeTrue())
+			Expect(creds.TLSEnforced()).To(BeFalse())
+			Expect(creds.HasTLSVersion("tlsv1.3")).To(BeTrue())
+			Expect(creds.HasTLSVersion("tlsv1.1")).To(BeFalse())
+		})
+
+		It("parses sentinels", func() {
+			creds, err := credentials.Parse([]byte(`{
+				"master_name": "some-master", "password": "secret",
+				"sentinels": [{"host": "10.0.1.1", "port": 26379}, {"host": "10.0.1.2", "tls_port": 26380}]
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.IsSentinel()).To(BeTrue())
+			Expect(creds.IsSentinelTLS()).To(BeFalse())
+			Expect(creds.Endpoints()).To(Equal([]credentials.HostPort{
+				{Host: "10.0.1.1", Port: 26379},
+				{Host: "10.0.1.2", TLSPort: 26380},
+			}))
+		})
+
+		It("fills in the host, port and password from a redis URI", func() {
+			creds, err := credentials.Parse([]byte(`{"uri": "redis://:secret@redis.example.com:6380"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.Host).To(Equal("redis.example.com"))
+			Expect(creds.Port).To(Equal(6380))
+			Expect(creds.Password).To(Equal("secret"))
+		})
+
+		It("treats a rediss URI as the TLS port, defaulting to 6379", func() {
+			creds, err := credentials.Parse([]byte(`{"uri": "rediss://:secret@redis.example.com"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.TLSPort).To(Equal(6379))
+			Expect(creds.TLSEnforced()).To(BeTrue())
+		})
+
+		It("prefers explicit fields over the URI", func() {
+			creds, err := credentials.Parse([]byte(`{"host": "10.0.0.1", "port": 6379, "password": "explicit", "uri": "redis://:other@redis.example.com:6380"}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.Host).To(Equal("10.0.0.1"))
+			Expect(creds.Port).To(Equal(6379))
+			Expect(creds.Password).To(Equal("explicit"))
+		})
+
+		It("accepts the CA under either name", func() {
+			ca := selfSignedCA()
+			encoded, err := json.Marshal(map[string]interface{}{"host": "10.0.0.1", "tls_port": 16379, "tls_ca_cert": ca})
+			Expect(err).NotTo(HaveOccurred())
+
+			creds, err := credentials.Parse(encoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(creds.CACert).To(Equal(ca))
+		})
+	})
+
+	Describe("Validate", func() {
+		fieldError := func(contents string) *credentials.FieldError {
+			_, err := credentials.Parse([]byte(contents))
+			var fieldErr *credentials.FieldError
+			Expect(err).To(BeAssignableToTypeOf(fieldErr))
+			return err.(*credentials.FieldError)
+		}
+
+		It("reports the missing or malformed field", func() {
+			Expect(fieldError(`{"port": 6379}`)).To(Equal(&credentials.FieldError{Field: "host", Problem: "is missing"}))
+			Expect(fieldError(`{"host": "10.0.0.1"}`)).To(Equal(&credentials.FieldError{Field: "port", Problem: "is missing"}))
+			Expect(fieldError(`{"host": "10.0.0.1", "port": 70000}`)).To(Equal(&credentials.FieldError{Field: "port", Problem: "is out of range"}))
+			Expect(fieldError(`{"sentinels": [{"host": "10.0.1.1", "port": 26379}, {"port": 26379}]}`)).To(Equal(&credentials.FieldError{Field: "sentinels[1].host", Problem: "is missing"}))
+			Expect(fieldError(`{"uri": "http://redis.example.com"}`)).To(Equal(&credentials.FieldError{Field: "uri", Problem: `has scheme "http", expected redis or rediss`}))
+			Expect(fieldError(`{"host": "10.0.0.1", "port": 6379, "ca_cert": "not a certificate"}`)).To(Equal(&credentials.FieldError{Field: "ca_cert", Problem: "is not PEM encoded"}))
+		})
+
+		It("reports unresolved CredHub references", func() {
+			_, err := credentials.Parse([]byte(`{"credhub-ref": "/c/p-redis/some-instance/credentials"}`))
+			Expect(err).To(MatchError(credentials.ErrUnresolvedCredHubRef))
+			Expect(err).To(MatchError(ContainSubstring("/c/p-redis/some-instance/credentials")))
+		})
+	})
+})
+
+func selfSignedCA() string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
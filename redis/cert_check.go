@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// defaultExpiryWarning is how close to expiry a certificate is warned about
+// by default.
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// CertCheck inspects the certificates an instance's TLS ports present: the
+// chain, the hosts they are valid for and how soon they expire.
+type CertCheck struct {
+	runnerCheck
+	caBundle      string
+	expiryWarning time.Duration
+	expiryFailure time.Duration
+	clock         retry.Clock
+}
+
+// NewCertCheck reads creds when it runs, so it can be built before the
+// service key is fetched.
+func NewCertCheck(creds *credentials.Credentials, timeout, retryInterval time.Duration) *CertCheck {
+	return &CertCheck{
+		runnerCheck:   newRunnerCheck(creds, timeout, retryInterval),
+		expiryWarning: defaultExpiryWarning,
+		clock:         retry.RealClock,
+	}
+}
+
+// WithClock measures expiry and validity against clock rather than the wall
+// clock.
+func (c *CertCheck) WithClock(clock retry.Clock) *CertCheck {
+	c.clock = clock
+	return c
+}
+
+// WithCABundle verifies chains against the PEM certificates in bundle
+// rather than the CA in the credentials. Without either, chains are not
+// verified.
+func (c *CertCheck) WithCABundle(bundle string) *CertCheck {
+	c.caBundle = bundle
+	return c
+}
+
+// WithExpiryWarning warns about certificates that expire within window.
+func (c *CertCheck) WithExpiryWarning(window time.Duration) *CertCheck {
+	c.expiryWarning = window
+	return c
+}
+
+// AndExpiryFailure fails for certificates that expire within window. By
+// default only expired certificates fail.
+func (c *CertCheck) AndExpiryFailure(window time.Duration) *CertCheck {
+	c.expiryFailure = window
+	return c
+}
+
+// Check runs Verify until it connects to every TLS port or the timeout is
+// up. Only the notes of the last attempt are passed to note.
+func (c *CertCheck) Check(note func(string)) func() {
+	return func() {
+		var notes []string
+		defer func() {
+			for _, n := range notes {
+				note(n)
+			}
+		}()
+
+		c.retry("Inspect certificates", `{"FailReason": "The instance's TLS certificates are not valid"}`, func(ctx context.Context) error {
+			notes = nil
+			return c.Verify(ctx, func(n string) { notes = append(notes, n) })
+		})
+	}
+}
+
+// Verify checks the certificates of the instance's TLS port and its
+// sentinels' TLS ports. Each chain must verify against the CA bundle, if
+// there is one, be valid for the host the credentials give, and not expire
+// within the failure window. The fingerprint and expiry of each certificate are passed
+// to note, with a warning for those expiring within the warning window.
+func (c *CertCheck) Verify(ctx context.Context, note func(string)) error {
+	endpoints := c.tlsEndpoints()
+	if len(endpoints) == 0 {
+		return retry.Permanent(errors.New("the service key has no TLS ports"))
+	}
+
+	roots, err := c.roots()
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	if roots == nil {
+		note("There is no CA bundle and no CA in the service key, so certificate chains are not verified")
+	}
+
+	chains := make([][]*x509.Certificate, len(endpoints))
+	for i, endpoint := range endpoints {
+		chains[i], err = peerCertificates(ctx, endpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := c.clock.Now()
+	var errs []error
+	for i, endpoint := range endpoints {
+		address := hostPortString(endpoint)
+		chain := chains[i]
+
+		for position, cert := range chain {
+			note(fmt.Sprintf("%s certificate %d %q: SHA-256 %s, not after %s",
+				address, position, cert.Subject.CommonName, fingerprint(cert), cert.NotAfter.UTC().Format(time.RFC3339)))
+
+			remaining := cert.NotAfter.Sub(now)
+			switch {
+			case remaining < c.expiryFailure:
+				errs = append(errs, fmt.Errorf("certificate %d of %s expires at %s, within %s", position, address, cert.NotAfter.UTC().Format(time.RFC3339), c.expiryFailure))
+			case remaining < c.expiryWarning:
+				note(fmt.Sprintf("WARNING: certificate %d of %s expires within %s", position, address, c.expiryWarning))
+			}
+		}
+
+		leaf := chain[0]
+		if roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, cert := range chain[1:] {
+				intermediates.AddCert(cert)
+			}
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, CurrentTime: now}); err != nil {
+				errs = append(errs, fmt.Errorf("the certificate chain of %s does not verify: %w", address, err))
+			}
+		}
+		if err := leaf.VerifyHostname(endpoint.Host); err != nil {
+			sans := "it has no subject alternative names"
+			if names := subjectAltNames(leaf); len(names) > 0 {
+				sans = "its subject alternative names are " + strings.Join(names, ", ")
+			}
+			errs = append(errs, fmt.Errorf("the certificate of %s is not valid for %s: %s", address, endpoint.Host, sans))
+		}
+	}
+	return retry.Permanent(errors.Join(errs...))
+}
+
+// roots is the CA bundle, or else the CA in the credentials. Nil means
+// there is neither.
+func (c *CertCheck) roots() (*x509.CertPool, error) {
+	bundle, source := c.caBundle, "CA bundle"
+	if bundle == "" {
+		bundle, source = c.creds.CACert, "service key's CA"
+	}
+	if bundle == "" {
+		return nil, nil
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, fmt.Errorf("the %s has no PEM certificates", source)
+	}
+	return roots, nil
+}
+
+func peerCertificates(ctx context.Context, endpoint credentials.HostPort) ([]*x509.Certificate, error) {
+	dialer := tls.Dialer{Config: &tls.Config{ServerName: endpoint.Host, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.TLSPort)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s over TLS: %w", hostPortString(endpoint), err)
+	}
+	defer conn.Close()
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s presented no certificates", hostPortString(endpoint))
+	}
+	return chain, nil
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("CertCheck", func() {
+	var (
+		server *fakeServer
+		caPEM  string
+		creds  credentials.Credentials
+		check  *redis.CertCheck
+		notes  []string
+	)
+
+	verify := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		return check.Verify(ctx, func(note string) { notes = append(notes, note) })
+	}
+
+	BeforeEach(func() {
+		serverConfig, ca := serverTLS()
+		server = startServer("", serverConfig)
+		DeferCleanup(server.Close)
+		caPEM = ca
+
+		creds = credentials.Credentials{Host: "127.0.0.1", TLSPort: server.Port(), CACert: caPEM}
+		check = redis.NewCertCheck(&creds, time.Second, 10*time.Millisecond)
+		notes = nil
+	})
+
+	It("notes the fingerprint and expiry of each certificate", func() {
+		check.WithExpiryWarning(time.Minute)
+
+		Expect(verify()).To(Succeed())
+		Expect(notes).To(HaveLen(1))
+		Expect(notes[0]).To(MatchRegexp(`^127\.0\.0\.1:\d+ certificate 0 "redis": SHA-256 ([0-9A-F]{2}:){31}[0-9A-F]{2}, not after \d{4}-\d{2}-\d{2}T`))
+	})
+
+	It("warns about certificates expiring within the warning window", func() {
+		Expect(verify()).To(Succeed())
+		Expect(notes).To(ContainElement(HavePrefix("WARNING: certificate 0 of " + server.Address() + " expires within")))
+	})
+
+	It("fails for certificates expiring within the failure window", func() {
+		check.AndExpiryFailure(24 * time.Hour)
+
+		Expect(verify()).To(MatchError(ContainSubstring("certificate 0 of " + server.Address() + " expires at")))
+		Expect(notes).NotTo(BeEmpty())
+	})
+
+	It("measures expiry against its clock", func() {
+		check.WithClock(retry.NewFakeClock(time.Now().Add(2 * time.Hour)))
+
+		Expect(verify()).To(MatchError(ContainSubstring("certificate 0 of " + server.Address() + " expires at")))
+	})
+
+	It("passes on only the notes of the attempt that finished", func() {
+		serverConfig, _ := serverTLS()
+		var handshakes atomic.Int32
+		serverConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			if handshakes.Add(1) <= 2 {
+				return nil, errors.New("not ready")
+			}
+			return nil, nil
+		}
+		flaky := startServer("", serverConfig)
+		DeferCleanup(flaky.Close)
+		creds = credentials.Credentials{Host: "127.0.0.1", TLSPort: flaky.Port()}
+
+		Expect(check.Check(func(note string) { notes = append(notes, note) })).NotTo(Panic())
+		Expect(handshakes.Load()).To(BeEquivalentTo(3))
+		Expect(notes).To(HaveExactElements(
+			"There is no CA bundle and no CA in the service key, so certificate chains are not verified",
+			HavePrefix(flaky.Address()+" certificate 0"),
+			HavePrefix("WARNING: certificate 0 of "+flaky.Address()),
+		))
+	})
+
+	It("fails when the chain does not verify against the service key's CA", func() {
+		_, creds.CACert = serverTLS()
+
+		Expect(verify()).To(MatchError(ContainSubstring("the certificate chain of " + server.Address() + " does not verify")))
+	})
+
+	It("prefers the CA bundle to the service key's CA", func() {
+		_, creds.CACert = serverTLS()
+		check.WithCABundle(caPEM)
+
+		Expect(verify()).To(Succeed())
+	})
+
+	It("notes that chains are not verified without a CA bundle or the service key's CA", func() {
+		creds.CACert = ""
+
+		Expect(verify()).To(Succeed())
+		Expect(notes).To(ContainElement("There is no CA bundle and no CA in the service key, so certificate chains are not verified"))
+	})
+
+	It("fails when the CA bundle has no certificates", func() {
+		check.WithCABundle("not a certificate")
+
+		Expect(verify()).To(MatchError("the CA bundle has no PEM certificates"))
+	})
+
+	It("fails when the certificate is not valid for the host in the credentials", func() {
+		creds.Host = "localhost"
+
+		Expect(verify()).To(MatchError(ContainSubstring("is not valid for localhost: its subject alternative names are 127.0.0.1")))
+	})
+
+	It("inspects the sentinels' TLS ports", func() {
+		sentinelConfig, _ := serverTLS()
+		sentinel := startServer("", sentinelConfig)
+		DeferCleanup(sentinel.Close)
+		creds.Sentinels = []credentials.HostPort{{Host: "127.0.0.1", TLSPort: sentinel.Port()}}
+
+		Expect(verify()).To(MatchError(ContainSubstring("the certificate chain of " + sentinel.Address() + " does not verify")))
+		Expect(notes).To(ContainElement(HavePrefix(sentinel.Address() + " certificate 0")))
+	})
+
+	It("fails when the service key has no TLS ports", func() {
+		creds.TLSPort = 0
+
+		Expect(verify()).To(MatchError("the service key has no TLS ports"))
+	})
+})
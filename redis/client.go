@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrNil is returned for nil replies, e.g. GET of a missing key.
+var ErrNil = errors.New("redis: nil reply")
+
+// ServerError is an error reply from the server, e.g. "NOAUTH ...".
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+// Client is a minimal RESP client over a single connection. It is not safe
+// for concurrent use.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to address, over TLS if tlsConfig is set. The connection's
+// deadline is ctx's, if it has one.
+func Dial(ctx context.Context, address string, tlsConfig *tls.Config) (*Client, error) {
+	var dialer net.Dialer
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		tlsDialer := tls.Dialer{NetDialer: &dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	return &Client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends a command and reads its reply. Simple and bulk strings are
+// returned as string, integers as int64 and arrays as []interface{}.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	if _, err := io.WriteString(c.conn, EncodeCommand(args...)); err != nil {
+		return nil, err
+	}
+	return ReadReply(c.reader)
+}
+
+// Auth authenticates with the instance's password.
+func (c *Client) Auth(password string) error {
+	_, err := c.Do("AUTH", password)
+	return err
+}
+
+func (c *Client) Ping() error {
+	reply, err := c.Do("PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected PING reply %v", reply)
+	}
+	return nil
+}
+
+func (c *Client) Set(key, value string) error {
+	_, err := c.Do("SET", key, value)
+	return err
+}
+
+func (c *Client) Get(key string) (string, error) {
+	reply, err := c.Do("GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected GET reply %v", reply)
+	}
+	return value, nil
+}
+
+// Role returns the node's role from ROLE: "master", "slave" or "sentinel".
+func (c *Client) Role() (string, error) {
+	reply, err := c.Do("ROLE")
+	if err != nil {
+		return "", err
+	}
+	fields, _ := reply.([]interface{})
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected ROLE reply %v", reply)
+	}
+	role, ok := fields[0].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected ROLE reply %v", reply)
+	}
+	return role, nil
+}
+
+// Info returns the fields of an INFO section, e.g. "server".
+func (c *Client) Info(section string) (map[string]string, error) {
+	reply, err := c.Do("INFO", section)
+	if err != nil {
+		return nil, err
+	}
+	contents, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected INFO reply %v", reply)
+	}
+
+	info := map[string]string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			info[name] = value
+		}
+	}
+	return info, nil
+}
+
+// EncodeCommand encodes a command as a RESP array of bulk strings.
+func EncodeCommand(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+// ReadReply reads one RESP reply. Error replies are returned as ServerError
+// and nil replies as ErrNil.
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, ServerError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, ErrNil
+		}
+		contents := make([]byte, length+2)
+		if _, err := io.ReadFull(r, contents); err != nil {
+			return nil, err
+		}
+		return string(contents[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, ErrNil
+		}
+		values := make([]interface{}, length)
+		for i := range values {
+			values[i], err = ReadReply(r)
+			if errors.Is(err, ErrNil) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,93 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server *fakeServer
+		client *redis.Client
+	)
+
+	dial := func(tlsConfig *tls.Config) *redis.Client {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		client, err := redis.Dial(ctx, server.Address(), tlsConfig)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		return client
+	}
+
+	BeforeEach(func() {
+		server = startServer("secret", nil)
+		DeferCleanup(server.Close)
+		client = dial(nil)
+	})
+
+	It("authenticates, pings, writes and reads", func() {
+		Expect(client.Auth("secret")).To(Succeed())
+		Expect(client.Ping()).To(Succeed())
+		Expect(client.Set("some-key", "some value\r\nwith a newline")).To(Succeed())
+		Expect(client.Get("some-key")).To(Equal("some value\r\nwith a newline"))
+		Expect(server.Commands()).To(Equal([]string{"AUTH", "PING", "SET", "GET"}))
+	})
+
+	It("reads the fields of an INFO section", func() {
+		Expect(client.Auth("secret")).To(Succeed())
+
+		info, err := client.Info("server")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(map[string]string{"redis_version": "7.2.4", "redis_mode": "standalone"}))
+	})
+
+	It("returns error replies as server errors", func() {
+		err := client.Ping()
+		Expect(err).To(MatchError(redis.ServerError("NOAUTH Authentication required.")))
+
+		Expect(client.Auth("wrong")).To(MatchError(ContainSubstring("WRONGPASS")))
+	})
+
+	It("returns ErrNil for missing keys", func() {
+		Expect(client.Auth("secret")).To(Succeed())
+
+		_, err := client.Get("missing")
+		Expect(err).To(MatchError(redis.ErrNil))
+	})
+
+	It("talks RESP over TLS", func() {
+		server.Close()
+		serverConfig, caPEM := serverTLS()
+		server = startServer("secret", serverConfig)
+
+		pool := x509.NewCertPool()
+		Expect(pool.AppendCertsFromPEM([]byte(caPEM))).To(BeTrue())
+		client := dial(&tls.Config{RootCAs: pool})
+
+		Expect(client.Auth("secret")).To(Succeed())
+		Expect(client.Ping()).To(Succeed())
+	})
+
+	It("gives up at the context's deadline", func() {
+		listener := startSilentListener()
+		DeferCleanup(listener.Close)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		client, err := redis.Dial(ctx, listener.Addr().String(), nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		start := time.Now()
+		Expect(client.Ping()).To(MatchError(ContainSubstring("timeout")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+})
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cf-test-helpers/v2/helpers"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// CheckList replaces the list at key with values, then reads it back in
+// order.
+func (app *App) CheckList(key string, values ...string) func() {
+	return func() {
+		app.put("lists", key, strings.Join(values, ","))
+		app.getJSON("lists", key, retry.MatchesJSON("values", values))
+	}
+}
+
+// CheckHash replaces the hash at key with fields, then reads them all back.
+func (app *App) CheckHash(key string, fields map[string]string) func() {
+	return func() {
+		var pairs []string
+		for field, value := range fields {
+			pairs = append(pairs, field+":"+value)
+		}
+		sort.Strings(pairs)
+
+		app.put("hashes", key, strings.Join(pairs, ","))
+		app.getJSON("hashes", key, retry.MatchesJSON("fields", fields))
+	}
+}
+
+// CheckSet replaces the set at key with members, then reads them back. The
+// app sorts the members it returns.
+func (app *App) CheckSet(key string, members ...string) func() {
+	return func() {
+		expected := append([]string(nil), members...)
+		sort.Strings(expected)
+
+		app.put("sets", key, strings.Join(members, ","))
+		app.getJSON("sets", key, retry.MatchesJSON("members", expected))
+	}
+}
+
+// CheckSortedSet replaces the sorted set at key with scored members, then
+// reads the members back in score order.
+func (app *App) CheckSortedSet(key string, scores map[string]float64) func() {
+	return func() {
+		var pairs, expected []string
+		for member, score := range scores {
+			pairs = append(pairs, fmt.Sprintf("%s:%g", member, score))
+			expected = append(expected, member)
+		}
+		sort.Strings(pairs)
+		sort.Slice(expected, func(i, j int) bool { return scores[expected[i]] < scores[expected[j]] })
+
+		app.put("sorted_sets", key, strings.Join(pairs, ","))
+		app.getJSON("sorted_sets", key, retry.MatchesJSON("members", expected))
+	}
+}
+
+// CheckStream replaces the stream at key with an entry per value and
+// creates the consumer group, then reads the entries as consumer in the
+// group. The app acknowledges what it reads, so none may be left pending.
+func (app *App) CheckStream(key, group, consumer string, values ...string) func() {
+	return func() {
+		app.put("streams", key, strings.Join(values, ","), "group="+group)
+		app.getJSON("streams", fmt.Sprintf("%s/groups/%s/consumers/%s", key, group, consumer), retry.And(
+			retry.MatchesJSON("values", values),
+			retry.MatchesJSON("pending", 0),
+		))
+	}
+}
+
+// CheckExpiry writes key with a time to live, checks it has one, then waits
+// for it to expire.
+func (app *App) CheckExpiry(key, value string, ttl time.Duration) func() {
+	return func() {
+		app.put("ttl", key, value, fmt.Sprintf("ttl=%d", int(ttl.Seconds())))
+		app.getJSON("ttl", key, retry.And(
+			retry.MatchesJSON("exists", true),
+			retry.Described("stdout JSON ttl > 0", retry.MatchesOutput(regexp.MustCompile(`"ttl":\s*[1-9]`))),
+		))
+		app.getJSON("ttl", key, retry.MatchesJSON("exists", false))
+	}
+}
+
+// CheckIncr resets the counter at key, increments it with concurrent
+// requests and checks each answered success and none were lost. The
+// increments are not retried, since a retry could count twice.
+func (app *App) CheckIncr(key string, concurrency int) func() {
+	return func() {
+		app.put("counters", key, "0")
+
+		uri := app.typeURI("counters", key)
+		sessions := make([]*gexec.Session, concurrency)
+		for i := range sessions {
+			fmt.Println("Posting to url: ", uri)
+			sessions[i] = helpers.CurlSkipSSL(true, "-f", "-X", "POST", uri)
+		}
+		for _, session := range sessions {
+			Eventually(session, app.timeout).Should(gexec.Exit(0), fmt.Sprintf(`{"FailReason": "Failed to post to %s"}`, uri))
+			Expect(session.Out).To(gbytes.Say("success"), fmt.Sprintf(`{"FailReason": "Failed to increment the counter at %s"}`, uri))
+		}
+
+		app.getJSON("counters", key, retry.MatchesJSON("value", concurrency))
+	}
+}
+
+func (app *App) typeURI(dataType, key string) string {
+	return fmt.Sprintf("%s/%s/%s", app.uri, dataType, key)
+}
+
+// put sends data, and any other form fields, to the data type's endpoint
+// for key. The endpoints replace what is stored, so retries are safe.
+func (app *App) put(dataType, key, data string, fields ...string) {
+	uri := app.typeURI(dataType, key)
+	args := []string{"-d", "data=" + data}
+	for _, field := range fields {
+		args = append(args, "-d", field)
+	}
+	args = append(args, "-X", "PUT", uri)
+
+	curlFn := func() *gexec.Session {
+		fmt.Println("Putting to url: ", uri)
+		return helpers.CurlSkipSSL(true, args...)
+	}
+
+	retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
+		retry.MatchesOutput(regexp.MustCompile("success")),
+		fmt.Sprintf(`{"FailReason": "Failed to put to %s"}`, uri),
+	)
+}
+
+func (app *App) getJSON(dataType, path string, condition retry.Condition) {
+	uri := app.typeURI(dataType, path)
+	curlFn := func() *gexec.Session {
+		fmt.Printf("\nGetting from url: %s\n", uri)
+		return helpers.CurlSkipSSL(true, uri)
+	}
+
+	retry.Session(curlFn).WithSessionTimeout(app.timeout).AndBackoff(app.retryBackoff).Until(
+		condition,
+		fmt.Sprintf(`{"FailReason": "Failed to get the expected %s from %s"}`, strings.ReplaceAll(dataType, "_", " "), uri),
+	)
+}
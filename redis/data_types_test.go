@@ -0,0 +1,232 @@
+package redis_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+// fakeApp serves the data type endpoints the README documents for the
+// example app, keeping everything in memory.
+type fakeApp struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	lists    map[string][]string
+	hashes   map[string]map[string]string
+	sets     map[string][]string
+	scores   map[string]map[string]float64
+	streams  map[string][]string
+	groups   map[string]bool
+	expiries map[string]time.Time
+	counters map[string]int
+
+	// failIncrements answers each increment with an error, after counting
+	// it.
+	failIncrements bool
+}
+
+func newFakeApp() *fakeApp {
+	app := &fakeApp{
+		lists:    map[string][]string{},
+		hashes:   map[string]map[string]string{},
+		sets:     map[string][]string{},
+		scores:   map[string]map[string]float64{},
+		streams:  map[string][]string{},
+		groups:   map[string]bool{},
+		expiries: map[string]time.Time{},
+		counters: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /lists/{key}", app.write(func(r *http.Request, data []string) {
+		app.lists[r.PathValue("key")] = data
+	}))
+	mux.HandleFunc("GET /lists/{key}", app.read(func(r *http.Request) any {
+		return map[string]any{"values": app.lists[r.PathValue("key")]}
+	}))
+
+	mux.HandleFunc("PUT /hashes/{key}", app.write(func(r *http.Request, data []string) {
+		fields := map[string]string{}
+		for _, pair := range data {
+			field, value, _ := strings.Cut(pair, ":")
+			fields[field] = value
+		}
+		app.hashes[r.PathValue("key")] = fields
+	}))
+	mux.HandleFunc("GET /hashes/{key}", app.read(func(r *http.Request) any {
+		return map[string]any{"fields": app.hashes[r.PathValue("key")]}
+	}))
+
+	mux.HandleFunc("PUT /sets/{key}", app.write(func(r *http.Request, data []string) {
+		members := append([]string(nil), data...)
+		sort.Strings(members)
+		app.sets[r.PathValue("key")] = members
+	}))
+	mux.HandleFunc("GET /sets/{key}", app.read(func(r *http.Request) any {
+		return map[string]any{"members": app.sets[r.PathValue("key")]}
+	}))
+
+	mux.HandleFunc("PUT /sorted_sets/{key}", app.write(func(r *http.Request, data []string) {
+		scores := map[string]float64{}
+		for _, pair := range data {
+			member, score, _ := strings.Cut(pair, ":")
+			scores[member], _ = strconv.ParseFloat(score, 64)
+		}
+		app.scores[r.PathValue("key")] = scores
+	}))
+	mux.HandleFunc("GET /sorted_sets/{key}", app.read(func(r *http.Request) any {
+		scores := app.scores[r.PathValue("key")]
+		members := make([]string, 0, len(scores))
+		for member := range scores {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool { return scores[members[i]] < scores[members[j]] })
+		return map[string]any{"members": members}
+	}))
+
+	mux.HandleFunc("PUT /streams/{key}", app.write(func(r *http.Request, data []string) {
+		app.streams[r.PathValue("key")] = data
+		app.groups[r.PathValue("key")+"/"+r.PostForm.Get("group")] = true
+	}))
+	mux.HandleFunc("GET /streams/{key}/groups/{group}/consumers/{consumer}", app.read(func(r *http.Request) any {
+		if !app.groups[r.PathValue("key")+"/"+r.PathValue("group")] {
+			return nil
+		}
+		return map[string]any{"values": app.streams[r.PathValue("key")], "pending": 0}
+	}))
+
+	mux.HandleFunc("PUT /ttl/{key}", app.write(func(r *http.Request, data []string) {
+		ttl, _ := strconv.Atoi(r.PostForm.Get("ttl"))
+		app.expiries[r.PathValue("key")] = time.Now().Add(time.Duration(ttl) * time.Second)
+	}))
+	mux.HandleFunc("GET /ttl/{key}", app.read(func(r *http.Request) any {
+		remaining := time.Until(app.expiries[r.PathValue("key")])
+		if remaining <= 0 {
+			return map[string]any{"exists": false, "ttl": -2}
+		}
+		return map[string]any{"exists": true, "ttl": int(math.Ceil(remaining.Seconds()))}
+	}))
+
+	mux.HandleFunc("PUT /counters/{key}", app.write(func(r *http.Request, data []string) {
+		app.counters[r.PathValue("key")], _ = strconv.Atoi(data[0])
+	}))
+	mux.HandleFunc("POST /counters/{key}", func(w http.ResponseWriter, r *http.Request) {
+		app.lock.Lock()
+		defer app.lock.Unlock()
+
+		app.counters[r.PathValue("key")]++
+		if app.failIncrements {
+			http.Error(w, "ERR value is not an integer or out of range", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "success")
+	})
+	mux.HandleFunc("GET /counters/{key}", app.read(func(r *http.Request) any {
+		return map[string]any{"value": app.counters[r.PathValue("key")]}
+	}))
+
+	app.Server = httptest.NewServer(mux)
+	return app
+}
+
+// write parses the comma separated data field and answers success.
+func (app *fakeApp) write(store func(r *http.Request, data []string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		app.lock.Lock()
+		defer app.lock.Unlock()
+
+		store(r, strings.Split(r.PostForm.Get("data"), ","))
+		fmt.Fprint(w, "success")
+	}
+}
+
+// read answers with what load returns as JSON, or not found for nil.
+func (app *fakeApp) read(load func(r *http.Request) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.lock.Lock()
+		defer app.lock.Unlock()
+
+		body := load(r)
+		if body == nil {
+			http.NotFound(w, r)
+			return
+		}
+		Expect(json.NewEncoder(w).Encode(body)).To(Succeed())
+	}
+}
+
+func (app *fakeApp) failIncrementsAfterCounting() {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+
+	app.failIncrements = true
+}
+
+var _ = Describe("Data type checks", func() {
+	var (
+		fake *fakeApp
+		app  *redis.App
+	)
+
+	BeforeEach(func() {
+		fake = newFakeApp()
+		DeferCleanup(fake.Close)
+
+		app = redis.NewApp(fake.URL, 2*time.Second, 10*time.Millisecond)
+	})
+
+	It("checks a list reads back in order", func() {
+		Expect(app.CheckList("listkey", "c", "a", "b")).NotTo(Panic())
+	})
+
+	It("checks every field of a hash reads back", func() {
+		Expect(app.CheckHash("hashkey", map[string]string{"name": "redis", "port": "6379"})).NotTo(Panic())
+	})
+
+	It("checks the members of a set read back", func() {
+		Expect(app.CheckSet("setkey", "c", "a", "b")).NotTo(Panic())
+	})
+
+	It("checks the members of a sorted set read back in score order", func() {
+		Expect(app.CheckSortedSet("zsetkey", map[string]float64{"low": 1, "high": 10.5, "middle": 2})).NotTo(Panic())
+	})
+
+	It("checks a consumer group reads every entry of a stream", func() {
+		Expect(app.CheckStream("streamkey", "group", "consumer", "a", "b")).NotTo(Panic())
+	})
+
+	It("checks a key expires after its time to live", func() {
+		app = redis.NewApp(fake.URL, 2*time.Second, 200*time.Millisecond)
+
+		Expect(app.CheckExpiry("ttlkey", "value", time.Second)).NotTo(Panic())
+	})
+
+	It("checks no concurrent increment is lost", func() {
+		Expect(app.CheckIncr("counterkey", 5)).NotTo(Panic())
+	})
+
+	It("fails when an increment answers an error, even if it counted", func() {
+		fake.failIncrementsAfterCounting()
+
+		err := InterceptGomegaFailure(app.CheckIncr("counterkey", 5))
+		Expect(err).To(MatchError(ContainSubstring("Failed to post to " + fake.URL + "/counters/counterkey")))
+	})
+})
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+)
+
+// Probe talks RESP to the instance directly from the test runner, so a
+// failure can be told apart from one in the example app or its route.
+type Probe struct {
+	runnerCheck
+}
+
+// NewProbe reads creds when it runs, so it can be built before the service
+// key is fetched.
+func NewProbe(creds *credentials.Credentials, timeout, retryInterval time.Duration) *Probe {
+	return &Probe{newRunnerCheck(creds, timeout, retryInterval)}
+}
+
+// Check runs Verify until it passes or the timeout is up.
+func (p *Probe) Check(key, value string) func() {
+	return func() {
+		p.retry("Probe Redis", `{"FailReason": "Failed to reach Redis directly from the test runner"}`, func(ctx context.Context) error {
+			return p.Verify(ctx, key, value)
+		})
+	}
+}
+
+// Verify authenticates, pings, writes key, reads it back and reads the
+// server INFO on each of the instance's ports. Sentinel instances are
+// probed on the master the sentinels report.
+func (p *Probe) Verify(ctx context.Context, key, value string) error {
+	target, err := p.target(ctx)
+	if err != nil {
+		return err
+	}
+
+	if target.Port > 0 {
+		if err := p.verifyAddress(ctx, net.JoinHostPort(target.Host, strconv.Itoa(target.Port)), nil, key, value); err != nil {
+			return err
+		}
+	}
+	if target.TLSPort > 0 {
+		address := net.JoinHostPort(target.Host, strconv.Itoa(target.TLSPort))
+		if err := p.verifyAddress(ctx, address, TLSConfig(*p.creds, target.Host), key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Probe) target(ctx context.Context) (credentials.HostPort, error) {
+	if !p.creds.IsSentinel() || p.creds.Host != "" {
+		return credentials.HostPort{Host: p.creds.Host, Port: p.creds.Port, TLSPort: p.creds.TLSPort}, nil
+	}
+
+	master, _, err := DiscoverNodes(ctx, *p.creds)
+	if err != nil {
+		return master, err
+	}
+	return MasterNode(*p.creds, master), nil
+}
+
+func (p *Probe) verifyAddress(ctx context.Context, address string, tlsConfig *tls.Config, key, value string) error {
+	transport := "TCP"
+	if tlsConfig != nil {
+		transport = "TLS"
+	}
+
+	client, err := Dial(ctx, address, tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s over %s: %w", address, transport, err)
+	}
+	defer client.Close()
+
+	if p.creds.Password != "" {
+		if err := client.Auth(p.creds.Password); err != nil {
+			return fmt.Errorf("AUTH on %s failed: %w", address, err)
+		}
+	}
+	if err := client.Ping(); err != nil {
+		return fmt.Errorf("PING on %s failed: %w", address, err)
+	}
+	if err := client.Set(key, value); err != nil {
+		return fmt.Errorf("SET on %s failed: %w", address, err)
+	}
+	actual, err := client.Get(key)
+	if err != nil {
+		return fmt.Errorf("GET on %s failed: %w", address, err)
+	}
+	if actual != value {
+		return fmt.Errorf("GET on %s returned %q, expected %q", address, actual, value)
+	}
+
+	info, err := client.Info("server")
+	if err != nil {
+		return fmt.Errorf("INFO on %s failed: %w", address, err)
+	}
+	fmt.Printf("Reached Redis %s at %s over %s\n", info["redis_version"], address, transport)
+	return nil
+}
@@ -0,0 +1,141 @@
+package redis_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+var _ = Describe("Probe", func() {
+	var (
+		server *fakeServer
+		creds  credentials.Credentials
+		probe  *redis.Probe
+	)
+
+	verify := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		return probe.Verify(ctx, "probekey", "probevalue")
+	}
+
+	BeforeEach(func() {
+		server = startServer("secret", nil)
+		DeferCleanup(server.Close)
+
+		creds = credentials.Credentials{Host: "127.0.0.1", Port: server.Port(), Password: "secret"}
+		probe = redis.NewProbe(&creds, time.Second, 10*time.Millisecond)
+	})
+
+	It("authenticates, writes, reads back and reads INFO on the plain port", func() {
+		Expect(verify()).To(Succeed())
+
+		Expect(server.Data()).To(Equal(map[string]string{"probekey": "probevalue"}))
+		Expect(server.Commands()).To(Equal([]string{"AUTH", "PING", "SET", "GET", "INFO"}))
+	})
+
+	It("reads the credentials when it runs, not when it is built", func() {
+		creds = credentials.Credentials{}
+		probe = redis.NewProbe(&creds, time.Second, 10*time.Millisecond)
+
+		creds = credentials.Credentials{Host: "127.0.0.1", Port: server.Port(), Password: "secret"}
+		Expect(verify()).To(Succeed())
+	})
+
+	It("fails with the server's error when the password is wrong", func() {
+		creds.Password = "wrong"
+
+		Expect(verify()).To(MatchError(ContainSubstring("AUTH on 127.0.0.1")))
+		Expect(verify()).To(MatchError(ContainSubstring("WRONGPASS")))
+	})
+
+	It("fails when nothing listens on the port", func() {
+		server.Close()
+
+		Expect(verify()).To(MatchError(ContainSubstring("failed to connect to 127.0.0.1")))
+	})
+
+	It("keeps retrying Check until the timeout, not a number of attempts", func() {
+		server.FailNext(15, "LOADING Redis is loading the dataset in memory")
+
+		Expect(probe.Check("probekey", "probevalue")).NotTo(Panic())
+		Expect(server.Data()).To(HaveKeyWithValue("probekey", "probevalue"))
+		Expect(server.Commands()).To(HaveLen(15 + 5))
+	})
+
+	Context("when the instance has a TLS port", func() {
+		var tlsServer *fakeServer
+
+		BeforeEach(func() {
+			serverConfig, caPEM := serverTLS()
+			tlsServer = startServer("secret", serverConfig)
+			DeferCleanup(tlsServer.Close)
+
+			creds.TLSPort = tlsServer.Port()
+			creds.CACert = caPEM
+		})
+
+		It("probes both ports, verifying the TLS port against the CA", func() {
+			Expect(verify()).To(Succeed())
+
+			Expect(server.Data()).To(HaveKeyWithValue("probekey", "probevalue"))
+			Expect(tlsServer.Data()).To(HaveKeyWithValue("probekey", "probevalue"))
+		})
+
+		It("fails when the certificate is not signed by the CA", func() {
+			_, creds.CACert = serverTLS()
+
+			Expect(verify()).To(MatchError(ContainSubstring("over TLS")))
+		})
+
+		It("only uses the TLS port when TLS is enforced", func() {
+			creds.Port = 0
+
+			Expect(verify()).To(Succeed())
+			Expect(server.Commands()).To(BeEmpty())
+		})
+	})
+
+	Context("when the instance is reached through sentinels", func() {
+		var sentinel *fakeServer
+
+		BeforeEach(func() {
+			sentinel = startServer("", nil)
+			DeferCleanup(sentinel.Close)
+			sentinel.Monitor("mymaster", credentials.HostPort{Host: "127.0.0.1", Port: server.Port()})
+
+			creds = credentials.Credentials{
+				Password:   "secret",
+				MasterName: "mymaster",
+				Sentinels:  []credentials.HostPort{{Host: "127.0.0.1", Port: sentinel.Port()}},
+			}
+		})
+
+		It("probes the master the sentinels report", func() {
+			Expect(verify()).To(Succeed())
+
+			Expect(server.Data()).To(HaveKeyWithValue("probekey", "probevalue"))
+			Expect(sentinel.Commands()).To(Equal([]string{"SENTINEL", "SENTINEL"}))
+		})
+
+		It("asks the next sentinel when one does not know the master", func() {
+			other := startServer("", nil)
+			DeferCleanup(other.Close)
+			creds.Sentinels = append([]credentials.HostPort{{Host: "127.0.0.1", Port: other.Port()}}, creds.Sentinels...)
+
+			Expect(verify()).To(Succeed())
+			Expect(other.Commands()).To(Equal([]string{"SENTINEL"}))
+		})
+
+		It("fails when no sentinel knows the master", func() {
+			creds.MasterName = "othermaster"
+
+			Expect(verify()).To(MatchError(ContainSubstring("no sentinel reported the master othermaster")))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// runnerCheck is what the checks run from the test runner share: the service
+// key they read when they run and how long they retry for.
+type runnerCheck struct {
+	creds        *credentials.Credentials
+	timeout      time.Duration
+	retryBackoff retry.Backoff
+}
+
+// newRunnerCheck reads creds when the check runs, so it can be built before
+// the service key is fetched.
+func newRunnerCheck(creds *credentials.Credentials, timeout, retryInterval time.Duration) runnerCheck {
+	return runnerCheck{
+		creds:        creds,
+		timeout:      timeout,
+		retryBackoff: retry.None(retryInterval),
+	}
+}
+
+// retry runs op until it passes or the timeout is up.
+func (c runnerCheck) retry(name, failReason string, op func(context.Context) error) {
+	c.retryWithin(c.timeout, name, failReason, op)
+}
+
+// once runs op a single time within the timeout, for operations that must
+// not be repeated.
+func (c runnerCheck) once(name, failReason string, op func(context.Context) error) {
+	retry.Do(op).Named(name).WithinTotal(c.timeout).WithMaxRetries(0).Run(failReason)
+}
+
+// retryWithin runs op until it passes or budget is up. Only the budget bounds
+// the attempts.
+func (c runnerCheck) retryWithin(budget time.Duration, name, failReason string, op func(context.Context) error) {
+	retry.Do(op).Named(name).WithinTotal(budget).WithMaxRetries(math.MaxInt32).AndBackoff(c.retryBackoff).Run(failReason)
+}
+
+// tlsEndpoints are the instance's TLS port and its sentinels' TLS ports.
+func (c runnerCheck) tlsEndpoints() []credentials.HostPort {
+	var endpoints []credentials.HostPort
+	if c.creds.Host != "" && c.creds.TLSPort > 0 {
+		endpoints = append(endpoints, credentials.HostPort{Host: c.creds.Host, TLSPort: c.creds.TLSPort})
+	}
+	for _, sentinel := range c.creds.Sentinels {
+		if sentinel.TLSPort > 0 {
+			endpoints = append(endpoints, credentials.HostPort{Host: sentinel.Host, TLSPort: sentinel.TLSPort})
+		}
+	}
+	return endpoints
+}
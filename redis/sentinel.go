@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+)
+
+// sentinelTimeout bounds asking one sentinel about its master.
+const sentinelTimeout = 10 * time.Second
+
+// DiscoverNodes asks each of the sentinels in creds in turn, until one
+// answers, for the master it monitors as creds.MasterName and its replicas.
+func DiscoverNodes(ctx context.Context, creds credentials.Credentials) (credentials.HostPort, []credentials.HostPort, error) {
+	if creds.MasterName == "" {
+		return credentials.HostPort{}, nil, errors.New("the credentials list sentinels but no master_name")
+	}
+
+	var errs []error
+	for _, sentinel := range creds.Sentinels {
+		sentinelCtx, cancel := context.WithTimeout(ctx, sentinelTimeout)
+		master, replicas, err := SentinelNodes(sentinelCtx, sentinel, creds.MasterName, TLSConfig(creds, sentinel.Host))
+		cancel()
+		if err == nil {
+			return master, replicas, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return credentials.HostPort{}, nil, fmt.Errorf("no sentinel reported the master %s: %w", creds.MasterName, errors.Join(errs...))
+}
+
+// AgreedMaster asks every sentinel in creds for the master it monitors as
+// creds.MasterName, and fails unless they all report the same one.
+func AgreedMaster(ctx context.Context, creds credentials.Credentials) (credentials.HostPort, error) {
+	if creds.MasterName == "" {
+		return credentials.HostPort{}, errors.New("the credentials list sentinels but no master_name")
+	}
+
+	var (
+		errs     []error
+		reports  []string
+		masters  = map[credentials.HostPort]bool{}
+		reported credentials.HostPort
+	)
+	for _, sentinel := range creds.Sentinels {
+		sentinelCtx, cancel := context.WithTimeout(ctx, sentinelTimeout)
+		master, err := SentinelMaster(sentinelCtx, sentinel, creds.MasterName, TLSConfig(creds, sentinel.Host))
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		reports = append(reports, fmt.Sprintf("%s reports %s", hostPortString(sentinel), hostPortString(master)))
+		masters[master] = true
+		reported = master
+	}
+
+	if len(errs) > 0 {
+		return reported, fmt.Errorf("not every sentinel reported the master %s: %w", creds.MasterName, errors.Join(errs...))
+	}
+	if len(masters) > 1 {
+		return reported, fmt.Errorf("the sentinels disagree on the master %s: %s", creds.MasterName, strings.Join(reports, ", "))
+	}
+	return reported, nil
+}
+
+// SentinelMaster asks a sentinel for the master it monitors as masterName.
+func SentinelMaster(ctx context.Context, sentinel credentials.HostPort, masterName string, tlsConfig *tls.Config) (credentials.HostPort, error) {
+	client, err := dialSentinel(ctx, sentinel, tlsConfig)
+	if err != nil {
+		return credentials.HostPort{}, err
+	}
+	defer client.Close()
+
+	return askMaster(client, sentinel, masterName)
+}
+
+// Failover asks a sentinel to fail over the master it monitors as
+// masterName, without waiting for the replicas to agree.
+func Failover(ctx context.Context, sentinel credentials.HostPort, masterName string, tlsConfig *tls.Config) error {
+	client, err := dialSentinel(ctx, sentinel, tlsConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := client.Do("SENTINEL", "FAILOVER", masterName); err != nil {
+		return fmt.Errorf("sentinel %s refused to fail over %s: %w", sentinel.Host, masterName, err)
+	}
+	return nil
+}
+
+// SentinelNodes asks a sentinel for the master it monitors as masterName and
+// that master's replicas. The sentinel's plain port is used if it has one,
+// otherwise its TLS port with tlsConfig.
+func SentinelNodes(ctx context.Context, sentinel credentials.HostPort, masterName string, tlsConfig *tls.Config) (credentials.HostPort, []credentials.HostPort, error) {
+	client, err := dialSentinel(ctx, sentinel, tlsConfig)
+	if err != nil {
+		return credentials.HostPort{}, nil, err
+	}
+	defer client.Close()
+
+	master, err := askMaster(client, sentinel, masterName)
+	if err != nil {
+		return master, nil, err
+	}
+
+	// "slaves" is understood by every sentinel version; "replicas" only from 5.0
+	reply, err := client.Do("SENTINEL", "slaves", masterName)
+	if err != nil {
+		return master, nil, fmt.Errorf("failed to ask sentinel %s for the replicas of %s: %w", sentinel.Host, masterName, err)
+	}
+
+	var replicas []credentials.HostPort
+	entries, _ := reply.([]interface{})
+	for _, entry := range entries {
+		fields, _ := entry.([]interface{})
+		info := map[string]interface{}{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if key, ok := fields[i].(string); ok {
+				info[key] = fields[i+1]
+			}
+		}
+
+		replica, err := hostPortFromReply(info["ip"], info["port"])
+		if err != nil {
+			return master, nil, err
+		}
+		replicas = append(replicas, replica)
+	}
+
+	return master, replicas, nil
+}
+
+// MasterNode is how the test runner reaches a master reported by the
+// sentinels: over TLS on the reported port if the sentinels use TLS.
+func MasterNode(creds credentials.Credentials, master credentials.HostPort) credentials.HostPort {
+	if creds.IsSentinelTLS() {
+		return credentials.HostPort{Host: master.Host, TLSPort: master.Port}
+	}
+	return master
+}
+
+// DialNode connects to node on its plain port if it has one, otherwise on
+// its TLS port, and authenticates with the password in creds.
+func DialNode(ctx context.Context, creds credentials.Credentials, node credentials.HostPort) (*Client, error) {
+	port, tlsConfig := node.Port, (*tls.Config)(nil)
+	if port == 0 {
+		port, tlsConfig = node.TLSPort, TLSConfig(creds, node.Host)
+	}
+
+	address := net.JoinHostPort(node.Host, strconv.Itoa(port))
+	client, err := Dial(ctx, address, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	if creds.Password != "" {
+		if err := client.Auth(creds.Password); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("AUTH on %s failed: %w", address, err)
+		}
+	}
+	return client, nil
+}
+
+// TLSConfig verifies serverName's certificate against the CA in creds. If
+// there is none, the certificate is not verified, as with the example app.
+func TLSConfig(creds credentials.Credentials, serverName string) *tls.Config {
+	pool := x509.NewCertPool()
+	if creds.CACert == "" || !pool.AppendCertsFromPEM([]byte(creds.CACert)) {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	return &tls.Config{RootCAs: pool, ServerName: serverName}
+}
+
+func hostPortFromReply(host, port interface{}) (credentials.HostPort, error) {
+	h, _ := host.(string)
+	p, _ := port.(string)
+	portNumber, err := strconv.Atoi(p)
+	if h == "" || err != nil {
+		return credentials.HostPort{}, fmt.Errorf("sentinel reported an invalid address %v:%v", host, port)
+	}
+	return credentials.HostPort{Host: h, Port: portNumber}, nil
+}
+
+func dialSentinel(ctx context.Context, sentinel credentials.HostPort, tlsConfig *tls.Config) (*Client, error) {
+	port := sentinel.Port
+	if port == 0 {
+		port = sentinel.TLSPort
+	} else {
+		tlsConfig = nil
+	}
+	client, err := Dial(ctx, net.JoinHostPort(sentinel.Host, strconv.Itoa(port)), tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to sentinel %s: %w", sentinel.Host, err)
+	}
+	return client, nil
+}
+
+func askMaster(client *Client, sentinel credentials.HostPort, masterName string) (credentials.HostPort, error) {
+	reply, err := client.Do("SENTINEL", "get-master-addr-by-name", masterName)
+	if errors.Is(err, ErrNil) {
+		return credentials.HostPort{}, fmt.Errorf("sentinel %s does not monitor master %s", sentinel.Host, masterName)
+	}
+	if err != nil {
+		return credentials.HostPort{}, fmt.Errorf("failed to ask sentinel %s for master %s: %w", sentinel.Host, masterName, err)
+	}
+	address, ok := reply.([]interface{})
+	if !ok || len(address) != 2 {
+		return credentials.HostPort{}, fmt.Errorf("sentinel %s reported an invalid address for master %s", sentinel.Host, masterName)
+	}
+	return hostPortFromReply(address[0], address[1])
+}
+
+func hostPortString(node credentials.HostPort) string {
+	port := node.Port
+	if port == 0 {
+		port = node.TLSPort
+	}
+	return net.JoinHostPort(node.Host, strconv.Itoa(port))
+}
@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+)
+
+// SentinelCheck verifies from the test runner what the sentinels of an
+// instance report about its master, and that they can fail it over.
+type SentinelCheck struct {
+	runnerCheck
+	failoverBudget time.Duration
+}
+
+// NewSentinelCheck reads creds when it runs, so it can be built before the
+// service key is fetched. Writes must resume within failoverBudget of a
+// failover.
+func NewSentinelCheck(creds *credentials.Credentials, timeout, failoverBudget, retryInterval time.Duration) *SentinelCheck {
+	return &SentinelCheck{
+		runnerCheck:    newRunnerCheck(creds, timeout, retryInterval),
+		failoverBudget: failoverBudget,
+	}
+}
+
+// CheckMaster runs VerifyMaster until it passes or the timeout is up.
+func (c *SentinelCheck) CheckMaster() func() {
+	return func() {
+		c.retry("Check the sentinels' master", `{"FailReason": "The sentinels did not agree on a working master"}`, func(ctx context.Context) error {
+			_, err := c.VerifyMaster(ctx)
+			return err
+		})
+	}
+}
+
+// Failover asks a sentinel, once, to fail the master over, then waits up to
+// the failover budget for the sentinels to agree on a new master that
+// accepts a write of key. Asking again would fail over the new master too.
+func (c *SentinelCheck) Failover(key, value string) func() {
+	return func() {
+		var previous credentials.HostPort
+		c.retry("Check the sentinels' master before failing over", `{"FailReason": "The sentinels did not agree on a working master"}`, func(ctx context.Context) error {
+			var err error
+			previous, err = c.VerifyMaster(ctx)
+			return err
+		})
+
+		c.once("Trigger a sentinel failover", `{"FailReason": "Failed to trigger a sentinel failover"}`, func(ctx context.Context) error {
+			return c.askFailover(ctx, previous)
+		})
+
+		c.retryWithin(c.failoverBudget, "Wait for writes on the new master",
+			fmt.Sprintf(`{"FailReason": "Writes did not resume on a new master within %s of the failover"}`, c.failoverBudget),
+			func(ctx context.Context) error {
+				return c.VerifyFailedOver(ctx, previous, key, value)
+			},
+		)
+	}
+}
+
+// VerifyMaster checks every sentinel reports the same master, and that the
+// master answers ROLE as one.
+func (c *SentinelCheck) VerifyMaster(ctx context.Context) (credentials.HostPort, error) {
+	master, err := AgreedMaster(ctx, *c.creds)
+	if err != nil {
+		return master, err
+	}
+
+	client, err := DialNode(ctx, *c.creds, MasterNode(*c.creds, master))
+	if err != nil {
+		return master, err
+	}
+	defer client.Close()
+
+	role, err := client.Role()
+	if err != nil {
+		return master, fmt.Errorf("ROLE on %s failed: %w", hostPortString(master), err)
+	}
+	if role != "master" {
+		return master, fmt.Errorf("the sentinels report %s as the master, but its role is %s", hostPortString(master), role)
+	}
+
+	fmt.Printf("The sentinels agree on the master %s\n", hostPortString(master))
+	return master, nil
+}
+
+// TriggerFailover asks the first sentinel that accepts to fail over the
+// master, and returns the master before the failover.
+func (c *SentinelCheck) TriggerFailover(ctx context.Context) (credentials.HostPort, error) {
+	master, err := c.VerifyMaster(ctx)
+	if err != nil {
+		return master, err
+	}
+	return master, c.askFailover(ctx, master)
+}
+
+// askFailover asks each sentinel in turn to fail over master, until one
+// accepts.
+func (c *SentinelCheck) askFailover(ctx context.Context, master credentials.HostPort) error {
+	var errs []error
+	for _, sentinel := range c.creds.Sentinels {
+		sentinelCtx, cancel := context.WithTimeout(ctx, sentinelTimeout)
+		err := Failover(sentinelCtx, sentinel, c.creds.MasterName, TLSConfig(*c.creds, sentinel.Host))
+		cancel()
+		if err == nil {
+			fmt.Printf("Sentinel %s is failing over the master %s\n", hostPortString(sentinel), hostPortString(master))
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyFailedOver checks the sentinels agree on a master other than
+// previous, and that key can be written to and read back from it.
+func (c *SentinelCheck) VerifyFailedOver(ctx context.Context, previous credentials.HostPort, key, value string) error {
+	master, err := c.VerifyMaster(ctx)
+	if err != nil {
+		return err
+	}
+	if master == previous {
+		return fmt.Errorf("the sentinels still report %s as the master", hostPortString(master))
+	}
+
+	client, err := DialNode(ctx, *c.creds, MasterNode(*c.creds, master))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Set(key, value); err != nil {
+		return fmt.Errorf("SET on the new master %s failed: %w", hostPortString(master), err)
+	}
+	actual, err := client.Get(key)
+	if err != nil {
+		return fmt.Errorf("GET on the new master %s failed: %w", hostPortString(master), err)
+	}
+	if actual != value {
+		return fmt.Errorf("GET on the new master %s returned %q, expected %q", hostPortString(master), actual, value)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package redis_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+var _ = Describe("SentinelCheck", func() {
+	var (
+		master, replica         *fakeServer
+		sentinels               []*fakeServer
+		masterNode, replicaNode credentials.HostPort
+		creds                   credentials.Credentials
+		check                   *redis.SentinelCheck
+	)
+
+	withTimeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		DeferCleanup(cancel)
+		return ctx
+	}
+
+	// promote swaps the master and replica, as the sentinels would.
+	promote := func(string) {
+		master.SetRole("slave")
+		replica.SetRole("master")
+		for _, sentinel := range sentinels {
+			sentinel.Monitor("mymaster", replicaNode, masterNode)
+		}
+	}
+
+	BeforeEach(func() {
+		master = startServer("secret", nil)
+		DeferCleanup(master.Close)
+		replica = startServer("secret", nil)
+		DeferCleanup(replica.Close)
+		replica.SetRole("slave")
+
+		masterNode = credentials.HostPort{Host: "127.0.0.1", Port: master.Port()}
+		replicaNode = credentials.HostPort{Host: "127.0.0.1", Port: replica.Port()}
+
+		sentinels = nil
+		creds = credentials.Credentials{Password: "secret", MasterName: "mymaster"}
+		for i := 0; i < 3; i++ {
+			sentinel := startServer("", nil)
+			DeferCleanup(sentinel.Close)
+			sentinel.Monitor("mymaster", masterNode, replicaNode)
+			sentinels = append(sentinels, sentinel)
+			creds.Sentinels = append(creds.Sentinels, credentials.HostPort{Host: "127.0.0.1", Port: sentinel.Port()})
+		}
+
+		check = redis.NewSentinelCheck(&creds, time.Second, 2*time.Second, 10*time.Millisecond)
+	})
+
+	Describe("VerifyMaster", func() {
+		It("returns the master every sentinel reports", func() {
+			Expect(check.VerifyMaster(withTimeout())).To(Equal(masterNode))
+			Expect(master.Commands()).To(Equal([]string{"AUTH", "ROLE"}))
+		})
+
+		It("fails when the sentinels disagree", func() {
+			sentinels[2].Monitor("mymaster", replicaNode)
+
+			_, err := check.VerifyMaster(withTimeout())
+			Expect(err).To(MatchError(ContainSubstring("the sentinels disagree on the master mymaster")))
+			Expect(err).To(MatchError(ContainSubstring(replica.Address())))
+		})
+
+		It("fails when a sentinel does not answer", func() {
+			sentinels[1].Close()
+
+			_, err := check.VerifyMaster(withTimeout())
+			Expect(err).To(MatchError(ContainSubstring("not every sentinel reported the master mymaster")))
+		})
+
+		It("fails when the reported master is not a master", func() {
+			master.SetRole("slave")
+
+			_, err := check.VerifyMaster(withTimeout())
+			Expect(err).To(MatchError(ContainSubstring("its role is slave")))
+		})
+	})
+
+	Describe("failing over", func() {
+		It("waits for the sentinels to agree on a new master that accepts writes", func() {
+			sentinels[0].OnFailover(func(masterName string) {
+				go func() {
+					time.Sleep(100 * time.Millisecond)
+					promote(masterName)
+				}()
+			})
+
+			previous, err := check.TriggerFailover(withTimeout())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(previous).To(Equal(masterNode))
+
+			Expect(check.VerifyFailedOver(withTimeout(), previous, "failoverkey", "after")).To(MatchError(ContainSubstring("still report")))
+			Eventually(func() error {
+				return check.VerifyFailedOver(withTimeout(), previous, "failoverkey", "after")
+			}).Should(Succeed())
+
+			Expect(replica.Data()).To(HaveKeyWithValue("failoverkey", "after"))
+		})
+
+		It("runs the whole failover as a step", func() {
+			sentinels[0].OnFailover(promote)
+
+			Expect(check.Failover("failoverkey", "after")).NotTo(Panic())
+			Expect(replica.Data()).To(HaveKeyWithValue("failoverkey", "after"))
+		})
+
+		It("waits for the failover budget, not a number of attempts", func() {
+			sentinels[0].OnFailover(func(masterName string) {
+				replica.FailNext(15, "LOADING Redis is loading the dataset in memory")
+				promote(masterName)
+			})
+
+			Expect(check.Failover("failoverkey", "after")).NotTo(Panic())
+			Expect(replica.Data()).To(HaveKeyWithValue("failoverkey", "after"))
+		})
+
+		It("asks the sentinels to fail over once while it waits for writes to resume", func() {
+			var failovers atomic.Int32
+			for _, sentinel := range sentinels {
+				sentinel.OnFailover(func(masterName string) {
+					failovers.Add(1)
+					replica.FailNext(15, "LOADING Redis is loading the dataset in memory")
+					promote(masterName)
+				})
+			}
+
+			Expect(check.Failover("failoverkey", "after")).NotTo(Panic())
+			Expect(failovers.Load()).To(BeEquivalentTo(1))
+		})
+
+		It("asks the next sentinel when one refuses", func() {
+			sentinels[0].Monitor("mymaster", masterNode)
+			sentinels[1].OnFailover(promote)
+
+			_, err := check.TriggerFailover(withTimeout())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sentinels[1].Commands()).To(ContainElement("SENTINEL"))
+		})
+
+		It("fails when no sentinel can promote a replica", func() {
+			for _, sentinel := range sentinels {
+				sentinel.Monitor("mymaster", masterNode)
+			}
+
+			_, err := check.TriggerFailover(withTimeout())
+			Expect(err).To(MatchError(ContainSubstring("NOGOODSLAVE")))
+		})
+	})
+})
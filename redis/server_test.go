@@ -0,0 +1,277 @@
+package redis_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+// fakeServer answers the RESP commands the redis package sends, as a Redis
+// server with requirepass, or as a sentinel monitoring masters.
+type fakeServer struct {
+	listener net.Listener
+	password string
+
+	lock     sync.Mutex
+	role     string
+	data     map[string]string
+	masters  map[string]credentials.HostPort
+	replicas map[string][]credentials.HostPort
+	failover func(masterName string)
+	failures int
+	failure  string
+	commands []string
+}
+
+func startServer(password string, tlsConfig *tls.Config) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	s := &fakeServer{
+		listener: listener,
+		password: password,
+		role:     "master",
+		data:     map[string]string{},
+		masters:  map[string]credentials.HostPort{},
+		replicas: map[string][]credentials.HostPort{},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) Port() int { return s.listener.Addr().(*net.TCPAddr).Port }
+
+func (s *fakeServer) Address() string { return s.listener.Addr().String() }
+
+func (s *fakeServer) Close() { s.listener.Close() }
+
+// SetRole changes the role ROLE answers with. Replicas refuse writes.
+func (s *fakeServer) SetRole(role string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.role = role
+}
+
+// OnFailover is called, without the server's lock held, when the server is
+// asked as a sentinel to fail masterName over.
+func (s *fakeServer) OnFailover(failover func(masterName string)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failover = failover
+}
+
+// FailNext answers the next n commands with the error reply message, e.g.
+// "LOADING Redis is loading the dataset in memory".
+func (s *fakeServer) FailNext(n int, message string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures, s.failure = n, message
+}
+
+// Monitor makes the server answer sentinel queries about masterName.
+func (s *fakeServer) Monitor(masterName string, master credentials.HostPort, replicas ...credentials.HostPort) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.masters[masterName] = master
+	s.replicas[masterName] = replicas
+}
+
+func (s *fakeServer) Data() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data := map[string]string{}
+	for key, value := range s.data {
+		data[key] = value
+	}
+	return data
+}
+
+// Commands lists the commands received, without their arguments.
+func (s *fakeServer) Commands() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := s.password == ""
+
+	for {
+		request, err := redis.ReadReply(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range request.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+		command := strings.ToUpper(args[0])
+
+		s.lock.Lock()
+		s.commands = append(s.commands, command)
+		failover := s.failover
+		var reply string
+		switch {
+		case s.failures > 0:
+			s.failures--
+			reply = fmt.Sprintf("-%s\r\n", s.failure)
+		case command == "AUTH":
+			authenticated = len(args) == 2 && args[1] == s.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid username-password pair or user is disabled.\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = s.reply(command, args[1:])
+		}
+		s.lock.Unlock()
+
+		if command == "SENTINEL" && strings.ToLower(args[1]) == "failover" && reply == "+OK\r\n" && failover != nil {
+			failover(args[2])
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) reply(command string, args []string) string {
+	switch command {
+	case "PING":
+		return "+PONG\r\n"
+	case "ROLE":
+		return fmt.Sprintf("*1\r\n%s", bulkString(s.role))
+	case "SET":
+		if s.role != "master" {
+			return "-READONLY You can't write against a read only replica.\r\n"
+		}
+		s.data[args[0]] = args[1]
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.data[args[0]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulkString(value)
+	case "INFO":
+		return bulkString("# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n")
+	case "SENTINEL":
+		return s.sentinelReply(strings.ToLower(args[0]), args[1:])
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", command)
+}
+
+func (s *fakeServer) sentinelReply(subcommand string, args []string) string {
+	master, ok := s.masters[args[0]]
+	switch {
+	case subcommand == "get-master-addr-by-name" && !ok:
+		return "*-1\r\n"
+	case subcommand == "get-master-addr-by-name":
+		return redis.EncodeCommand(master.Host, fmt.Sprint(master.Port))
+	case subcommand == "slaves" && !ok:
+		return "-ERR No such master with that name\r\n"
+	case subcommand == "failover" && !ok:
+		return "-ERR No such master with that name\r\n"
+	case subcommand == "failover" && len(s.replicas[args[0]]) == 0:
+		return "-NOGOODSLAVE No suitable replica to promote\r\n"
+	case subcommand == "failover":
+		return "+OK\r\n"
+	case subcommand == "slaves":
+		reply := fmt.Sprintf("*%d\r\n", len(s.replicas[args[0]]))
+		for _, replica := range s.replicas[args[0]] {
+			reply += redis.EncodeCommand("name", fmt.Sprintf("%s:%d", replica.Host, replica.Port), "ip", replica.Host, "port", fmt.Sprint(replica.Port))
+		}
+		return reply
+	}
+	return fmt.Sprintf("-ERR unknown sentinel subcommand '%s'\r\n", subcommand)
+}
+
+func bulkString(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// serverTLS returns a server config with a certificate for 127.0.0.1 and
+// the PEM of the self-signed CA that issued it.
+func serverTLS() (*tls.Config, string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	ca, err := x509.ParseCertificate(caDER)
+	Expect(err).NotTo(HaveOccurred())
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "redis"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return config, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+}
+
+// startSilentListener accepts connections and never answers.
+func startSilentListener() net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return listener
+}
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// tlsVersions are the versions handshakes are tried at, by the names service
+// keys list them under.
+var tlsVersions = []struct {
+	name    string
+	version uint16
+}{
+	{"tlsv1", tls.VersionTLS10},
+	{"tlsv1.1", tls.VersionTLS11},
+	{"tlsv1.2", tls.VersionTLS12},
+	{"tlsv1.3", tls.VersionTLS13},
+}
+
+// Handshake is the outcome of a handshake at one TLS version.
+type Handshake struct {
+	Version  string
+	Accepted bool
+	// CipherSuite is the suite negotiated, if the version was accepted.
+	CipherSuite string
+	// WeakCipherSuites are the suites crypto/tls considers insecure that the
+	// server accepted at this version.
+	WeakCipherSuites []string
+}
+
+// Handshakes tries a handshake with address at each TLS version. Only
+// failing to connect at all is an error; a refused handshake is reported as
+// a version not accepted. Certificates are not verified.
+func Handshakes(ctx context.Context, address string) ([]Handshake, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var handshakes []Handshake
+	for _, v := range tlsVersions {
+		handshake := Handshake{Version: v.name}
+
+		state, err := handshakeAt(ctx, address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+			MinVersion:         v.version,
+			MaxVersion:         v.version,
+		})
+		if err != nil {
+			if !errors.Is(err, errHandshake) {
+				return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+			}
+			handshakes = append(handshakes, handshake)
+			continue
+		}
+		handshake.Accepted = true
+		handshake.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+
+		for _, suite := range tls.InsecureCipherSuites() {
+			if !supportsVersion(suite, v.version) {
+				continue
+			}
+			_, err := handshakeAt(ctx, address, &tls.Config{
+				ServerName:         host,
+				InsecureSkipVerify: true,
+				MinVersion:         v.version,
+				MaxVersion:         v.version,
+				CipherSuites:       []uint16{suite.ID},
+			})
+			if err == nil {
+				handshake.WeakCipherSuites = append(handshake.WeakCipherSuites, suite.Name)
+			}
+		}
+
+		handshakes = append(handshakes, handshake)
+	}
+	return handshakes, nil
+}
+
+// errHandshake wraps errors from the handshake itself, as opposed to the
+// connection.
+var errHandshake = errors.New("handshake failed")
+
+func handshakeAt(ctx context.Context, address string, config *tls.Config) (tls.ConnectionState, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	client := tls.Client(conn, config)
+	if err := client.HandshakeContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return tls.ConnectionState{}, err
+		}
+		return tls.ConnectionState{}, fmt.Errorf("%w: %w", errHandshake, err)
+	}
+	return client.ConnectionState(), nil
+}
+
+func supportsVersion(suite *tls.CipherSuite, version uint16) bool {
+	for _, supported := range suite.SupportedVersions {
+		if supported == version {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSCheck verifies from the test runner which TLS versions an instance
+// accepts.
+type TLSCheck struct {
+	runnerCheck
+}
+
+// NewTLSCheck reads creds when it runs, so it can be built before the
+// service key is fetched.
+func NewTLSCheck(creds *credentials.Credentials, timeout, retryInterval time.Duration) *TLSCheck {
+	return &TLSCheck{newRunnerCheck(creds, timeout, retryInterval)}
+}
+
+// Check runs Verify until it passes or the timeout is up.
+func (c *TLSCheck) Check() func() {
+	return func() {
+		c.retry("Check TLS versions", `{"FailReason": "The instance's TLS ports do not accept exactly the TLS versions in the service key"}`, c.Verify)
+	}
+}
+
+// Verify handshakes at each TLS version with the instance's TLS port and
+// its sentinels' TLS ports. Each must accept exactly the versions in the
+// service key. The negotiated and any weak cipher suites are printed. A key
+// that lists no versions has nothing to compare against, so the handshakes
+// are only printed.
+func (c *TLSCheck) Verify(ctx context.Context) error {
+	endpoints := c.tlsEndpoints()
+	if len(endpoints) == 0 {
+		return retry.Permanent(errors.New("the service key has no TLS ports"))
+	}
+	compare := len(c.creds.TLSVersions) > 0
+	if !compare {
+		fmt.Println("The service key lists no tls_versions, so the accepted versions are only reported")
+	}
+
+	var errs []error
+	for _, endpoint := range endpoints {
+		address := hostPortString(endpoint)
+		handshakes, err := Handshakes(ctx, address)
+		if err != nil {
+			return err
+		}
+
+		for _, handshake := range handshakes {
+			listed := c.creds.HasTLSVersion(handshake.Version)
+			switch {
+			case handshake.Accepted:
+				fmt.Printf("%s accepts %s with %s\n", address, strings.ToUpper(handshake.Version), handshake.CipherSuite)
+			default:
+				fmt.Printf("%s refuses %s\n", address, strings.ToUpper(handshake.Version))
+			}
+			if len(handshake.WeakCipherSuites) > 0 {
+				fmt.Printf("WARNING: %s accepts weak cipher suites at %s: %s\n", address, strings.ToUpper(handshake.Version), strings.Join(handshake.WeakCipherSuites, ", "))
+			}
+
+			if !compare {
+				continue
+			}
+			if handshake.Accepted && !listed {
+				errs = append(errs, fmt.Errorf("%s accepts %s, which the service key does not list", address, handshake.Version))
+			}
+			if !handshake.Accepted && listed {
+				errs = append(errs, fmt.Errorf("%s refuses %s, which the service key lists", address, handshake.Version))
+			}
+		}
+	}
+	return retry.Permanent(errors.Join(errs...))
+}
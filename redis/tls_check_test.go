@@ -0,0 +1,144 @@
+package redis_test
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/credentials"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+)
+
+var _ = Describe("TLS handshakes", func() {
+	withTimeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		DeferCleanup(cancel)
+		return ctx
+	}
+
+	// startTLSServer listens with TLS versions from min to max.
+	startTLSServer := func(min, max uint16, cipherSuites ...uint16) *fakeServer {
+		config, _ := serverTLS()
+		config.MinVersion = min
+		config.MaxVersion = max
+		config.CipherSuites = cipherSuites
+		server := startServer("", config)
+		DeferCleanup(server.Close)
+		return server
+	}
+
+	accepted := func(handshakes []redis.Handshake) []string {
+		var versions []string
+		for _, handshake := range handshakes {
+			if handshake.Accepted {
+				versions = append(versions, handshake.Version)
+			}
+		}
+		return versions
+	}
+
+	Describe("Handshakes", func() {
+		It("reports the versions the server accepts and the suites negotiated", func() {
+			server := startTLSServer(tls.VersionTLS12, tls.VersionTLS13)
+
+			handshakes, err := redis.Handshakes(withTimeout(), server.Address())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(accepted(handshakes)).To(Equal([]string{"tlsv1.2", "tlsv1.3"}))
+			Expect(handshakes[3].CipherSuite).To(HavePrefix("TLS_AES_"))
+			Expect(handshakes[0].CipherSuite).To(BeEmpty())
+		})
+
+		It("tries the versions older than TLS 1.2", func() {
+			server := startTLSServer(tls.VersionTLS10, tls.VersionTLS11)
+
+			handshakes, err := redis.Handshakes(withTimeout(), server.Address())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(accepted(handshakes)).To(Equal([]string{"tlsv1", "tlsv1.1"}))
+		})
+
+		It("lists the weak cipher suites the server accepts", func() {
+			server := startTLSServer(tls.VersionTLS12, tls.VersionTLS12,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+			)
+
+			handshakes, err := redis.Handshakes(withTimeout(), server.Address())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(handshakes[2].CipherSuite).To(Equal("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"))
+			Expect(handshakes[2].WeakCipherSuites).To(Equal([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256"}))
+		})
+
+		It("fails when nothing listens", func() {
+			server := startTLSServer(tls.VersionTLS12, tls.VersionTLS13)
+			server.Close()
+
+			_, err := redis.Handshakes(withTimeout(), server.Address())
+			Expect(err).To(MatchError(ContainSubstring("failed to connect to " + server.Address())))
+		})
+	})
+
+	Describe("TLSCheck", func() {
+		var (
+			instance, sentinel *fakeServer
+			creds              credentials.Credentials
+			check              *redis.TLSCheck
+		)
+
+		BeforeEach(func() {
+			instance = startTLSServer(tls.VersionTLS12, tls.VersionTLS13)
+			sentinel = startTLSServer(tls.VersionTLS12, tls.VersionTLS13)
+
+			creds = credentials.Credentials{
+				Host:        "127.0.0.1",
+				Port:        6379,
+				TLSPort:     instance.Port(),
+				TLSVersions: []string{"tlsv1.2", "tlsv1.3"},
+				Sentinels:   []credentials.HostPort{{Host: "127.0.0.1", Port: 26379, TLSPort: sentinel.Port()}},
+			}
+			check = redis.NewTLSCheck(&creds, time.Second, 10*time.Millisecond)
+		})
+
+		It("passes when every TLS port accepts exactly the listed versions", func() {
+			Expect(check.Verify(withTimeout())).To(Succeed())
+		})
+
+		It("fails for versions accepted but not listed", func() {
+			creds.TLSVersions = []string{"tlsv1.3"}
+
+			err := check.Verify(withTimeout())
+			Expect(err).To(MatchError(ContainSubstring(instance.Address() + " accepts tlsv1.2, which the service key does not list")))
+			Expect(err).To(MatchError(ContainSubstring(sentinel.Address() + " accepts tlsv1.2, which the service key does not list")))
+		})
+
+		It("fails for versions listed but refused", func() {
+			creds.TLSVersions = []string{"tlsv1.1", "tlsv1.2", "tlsv1.3"}
+
+			Expect(check.Verify(withTimeout())).To(MatchError(ContainSubstring(instance.Address() + " refuses tlsv1.1, which the service key lists")))
+		})
+
+		It("only reports the handshakes when the service key lists no versions", func() {
+			creds.TLSVersions = nil
+
+			Expect(check.Verify(withTimeout())).To(Succeed())
+		})
+
+		It("checks sentinel TLS ports when the instance has none", func() {
+			creds.TLSPort = 0
+			sentinel.Close()
+			sentinel = startTLSServer(tls.VersionTLS13, tls.VersionTLS13)
+			creds.Sentinels[0].TLSPort = sentinel.Port()
+
+			Expect(check.Verify(withTimeout())).To(MatchError(ContainSubstring(sentinel.Address() + " refuses tlsv1.2")))
+		})
+
+		It("fails when the service key has no TLS ports", func() {
+			creds.TLSPort = 0
+			creds.Sentinels = nil
+
+			Expect(check.Verify(withTimeout())).To(MatchError("the service key has no TLS ports"))
+		})
+	})
+})
@@ -0,0 +1,119 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+type Backoff func(retryCount uint) time.Duration
+
+func None(baseline time.Duration) Backoff {
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			return 0
+		}
+
+		return baseline
+	}
+}
+
+func Linear(baseline time.Duration) Backoff {
+	return func(retryCount uint) time.Duration {
+		return time.Duration(retryCount) * baseline
+	}
+}
+
+func Exponential(baseline time.Duration) Backoff {
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			return 0
+		}
+
+		return time.Duration(math.Pow(2, float64(retryCount))) * baseline
+	}
+}
+
+// FullJitter sleeps a random duration between zero and the exponential
+// backoff for the retry, so that parallel callers spread out rather than
+// retrying in lockstep. Pass a seeded rng for a reproducible schedule; a
+// given rng must not be shared between goroutines.
+func FullJitter(baseline time.Duration, rng ...*rand.Rand) Backoff {
+	random := randomSource(rng)
+
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			return 0
+		}
+
+		return time.Duration(random(int64(exponentialCeiling(baseline, retryCount))))
+	}
+}
+
+// DecorrelatedJitter sleeps a random duration between baseline and three
+// times the previous sleep, never more than max. The schedule restarts
+// whenever it is asked for retry zero.
+func DecorrelatedJitter(baseline, max time.Duration, rng ...*rand.Rand) Backoff {
+	random := randomSource(rng)
+	previous := baseline
+
+	return func(retryCount uint) time.Duration {
+		if retryCount == 0 {
+			previous = baseline
+			return 0
+		}
+
+		upper := previous * 3
+		if upper < previous || upper > max {
+			upper = max
+		}
+
+		sleep := baseline
+		if upper > baseline {
+			sleep += time.Duration(random(int64(upper - baseline)))
+		}
+		if sleep > max {
+			sleep = max
+		}
+
+		previous = sleep
+		return sleep
+	}
+}
+
+// Capped limits any backoff to at most max per retry.
+func Capped(b Backoff, max time.Duration) Backoff {
+	return func(retryCount uint) time.Duration {
+		if d := b(retryCount); d < max {
+			return d
+		}
+
+		return max
+	}
+}
+
+// exponentialCeiling is baseline * 2^retryCount, saturating rather than
+// overflowing for large retry counts.
+func exponentialCeiling(baseline time.Duration, retryCount uint) time.Duration {
+	if baseline <= 0 {
+		return 0
+	}
+	if retryCount >= 63 || baseline > math.MaxInt64>>retryCount {
+		return math.MaxInt64
+	}
+
+	return baseline << retryCount
+}
+
+func randomSource(rng []*rand.Rand) func(n int64) int64 {
+	return func(n int64) int64 {
+		if n <= 0 {
+			return 0
+		}
+		if len(rng) > 0 && rng[0] != nil {
+			return rng[0].Int64N(n)
+		}
+
+		return rand.Int64N(n)
+	}
+}
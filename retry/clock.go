@@ -0,0 +1,173 @@
+package retry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for retry loops and reporter steps. Tests can
+// swap in a FakeClock to run long schedules instantly.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// SleepContext is Sleep that returns early, with false, once ctx is done.
+	SleepContext(ctx context.Context, d time.Duration) bool
+	// After returns a channel that receives once d has passed. Once ctx is
+	// done the wait is dropped and the channel never receives.
+	After(ctx context.Context, d time.Duration) <-chan time.Time
+}
+
+// RealClock is the wall clock.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) SleepContext(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (realClock) After(ctx context.Context, d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	timer := time.AfterFunc(d, func() { ch <- time.Now() })
+	context.AfterFunc(ctx, func() { timer.Stop() })
+	return ch
+}
+
+// FakeClock only moves when it is told to. Sleep advances it by the requested
+// duration straight away and records the duration, so a backoff schedule can
+// be asserted exactly. Session timeouts only fire when the clock is advanced,
+// so sessions used with a FakeClock must exit on their own.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	sleeps  []time.Duration
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.lock.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.lock.Unlock()
+
+	c.Advance(d)
+}
+
+func (c *FakeClock) SleepContext(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	c.Sleep(d)
+	return true
+}
+
+// After returns a channel that receives once the clock has been advanced by
+// at least d. The waiter is forgotten once ctx is done.
+func (c *FakeClock) After(ctx context.Context, d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	waiter := &fakeWaiter{until: c.now.Add(d), ch: ch}
+	c.waiters = append(c.waiters, waiter)
+	context.AfterFunc(ctx, func() { c.forget(waiter) })
+	return ch
+}
+
+func (c *FakeClock) forget(waiter *fakeWaiter) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, w := range c.waiters {
+		if w == waiter {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Waiters returns how many channels from After have yet to fire.
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d, firing any channels from After that
+// are now due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.Slice(c.waiters, func(i, j int) bool {
+		return c.waiters[i].until.Before(c.waiters[j].until)
+	})
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Sleeps returns every duration passed to Sleep, in order.
+func (c *FakeClock) Sleeps() []time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+func clockOrReal(c Clock) Clock {
+	if c == nil {
+		return RealClock
+	}
+	return c
+}
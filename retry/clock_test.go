@@ -0,0 +1,81 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Clock", func() {
+	var (
+		clock *retry.FakeClock
+		start = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+		err   = errors.New("not yet")
+	)
+
+	BeforeEach(func() {
+		clock = retry.NewFakeClock(start)
+		failed = false
+		failMsg = ""
+	})
+
+	It("sleeps the exact backoff schedule without waiting", func() {
+		retry.Do(func(ctx context.Context) error {
+			return err
+		}).WithClock(clock).WithMaxRetries(10).AndBackoff(retry.Exponential(time.Second)).AndFailHandler(failHandler).Run()
+
+		sleeps := clock.Sleeps()
+		Expect(sleeps).To(HaveLen(11))
+		Expect(sleeps[0]).To(BeZero())
+		Expect(sleeps[10]).To(Equal(1024 * time.Second))
+		Expect(clock.Now()).To(Equal(start.Add(2046 * time.Second)))
+	})
+
+	It("enforces the time budget on the fake clock", func() {
+		outcome := retry.Do(func(ctx context.Context) error {
+			return err
+		}).WithClock(clock).WithMaxRetries(100).AndBackoff(retry.None(time.Minute)).WithinTotal(10 * time.Minute).AndFailHandler(failHandler).Run()
+
+		Expect(outcome.Reason).To(Equal(retry.DeadlineExceeded))
+		Expect(outcome.Attempts).To(HaveLen(10))
+		Expect(clock.Now()).To(Equal(start.Add(10 * time.Minute)))
+	})
+
+	It("times sessions with the fake clock", func() {
+		outcome := retry.Session(failureFn).WithClock(clock).WithMaxRetries(2).AndBackoff(retry.Linear(time.Hour)).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+		Expect(clock.Sleeps()).To(Equal([]time.Duration{0, time.Hour, 2 * time.Hour}))
+		Expect(outcome.Attempts[2].Start).To(Equal(start.Add(3 * time.Hour)))
+		Expect(outcome.Attempts[2].Duration).To(BeZero())
+	})
+
+	Describe("FakeClock", func() {
+		It("fires After once advanced far enough", func() {
+			ch := clock.After(context.Background(), time.Minute)
+
+			clock.Advance(30 * time.Second)
+			Consistently(ch).ShouldNot(Receive())
+
+			clock.Advance(30 * time.Second)
+			Eventually(ch).Should(Receive(Equal(start.Add(time.Minute))))
+			Expect(clock.Waiters()).To(BeZero())
+		})
+
+		It("forgets After waiters once their context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := clock.After(ctx, time.Minute)
+			Expect(clock.Waiters()).To(Equal(1))
+
+			cancel()
+			Eventually(clock.Waiters).Should(BeZero())
+
+			clock.Advance(time.Minute)
+			Consistently(ch).ShouldNot(Receive())
+		})
+	})
+})
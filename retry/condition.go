@@ -0,0 +1,259 @@
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+type Condition func(session *gexec.Session) bool
+
+func Succeeds(session *gexec.Session) bool {
+	return ExitCode(0)(session)
+}
+
+func MatchesOutput(regex *regexp.Regexp) Condition {
+	return Described(fmt.Sprintf("stdout matches %q", regex), func(session *gexec.Session) bool {
+		return regex.Match(session.Out.Contents())
+	})
+}
+
+func MatchesErrorOutput(regex *regexp.Regexp) Condition {
+	return Described(fmt.Sprintf("stderr matches %q", regex), func(session *gexec.Session) bool {
+		return regex.Match(session.Err.Contents())
+	})
+}
+
+func MatchesStdOrErrorOutput(regex *regexp.Regexp) Condition {
+	return Described(fmt.Sprintf("stdout or stderr matches %q", regex), func(session *gexec.Session) bool {
+		return regex.Match(session.Out.Contents()) || regex.Match(session.Err.Contents())
+	})
+}
+
+func ExitCode(code int) Condition {
+	return Described(fmt.Sprintf("exit code %d", code), func(session *gexec.Session) bool {
+		return session.ExitCode() == code
+	})
+}
+
+func OutputContains(substr string) Condition {
+	return Described(fmt.Sprintf("stdout contains %q", substr), func(session *gexec.Session) bool {
+		return bytes.Contains(session.Out.Contents(), []byte(substr))
+	})
+}
+
+// MatchesJSON decodes stdout as JSON and checks that the value at path equals
+// expected. The path is dot separated; numeric segments index into arrays,
+// e.g. "resources.0.last_operation.state".
+func MatchesJSON(path string, expected interface{}) Condition {
+	description := fmt.Sprintf("stdout JSON %s == %v", path, expected)
+	if s, ok := expected.(string); ok {
+		description = fmt.Sprintf("stdout JSON %s == %q", path, s)
+	}
+
+	return Described(description, func(session *gexec.Session) bool {
+		var document interface{}
+		if err := json.Unmarshal(session.Out.Contents(), &document); err != nil {
+			return false
+		}
+
+		actual, ok := lookupJSONPath(document, path)
+		if !ok {
+			return false
+		}
+
+		return reflect.DeepEqual(actual, normaliseJSON(expected))
+	})
+}
+
+// And is met when all of conditions are. When it is not met, the failure
+// message names the conditions that were not.
+func And(conditions ...Condition) Condition {
+	return func(session *gexec.Session) bool {
+		var descriptions []string
+
+		for _, condition := range conditions {
+			met, records := evaluate(condition, session)
+			if !met {
+				for _, r := range records {
+					if !r.met {
+						report(session, r)
+					}
+				}
+				if len(records) == 0 {
+					report(session, expectation{description: unnamedCondition})
+				}
+				return false
+			}
+			descriptions = append(descriptions, describe(records))
+		}
+
+		report(session, expectation{description: strings.Join(descriptions, " and "), met: true})
+		return true
+	}
+}
+
+// Or is met when any of conditions is.
+func Or(conditions ...Condition) Condition {
+	return func(session *gexec.Session) bool {
+		var descriptions []string
+
+		for _, condition := range conditions {
+			met, records := evaluate(condition, session)
+			if met {
+				report(session, expectation{description: describe(records), met: true})
+				return true
+			}
+			descriptions = append(descriptions, describe(records))
+		}
+
+		report(session, expectation{description: "(" + strings.Join(descriptions, " or ") + ")"})
+		return false
+	}
+}
+
+func Not(condition Condition) Condition {
+	return func(session *gexec.Session) bool {
+		met, records := evaluate(condition, session)
+		report(session, expectation{description: "not " + describe(records), met: !met})
+		return !met
+	}
+}
+
+// Described gives c a human-readable description. Failure messages list the
+// descriptions of the conditions that the last attempts did not meet.
+func Described(description string, c Condition) Condition {
+	return func(session *gexec.Session) bool {
+		met, _ := evaluate(c, session)
+		report(session, expectation{description: description, met: met})
+		return met
+	}
+}
+
+const unnamedCondition = "unnamed condition"
+
+// expectation is the result of evaluating a described condition.
+type expectation struct {
+	description string
+	met         bool
+}
+
+// evaluating collects, for each session, what the conditions currently being
+// evaluated against it report. The conditions a condition is built from run
+// on the goroutine evaluating it, so each session has one collector at a time.
+var (
+	evaluatingLock sync.Mutex
+	evaluating     = map[*gexec.Session]*[]expectation{}
+)
+
+// evaluate runs c and returns what it, and the conditions it is built from,
+// reported.
+func evaluate(c Condition, session *gexec.Session) (bool, []expectation) {
+	var records []expectation
+
+	evaluatingLock.Lock()
+	parent, nested := evaluating[session]
+	evaluating[session] = &records
+	evaluatingLock.Unlock()
+
+	defer func() {
+		evaluatingLock.Lock()
+		defer evaluatingLock.Unlock()
+
+		if nested {
+			evaluating[session] = parent
+		} else {
+			delete(evaluating, session)
+		}
+	}()
+
+	met := c(session)
+	return met, records
+}
+
+func report(session *gexec.Session, e expectation) {
+	evaluatingLock.Lock()
+	defer evaluatingLock.Unlock()
+
+	if records, ok := evaluating[session]; ok {
+		*records = append(*records, e)
+	}
+}
+
+// unmetExpectations evaluates c and describes what it did not meet.
+func unmetExpectations(c Condition, session *gexec.Session) (bool, []string) {
+	met, records := evaluate(c, session)
+	if met {
+		return true, nil
+	}
+
+	var unmet []string
+	for _, r := range records {
+		if !r.met {
+			unmet = append(unmet, r.description)
+		}
+	}
+
+	return false, unmet
+}
+
+func describe(records []expectation) string {
+	if len(records) == 0 {
+		return unnamedCondition
+	}
+
+	descriptions := make([]string, len(records))
+	for i, r := range records {
+		descriptions[i] = r.description
+	}
+
+	return strings.Join(descriptions, " and ")
+}
+
+func lookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	current := document
+
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// normaliseJSON round-trips v through encoding/json so that it compares equal
+// to decoded values, e.g. int 1 becomes float64 1.
+func normaliseJSON(v interface{}) interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var normalised interface{}
+	if err := json.Unmarshal(encoded, &normalised); err != nil {
+		return v
+	}
+
+	return normalised
+}
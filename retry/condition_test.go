@@ -0,0 +1,156 @@
+package retry_test
+
+import (
+	"os/exec"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+func ShellSession(script string) *gexec.Session {
+	s, err := gexec.Start(exec.Command("sh", "-c", script), GinkgoWriter, GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	return s.Wait()
+}
+
+var _ = Describe("Condition", func() {
+	var (
+		quotaSession   *gexec.Session
+		lastOpSession  *gexec.Session
+		successSession *gexec.Session
+	)
+
+	BeforeEach(func() {
+		quotaSession = ShellSession("echo FAILED; echo 'plan instance limit exceeded for service'; exit 1")
+		lastOpSession = ShellSession(`echo '{"resources":[{"name":"redis","last_operation":{"type":"create","state":"succeeded"},"count":2}]}'`)
+		successSession = SucceedingSession().Wait()
+	})
+
+	Describe("ExitCode", func() {
+		It("matches the exit code", func() {
+			Expect(retry.ExitCode(1)(quotaSession)).To(BeTrue())
+			Expect(retry.ExitCode(0)(quotaSession)).To(BeFalse())
+		})
+	})
+
+	Describe("OutputContains", func() {
+		It("looks for the text in stdout", func() {
+			Expect(retry.OutputContains("FAILED")(quotaSession)).To(BeTrue())
+			Expect(retry.OutputContains("OK")(quotaSession)).To(BeFalse())
+		})
+	})
+
+	Describe("MatchesJSON", func() {
+		It("checks the value at the path", func() {
+			Expect(retry.MatchesJSON("resources.0.last_operation.state", "succeeded")(lastOpSession)).To(BeTrue())
+			Expect(retry.MatchesJSON("resources.0.count", 2)(lastOpSession)).To(BeTrue())
+			Expect(retry.MatchesJSON("resources.0.last_operation.state", "failed")(lastOpSession)).To(BeFalse())
+		})
+
+		It("is not met for missing paths or invalid JSON", func() {
+			Expect(retry.MatchesJSON("resources.1.name", "redis")(lastOpSession)).To(BeFalse())
+			Expect(retry.MatchesJSON("resources.name", "redis")(lastOpSession)).To(BeFalse())
+			Expect(retry.MatchesJSON("state", "succeeded")(quotaSession)).To(BeFalse())
+		})
+	})
+
+	Describe("combinators", func() {
+		It("combines conditions", func() {
+			quotaReached := retry.And(
+				retry.ExitCode(1),
+				retry.OutputContains("FAILED"),
+				retry.Or(
+					retry.OutputContains("instance limit for this service has been reached"),
+					retry.OutputContains("plan instance limit exceeded for service"),
+				),
+			)
+
+			Expect(quotaReached(quotaSession)).To(BeTrue())
+			Expect(quotaReached(successSession)).To(BeFalse())
+			Expect(retry.Not(quotaReached)(successSession)).To(BeTrue())
+		})
+	})
+
+	Describe("descriptions", func() {
+		BeforeEach(func() {
+			failed = false
+			failMsg = ""
+		})
+
+		untilFails := func(session *gexec.Session, c retry.Condition) retry.Attempt {
+			outcome := retry.Session(func() *gexec.Session { return session }).WithMaxRetries(0).
+				AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(c)
+			Expect(outcome.Succeeded()).To(BeFalse())
+			return outcome.Attempts[0]
+		}
+
+		It("names the unmet conditions of an And", func() {
+			attempt := untilFails(quotaSession, retry.And(retry.OutputContains("FAILED"), retry.Succeeds))
+
+			Expect(attempt.Unmet).To(Equal([]string{"exit code 0"}))
+			Expect(failMsg).To(ContainSubstring("unmet: exit code 0"))
+		})
+
+		It("names every alternative of an Or", func() {
+			attempt := untilFails(quotaSession, retry.Or(retry.Succeeds, retry.MatchesOutput(regexp.MustCompile("create succeeded"))))
+
+			Expect(attempt.Unmet).To(Equal([]string{`(exit code 0 or stdout matches "create succeeded")`}))
+		})
+
+		It("describes a Not", func() {
+			attempt := untilFails(quotaSession, retry.Not(retry.OutputContains("FAILED")))
+
+			Expect(attempt.Unmet).To(Equal([]string{`not stdout contains "FAILED"`}))
+		})
+
+		It("describes JSON conditions", func() {
+			attempt := untilFails(lastOpSession, retry.MatchesJSON("resources.0.last_operation.state", "in progress"))
+
+			Expect(attempt.Unmet).To(Equal([]string{`stdout JSON resources.0.last_operation.state == "in progress"`}))
+		})
+
+		It("uses custom descriptions", func() {
+			attempt := untilFails(successSession, retry.Described("service instance is gone", retry.MatchesErrorOutput(regexp.MustCompile("not found"))))
+
+			Expect(attempt.Unmet).To(Equal([]string{"service instance is gone"}))
+		})
+
+		It("lists each unmet condition of UntilAny", func() {
+			outcome := retry.Session(func() *gexec.Session { return quotaSession }).WithMaxRetries(0).AndFailHandler(failHandler).
+				UntilAny([]retry.Condition{retry.Succeeds, retry.OutputContains("OK")})
+
+			Expect(outcome.Attempts[0].Unmet).To(Equal([]string{"exit code 0", `stdout contains "OK"`}))
+		})
+
+		It("keeps the descriptions of conditions evaluated at once apart", func() {
+			unmet := func(session *gexec.Session, c retry.Condition) []string {
+				outcome := retry.Session(func() *gexec.Session { return session }).WithMaxRetries(0).
+					AndFailHandler(func(string, ...int) {}).Until(c)
+				return outcome.Attempts[0].Unmet
+			}
+
+			done := make(chan []string)
+			for range 20 {
+				go func() {
+					defer GinkgoRecover()
+					done <- unmet(quotaSession, retry.And(retry.OutputContains("FAILED"), retry.Succeeds))
+				}()
+			}
+			for range 20 {
+				Expect(unmet(lastOpSession, retry.Not(retry.MatchesJSON("resources.0.count", 2)))).To(Equal([]string{`not stdout JSON resources.0.count == 2`}))
+				Expect(<-done).To(Equal([]string{"exit code 0"}))
+			}
+		})
+
+		It("leaves plain functions undescribed", func() {
+			attempt := untilFails(successSession, func(*gexec.Session) bool { return false })
+
+			Expect(attempt.Unmet).To(BeEmpty())
+		})
+	})
+})
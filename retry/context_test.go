@@ -0,0 +1,98 @@
+package retry_test
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Context", func() {
+	BeforeEach(func() {
+		attempts = 0
+		failed = false
+		failMsg = ""
+	})
+
+	It("stops sleeping as soon as the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		outcome := retry.Session(failureFn).WithContext(ctx).WithMaxRetries(3).AndBackoff(retry.None(time.Hour)).
+			AndFailHandler(failHandler).Until(retry.Succeeds, "custom message")
+
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		Expect(attempts).To(Equal(1))
+		Expect(outcome.Reason).To(Equal(retry.Interrupted))
+		Expect(failMsg).To(HavePrefix("custom message\nInterrupted after 1 attempts: context canceled"))
+	})
+
+	It("kills the running session when the context is cancelled", func() {
+		var session *gexec.Session
+		sleepFn := func() *gexec.Session {
+			var err error
+			session, err = gexec.Start(exec.Command("sleep", "10"), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			return session
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		outcome := retry.Session(sleepFn).WithContext(ctx).WithSessionTimeout(time.Minute).WithMaxRetries(3).
+			AndFailHandler(failHandler).Until(retry.Succeeds)
+
+		Expect(session.ExitCode()).To(Equal(128 + 15))
+		Expect(outcome.Reason).To(Equal(retry.Interrupted))
+		Expect(outcome.Attempts).To(HaveLen(1))
+		Expect(outcome.Attempts[0].Interrupted).To(BeTrue())
+		Expect(failMsg).To(ContainSubstring("#1 `sleep 10` interrupted"))
+	})
+
+	It("does not start when the context is already done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		outcome := retry.Session(successFn).WithContext(ctx).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+		Expect(attempts).To(BeZero())
+		Expect(outcome.Reason).To(Equal(retry.Interrupted))
+	})
+
+	It("uses the default context when none is given", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		restore := retry.SetDefaultContext(ctx)
+		defer restore()
+
+		outcome := retry.Session(successFn).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+		Expect(outcome.Reason).To(Equal(retry.Interrupted))
+	})
+
+	It("cancels the context passed to Do", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		outcome := retry.Do(func(attemptCtx context.Context) error {
+			<-attemptCtx.Done()
+			return attemptCtx.Err()
+		}).WithContext(ctx).WithMaxRetries(3).AndFailHandler(failHandler).Run()
+
+		Expect(outcome.Reason).To(Equal(retry.Interrupted))
+		Expect(outcome.Attempts).To(HaveLen(1))
+		Expect(outcome.Attempts[0].Interrupted).To(BeTrue())
+	})
+
+	It("accepts ginkgo's SpecContext", func(ctx SpecContext) {
+		outcome := retry.Session(successFn).WithContext(ctx).Until(retry.Succeeds)
+
+		Expect(outcome.Succeeded()).To(BeTrue())
+	})
+})
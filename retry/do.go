@@ -0,0 +1,195 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// opCheck retries a Go function rather than a gexec session. It shares its
+// backoff, retry, deadline and fail handler behaviour with retry.Session.
+type opCheck[T any] struct {
+	policy
+
+	op             func(ctx context.Context) (T, error)
+	attemptTimeout time.Duration
+	name           string
+}
+
+// Do retries op until it returns nil. Wrap an error in Permanent to stop
+// retrying at once.
+func Do(op func(ctx context.Context) error) *opCheck[struct{}] {
+	return Value(func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, op(ctx)
+	})
+}
+
+// Value retries op until it returns a nil error, and hands back the value
+// from that call.
+func Value[T any](op func(ctx context.Context) (T, error)) *opCheck[T] {
+	return &opCheck[T]{
+		policy: defaultPolicy(),
+		op:     op,
+	}
+}
+
+func (oc *opCheck[T]) WithFailHandler(handler failHandler) *opCheck[T] {
+	oc.failHandler = handler
+	return oc
+}
+
+func (oc *opCheck[T]) AndFailHandler(handler failHandler) *opCheck[T] {
+	return oc.WithFailHandler(handler)
+}
+
+// WithAttemptTimeout bounds the context passed to each call of the operation.
+// By default only the deadline, if any, bounds it.
+func (oc *opCheck[T]) WithAttemptTimeout(timeout time.Duration) *opCheck[T] {
+	oc.attemptTimeout = timeout
+	return oc
+}
+
+func (oc *opCheck[T]) AndAttemptTimeout(timeout time.Duration) *opCheck[T] {
+	return oc.WithAttemptTimeout(timeout)
+}
+
+// WithContext is the parent of the context passed to each attempt. The loop
+// stops as soon as ctx is done.
+func (oc *opCheck[T]) WithContext(ctx context.Context) *opCheck[T] {
+	oc.ctx = ctx
+	return oc
+}
+
+// WithClock replaces the wall clock used for sleeps and deadlines.
+func (oc *opCheck[T]) WithClock(clock Clock) *opCheck[T] {
+	oc.clock = clockOrReal(clock)
+	return oc
+}
+
+func (oc *opCheck[T]) WithMaxRetries(max int) *opCheck[T] {
+	oc.maxRetries = max
+	return oc
+}
+
+func (oc *opCheck[T]) AndMaxRetries(max int) *opCheck[T] {
+	return oc.WithMaxRetries(max)
+}
+
+func (oc *opCheck[T]) WithBackoff(b Backoff) *opCheck[T] {
+	oc.backoff = b
+	return oc
+}
+
+func (oc *opCheck[T]) AndBackoff(b Backoff) *opCheck[T] {
+	return oc.WithBackoff(b)
+}
+
+func (oc *opCheck[T]) WithDeadline(deadline time.Time) *opCheck[T] {
+	oc.deadline = deadline
+	return oc
+}
+
+func (oc *opCheck[T]) AndDeadline(deadline time.Time) *opCheck[T] {
+	return oc.WithDeadline(deadline)
+}
+
+func (oc *opCheck[T]) WithinTotal(budget time.Duration) *opCheck[T] {
+	oc.budget = budget
+	return oc
+}
+
+// Named describes the operation in attempt histories, in place of the command
+// line recorded for sessions.
+func (oc *opCheck[T]) Named(name string) *opCheck[T] {
+	oc.name = name
+	return oc
+}
+
+// Run retries the operation and calls the fail handler if it never succeeds.
+func (oc *opCheck[T]) Run(msg ...string) RetryOutcome {
+	_, outcome := oc.Get(msg...)
+	return outcome
+}
+
+// Get is Run for operations that produce a value. The value is the zero value
+// unless the outcome succeeded.
+func (oc *opCheck[T]) Get(msg ...string) (T, RetryOutcome) {
+	var value T
+
+	outcome := oc.loop(func(deadline time.Time) (Attempt, verdict) {
+		ctx, cancel := oc.attemptContext(deadline)
+		defer cancel()
+
+		start := oc.clock.Now()
+		v, err := oc.op(ctx)
+		attempt := Attempt{
+			Command:  oc.name,
+			Start:    start,
+			Duration: oc.clock.Now().Sub(start),
+			TimedOut: errors.Is(err, context.DeadlineExceeded),
+			Err:      err,
+		}
+
+		switch {
+		case err == nil:
+			value = v
+			return attempt, met
+		case oc.context().Err() != nil:
+			attempt.Interrupted = true
+			return attempt, interrupted
+		case IsPermanent(err):
+			return attempt, abort
+		default:
+			return attempt, unmet
+		}
+	})
+
+	oc.finish(outcome, msg)
+	return value, outcome
+}
+
+// attemptContext bounds an attempt by the attempt timeout and the deadline.
+// The deadline is measured on the loop's clock but enforced in real time, as
+// the operation itself runs in real time.
+func (oc *opCheck[T]) attemptContext(deadline time.Time) (context.Context, context.CancelFunc) {
+	timeout := oc.attemptTimeout
+	if !deadline.IsZero() {
+		remaining := deadline.Sub(oc.clock.Now())
+		if timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	if timeout <= 0 && deadline.IsZero() {
+		return context.WithCancel(oc.context())
+	}
+
+	return context.WithTimeout(oc.context(), timeout)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as one that retrying will not fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or any error it wraps, was marked Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
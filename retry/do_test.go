@@ -0,0 +1,113 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Do", func() {
+	var (
+		calls int
+		err   = errors.New("connection refused")
+	)
+
+	BeforeEach(func() {
+		calls = 0
+		failed = false
+		failMsg = ""
+	})
+
+	It("retries until the operation returns nil", func() {
+		outcome := retry.Do(func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return err
+			}
+			return nil
+		}).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Run()
+
+		Expect(calls).To(Equal(3))
+		Expect(outcome.Succeeded()).To(BeTrue())
+		Expect(outcome.Attempts).To(HaveLen(3))
+		Expect(outcome.Attempts[0].Err).To(MatchError(err))
+		Expect(failed).To(BeFalse())
+	})
+
+	It("calls the fail handler with the attempt history", func() {
+		retry.Do(func(ctx context.Context) error {
+			calls++
+			return err
+		}).Named("PING redis").WithMaxRetries(2).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Run("custom message")
+
+		Expect(calls).To(Equal(3))
+		Expect(failed).To(BeTrue())
+		Expect(failMsg).To(HavePrefix("custom message\nExceeded 2 retries\nLast 3 of 3 attempts:"))
+		Expect(failMsg).To(ContainSubstring("#3 `PING redis` failed after"))
+		Expect(failMsg).To(ContainSubstring("connection refused"))
+	})
+
+	It("stops at once on a permanent error", func() {
+		outcome := retry.Do(func(ctx context.Context) error {
+			calls++
+			return retry.Permanent(err)
+		}).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Run()
+
+		Expect(calls).To(Equal(1))
+		Expect(outcome.Reason).To(Equal(retry.Aborted))
+		Expect(retry.IsPermanent(outcome.Attempts[0].Err)).To(BeTrue())
+		Expect(outcome.Attempts[0].Err).To(MatchError(err))
+	})
+
+	It("bounds each attempt's context", func() {
+		outcome := retry.Do(func(ctx context.Context) error {
+			calls++
+			<-ctx.Done()
+			return ctx.Err()
+		}).WithMaxRetries(1).WithAttemptTimeout(10 * time.Millisecond).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Run()
+
+		Expect(calls).To(Equal(2))
+		Expect(outcome.Attempts[1].TimedOut).To(BeTrue())
+		Expect(failMsg).To(ContainSubstring("timed out after"))
+	})
+
+	It("honours the time budget", func() {
+		outcome := retry.Do(func(ctx context.Context) error {
+			calls++
+			return err
+		}).WithMaxRetries(100).AndBackoff(retry.None(20 * time.Millisecond)).WithinTotal(100 * time.Millisecond).AndFailHandler(failHandler).Run()
+
+		Expect(outcome.Reason).To(Equal(retry.DeadlineExceeded))
+		Expect(calls).To(BeNumerically("<", 101))
+	})
+
+	Describe("Value", func() {
+		It("returns the value of the successful call", func() {
+			value, outcome := retry.Value(func(ctx context.Context) (string, error) {
+				calls++
+				if calls < 2 {
+					return "", err
+				}
+				return "PONG", nil
+			}).WithMaxRetries(3).AndBackoff(retry.None(time.Millisecond)).Get()
+
+			Expect(outcome.Succeeded()).To(BeTrue())
+			Expect(value).To(Equal("PONG"))
+		})
+
+		It("returns the zero value when it gives up", func() {
+			value, outcome := retry.Value(func(ctx context.Context) (int, error) {
+				return 42, err
+			}).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Get()
+
+			Expect(outcome.Succeeded()).To(BeFalse())
+			Expect(value).To(BeZero())
+			Expect(failed).To(BeTrue())
+		})
+	})
+})
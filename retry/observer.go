@@ -0,0 +1,79 @@
+package retry
+
+import "time"
+
+// AttemptEvent is passed to OnAttempt hooks after every attempt.
+type AttemptEvent struct {
+	Attempt     Attempt
+	Number      int
+	MaxAttempts int
+	Met         bool
+	// NextSleep is how long the loop will wait before the next attempt. It is
+	// zero when there will be no further attempt.
+	NextSleep time.Duration
+}
+
+// GiveUpEvent is passed to OnGiveUp hooks just before the fail handler is
+// called.
+type GiveUpEvent struct {
+	Outcome RetryOutcome
+	Message string
+}
+
+// Observer receives events from every retry loop, in addition to the hooks
+// registered on individual loops. Either field may be nil.
+type Observer struct {
+	OnAttempt func(AttemptEvent)
+	OnGiveUp  func(GiveUpEvent)
+}
+
+var defaultObserver Observer
+
+// SetDefaultObserver makes o observe every retry loop, until the returned
+// function restores the previous default observer.
+func SetDefaultObserver(o Observer) (restore func()) {
+	previous := defaultObserver
+	defaultObserver = o
+
+	return func() {
+		defaultObserver = previous
+	}
+}
+
+func (rc *retryCheck) OnAttempt(hook func(AttemptEvent)) *retryCheck {
+	rc.onAttempt = append(rc.onAttempt, hook)
+	return rc
+}
+
+func (rc *retryCheck) OnGiveUp(hook func(GiveUpEvent)) *retryCheck {
+	rc.onGiveUp = append(rc.onGiveUp, hook)
+	return rc
+}
+
+func (oc *opCheck[T]) OnAttempt(hook func(AttemptEvent)) *opCheck[T] {
+	oc.onAttempt = append(oc.onAttempt, hook)
+	return oc
+}
+
+func (oc *opCheck[T]) OnGiveUp(hook func(GiveUpEvent)) *opCheck[T] {
+	oc.onGiveUp = append(oc.onGiveUp, hook)
+	return oc
+}
+
+func (p *policy) notifyAttempt(event AttemptEvent) {
+	if defaultObserver.OnAttempt != nil {
+		defaultObserver.OnAttempt(event)
+	}
+	for _, hook := range p.onAttempt {
+		hook(event)
+	}
+}
+
+func (p *policy) notifyGiveUp(event GiveUpEvent) {
+	if defaultObserver.OnGiveUp != nil {
+		defaultObserver.OnGiveUp(event)
+	}
+	for _, hook := range p.onGiveUp {
+		hook(event)
+	}
+}
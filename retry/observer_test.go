@@ -0,0 +1,69 @@
+package retry_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+var _ = Describe("Observer", func() {
+	var (
+		events  []retry.AttemptEvent
+		giveUps []retry.GiveUpEvent
+	)
+
+	BeforeEach(func() {
+		attempts = 0
+		failed = false
+		events = nil
+		giveUps = nil
+	})
+
+	It("reports every attempt with the next sleep", func() {
+		retry.Session(failureFn).WithMaxRetries(2).AndBackoff(retry.Linear(time.Millisecond)).AndFailHandler(failHandler).
+			OnAttempt(func(e retry.AttemptEvent) { events = append(events, e) }).
+			OnGiveUp(func(e retry.GiveUpEvent) { giveUps = append(giveUps, e) }).
+			Until(retry.Succeeds, "custom message")
+
+		Expect(events).To(HaveLen(3))
+		Expect(events[0].Number).To(Equal(1))
+		Expect(events[0].MaxAttempts).To(Equal(3))
+		Expect(events[0].Met).To(BeFalse())
+		Expect(events[0].NextSleep).To(Equal(time.Millisecond))
+		Expect(events[1].NextSleep).To(Equal(2 * time.Millisecond))
+		Expect(events[2].NextSleep).To(BeZero())
+		Expect(events[2].Attempt.Command).To(Equal("ls not-a-file-that-exists"))
+
+		Expect(giveUps).To(HaveLen(1))
+		Expect(giveUps[0].Outcome.Reason).To(Equal(retry.RetriesExhausted))
+		Expect(giveUps[0].Message).To(HavePrefix("custom message"))
+	})
+
+	It("does not report giving up when the condition is met", func() {
+		retry.Session(successFn).WithMaxRetries(2).AndBackoff(retry.None(time.Millisecond)).
+			OnAttempt(func(e retry.AttemptEvent) { events = append(events, e) }).
+			OnGiveUp(func(e retry.GiveUpEvent) { giveUps = append(giveUps, e) }).
+			Until(retry.Succeeds)
+
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Met).To(BeTrue())
+		Expect(events[0].NextSleep).To(BeZero())
+		Expect(giveUps).To(BeEmpty())
+	})
+
+	It("notifies the default observer", func() {
+		restore := retry.SetDefaultObserver(retry.Observer{
+			OnAttempt: func(e retry.AttemptEvent) { events = append(events, e) },
+			OnGiveUp:  func(e retry.GiveUpEvent) { giveUps = append(giveUps, e) },
+		})
+		retry.Session(failureFn).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds)
+		restore()
+		retry.Session(failureFn).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+		Expect(events).To(HaveLen(2))
+		Expect(giveUps).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,182 @@
+package retry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+// maxOutputLength bounds how much of an attempt's stdout and stderr is kept.
+// The tail is kept, since that is where the cf cli reports what went wrong.
+const maxOutputLength = 1024
+
+// historyLength is how many of the most recent attempts a failure message
+// describes.
+const historyLength = 3
+
+// StopReason says why a retry loop stopped.
+type StopReason int
+
+const (
+	ConditionMet StopReason = iota
+	RetriesExhausted
+	DeadlineExceeded
+	NoConditions
+	Aborted
+	Interrupted
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case ConditionMet:
+		return "condition met"
+	case RetriesExhausted:
+		return "retries exhausted"
+	case DeadlineExceeded:
+		return "time budget exceeded"
+	case NoConditions:
+		return "no conditions provided"
+	case Aborted:
+		return "aborted on a non-retryable failure"
+	case Interrupted:
+		return "interrupted"
+	default:
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+}
+
+// Attempt records a single run of the session provider.
+type Attempt struct {
+	Command  string
+	Start    time.Time
+	Duration time.Duration
+	ExitCode int
+	TimedOut bool
+	// Killed is set when a timed out session ignored SIGTERM and had to be
+	// sent SIGKILL.
+	Killed bool
+	// Interrupted is set when the loop's context was cancelled while the
+	// attempt was running.
+	Interrupted bool
+	// Unmet describes the conditions the session did not meet, where they
+	// have descriptions.
+	Unmet  []string
+	Stdout string
+	Stderr string
+	// Err is set by attempts made through Do and Value.
+	Err error
+}
+
+func newAttempt(session *gexec.Session, start, end time.Time, timedOut bool) Attempt {
+	return Attempt{
+		Command:  strings.Join(session.Command.Args, " "),
+		Start:    start,
+		Duration: end.Sub(start),
+		ExitCode: session.ExitCode(),
+		TimedOut: timedOut,
+		Stdout:   trimOutput(session.Out.Contents()),
+		Stderr:   trimOutput(session.Err.Contents()),
+	}
+}
+
+// Status summarises how the attempt ended, without its output.
+func (a Attempt) Status() string {
+	status := fmt.Sprintf("exit %d", a.ExitCode)
+	switch {
+	case a.Interrupted:
+		status = "interrupted"
+	case a.Killed:
+		status = "timed out and was killed"
+	case a.TimedOut:
+		status = "timed out"
+	case a.Err != nil:
+		status = "failed"
+	}
+
+	if len(a.Unmet) > 0 {
+		status = fmt.Sprintf("%s, unmet: %s", status, strings.Join(a.Unmet, "; "))
+	}
+
+	return status
+}
+
+func (a Attempt) String() string {
+	if a.Err != nil {
+		return fmt.Sprintf("%s after %s: %v", a.Status(), a.Duration.Round(time.Millisecond), a.Err)
+	}
+
+	return fmt.Sprintf("%s after %s: stdout=%q stderr=%q", a.Status(), a.Duration.Round(time.Millisecond), a.Stdout, a.Stderr)
+}
+
+// RetryOutcome is the result of a retry loop along with every attempt it made.
+type RetryOutcome struct {
+	Reason   StopReason
+	Attempts []Attempt
+}
+
+func (o RetryOutcome) Succeeded() bool {
+	return o.Reason == ConditionMet
+}
+
+// LastAttempt returns the final attempt, if any were made.
+func (o RetryOutcome) LastAttempt() (Attempt, bool) {
+	if len(o.Attempts) == 0 {
+		return Attempt{}, false
+	}
+
+	return o.Attempts[len(o.Attempts)-1], true
+}
+
+// History describes the most recent attempts, one per line.
+func (o RetryOutcome) History() string {
+	if len(o.Attempts) == 0 {
+		return ""
+	}
+
+	first := len(o.Attempts) - historyLength
+	if first < 0 {
+		first = 0
+	}
+
+	lines := []string{fmt.Sprintf("Last %d of %d attempts:", len(o.Attempts)-first, len(o.Attempts))}
+	for i := first; i < len(o.Attempts); i++ {
+		if o.Attempts[i].Command == "" {
+			lines = append(lines, fmt.Sprintf("  #%d %s", i+1, o.Attempts[i]))
+		} else {
+			lines = append(lines, fmt.Sprintf("  #%d `%s` %s", i+1, o.Attempts[i].Command, o.Attempts[i]))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var outcomeSink *[]RetryOutcome
+
+// Track appends the outcome of every retry loop that finishes to outcomes,
+// until the returned function is called. The outcome is recorded before the
+// fail handler runs, so it is kept even when the loop fails the spec.
+func Track(outcomes *[]RetryOutcome) (stop func()) {
+	previous := outcomeSink
+	outcomeSink = outcomes
+
+	return func() {
+		outcomeSink = previous
+	}
+}
+
+func record(outcome RetryOutcome) {
+	if outcomeSink != nil {
+		*outcomeSink = append(*outcomeSink, outcome)
+	}
+}
+
+func trimOutput(output []byte) string {
+	trimmed := strings.TrimSpace(string(output))
+	if len(trimmed) > maxOutputLength {
+		trimmed = "..." + trimmed[len(trimmed)-maxOutputLength:]
+	}
+
+	return trimmed
+}
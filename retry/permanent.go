@@ -0,0 +1,41 @@
+package retry
+
+import (
+	"regexp"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+// Failures reported by the cf cli that retrying will not fix. Both the v6 and
+// the v7+ wording is matched where they differ.
+var (
+	NotLoggedIn             = MatchesStdOrErrorOutput(regexp.MustCompile(`Not logged in`))
+	Unauthorized            = MatchesStdOrErrorOutput(regexp.MustCompile(`Unauthorized|Credentials were rejected`))
+	ServiceOfferingNotFound = MatchesStdOrErrorOutput(regexp.MustCompile(`Service offering (\S+ )?not found`))
+	PlanNotFound            = MatchesStdOrErrorOutput(regexp.MustCompile(`Plan not found|The plan \S+ could not be found`))
+	InvalidJSONConfig       = MatchesStdOrErrorOutput(regexp.MustCompile(`Invalid (JSON|configuration) provided`))
+)
+
+var permanentCFFailures = []Condition{
+	NotLoggedIn,
+	Unauthorized,
+	ServiceOfferingNotFound,
+	PlanNotFound,
+	InvalidJSONConfig,
+}
+
+// PermanentCFFailure matches a failed session whose output reports any of the
+// permanent cf cli failures above.
+func PermanentCFFailure(session *gexec.Session) bool {
+	if session.ExitCode() == 0 {
+		return false
+	}
+
+	for _, condition := range permanentCFFailures {
+		if condition(session) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// policy holds the settings shared by every kind of retry loop: how often to
+// try, how long to wait in between, when to give up and how to report it.
+type policy struct {
+	failHandler failHandler
+	backoff     Backoff
+	maxRetries  int
+	deadline    time.Time
+	budget      time.Duration
+	clock       Clock
+	ctx         context.Context
+	onAttempt   []func(AttemptEvent)
+	onGiveUp    []func(GiveUpEvent)
+}
+
+func defaultPolicy() policy {
+	return policy{
+		failHandler: ginkgo.Fail,
+		backoff:     None(time.Second),
+		maxRetries:  10,
+		clock:       RealClock,
+	}
+}
+
+// verdict is what a single attempt concluded.
+type verdict int
+
+const (
+	unmet verdict = iota
+	met
+	abort
+	interrupted
+)
+
+// loop calls attempt until it is met, aborts, or the retries or time budget
+// run out. attempt is passed the deadline it must finish by, which is zero
+// when there is none.
+func (p *policy) loop(attempt func(deadline time.Time) (Attempt, verdict)) RetryOutcome {
+	var outcome RetryOutcome
+	deadline := p.effectiveDeadline()
+	sleep := p.backoff(0)
+
+	for retry := 0; retry <= p.maxRetries; retry++ {
+		if !p.clock.SleepContext(p.context(), p.capToDeadline(sleep, deadline)) {
+			outcome.Reason = Interrupted
+			return outcome
+		}
+
+		if !deadline.IsZero() && !p.clock.Now().Before(deadline) {
+			outcome.Reason = DeadlineExceeded
+			return outcome
+		}
+
+		a, v := attempt(deadline)
+		outcome.Attempts = append(outcome.Attempts, a)
+
+		sleep = 0
+		if v == unmet && retry < p.maxRetries {
+			sleep = p.backoff(uint(retry + 1))
+		}
+
+		p.notifyAttempt(AttemptEvent{
+			Attempt:     a,
+			Number:      retry + 1,
+			MaxAttempts: p.maxRetries + 1,
+			Met:         v == met,
+			NextSleep:   p.capToDeadline(sleep, deadline),
+		})
+
+		switch v {
+		case met:
+			outcome.Reason = ConditionMet
+			return outcome
+		case abort:
+			outcome.Reason = Aborted
+			return outcome
+		case interrupted:
+			outcome.Reason = Interrupted
+			return outcome
+		}
+	}
+
+	outcome.Reason = RetriesExhausted
+	return outcome
+}
+
+// context is the context set on this loop, otherwise the default context.
+func (p *policy) context() context.Context {
+	if p.ctx != nil {
+		return p.ctx
+	}
+
+	return defaultContext
+}
+
+// finish records the outcome and calls the fail handler if it did not succeed.
+func (p *policy) finish(outcome RetryOutcome, msg []string) {
+	record(outcome)
+
+	if !outcome.Succeeded() {
+		message := p.failureMessage(outcome, msg)
+		p.notifyGiveUp(GiveUpEvent{Outcome: outcome, Message: message})
+		p.failHandler(message)
+	}
+}
+
+// effectiveDeadline is the earlier of the absolute deadline and the total
+// budget measured from now. The zero time means there is no deadline.
+func (p *policy) effectiveDeadline() time.Time {
+	deadline := p.deadline
+
+	if p.budget > 0 {
+		budgetDeadline := p.clock.Now().Add(p.budget)
+		if deadline.IsZero() || budgetDeadline.Before(deadline) {
+			deadline = budgetDeadline
+		}
+	}
+
+	return deadline
+}
+
+func (p *policy) failureMessage(outcome RetryOutcome, msg []string) string {
+	var reason string
+	switch outcome.Reason {
+	case Aborted:
+		reason = fmt.Sprintf("Aborted after %d attempts: the failure is not retryable", len(outcome.Attempts))
+	case Interrupted:
+		reason = fmt.Sprintf("Interrupted after %d attempts: %v", len(outcome.Attempts), context.Cause(p.context()))
+	case DeadlineExceeded:
+		reason = "Exceeded time budget"
+		if p.budget > 0 {
+			reason = fmt.Sprintf("Exceeded time budget of %s", p.budget)
+		}
+	default:
+		reason = fmt.Sprintf("Exceeded %d retries", p.maxRetries)
+	}
+
+	if history := outcome.History(); history != "" {
+		reason = fmt.Sprintf("%s\n%s", reason, history)
+	}
+
+	if len(msg) == 0 {
+		return reason
+	}
+
+	return fmt.Sprintf("%s\n%s", msg[0], reason)
+}
+
+func (p *policy) capToDeadline(d time.Duration, deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return d
+	}
+
+	remaining := deadline.Sub(p.clock.Now())
+	if remaining < 0 {
+		return 0
+	}
+	if d > remaining {
+		return remaining
+	}
+
+	return d
+}
+
+var defaultContext = context.Background()
+
+// SetDefaultContext makes ctx the context of every retry loop that was not
+// given one with WithContext, until the returned function restores the
+// previous default.
+func SetDefaultContext(ctx context.Context) (restore func()) {
+	previous := defaultContext
+	defaultContext = ctx
+
+	return func() {
+		defaultContext = previous
+	}
+}
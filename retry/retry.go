@@ -1,30 +1,27 @@
 package retry
 
 import (
-	"fmt"
-	"math"
-	"regexp"
+	"context"
 	"time"
 
-	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega/gexec"
 )
 
 type retryCheck struct {
+	policy
+
 	sessionProvider sessionProvider
 	sessionTimeout  time.Duration
-	failHandler     failHandler
-	backoff         Backoff
-	maxRetries      int
+	gracePeriod     time.Duration
+	abortWhen       []Condition
 }
 
 func Session(sp sessionProvider) *retryCheck {
 	return &retryCheck{
+		policy:          defaultPolicy(),
 		sessionProvider: sp,
 		sessionTimeout:  time.Second,
-		failHandler:     ginkgo.Fail,
-		backoff:         None(time.Second),
-		maxRetries:      10,
+		gracePeriod:     5 * time.Second,
 	}
 }
 
@@ -46,6 +43,31 @@ func (rc *retryCheck) AndSessionTimeout(timeout time.Duration) *retryCheck {
 	return rc.WithSessionTimeout(timeout)
 }
 
+// WithGracePeriod sets how long a session that overran its timeout is given to
+// exit after SIGTERM before it is sent SIGKILL.
+func (rc *retryCheck) WithGracePeriod(grace time.Duration) *retryCheck {
+	rc.gracePeriod = grace
+	return rc
+}
+
+func (rc *retryCheck) AndGracePeriod(grace time.Duration) *retryCheck {
+	return rc.WithGracePeriod(grace)
+}
+
+// WithContext stops the loop, killing any running session, as soon as ctx is
+// done. ginkgo's SpecContext is cancelled when a spec times out or is
+// interrupted.
+func (rc *retryCheck) WithContext(ctx context.Context) *retryCheck {
+	rc.ctx = ctx
+	return rc
+}
+
+// WithClock replaces the wall clock used for sleeps, timeouts and deadlines.
+func (rc *retryCheck) WithClock(clock Clock) *retryCheck {
+	rc.clock = clockOrReal(clock)
+	return rc
+}
+
 func (rc *retryCheck) WithMaxRetries(max int) *retryCheck {
 	rc.maxRetries = max
 	return rc
@@ -64,147 +86,190 @@ func (rc *retryCheck) AndBackoff(b Backoff) *retryCheck {
 	return rc.WithBackoff(b)
 }
 
-func (rc *retryCheck) Until(c Condition, msg ...string) {
-	if rc.check(c) {
-		return
-	}
+// WithDeadline stops retrying once the wall clock passes deadline, even if
+// retries remain.
+func (rc *retryCheck) WithDeadline(deadline time.Time) *retryCheck {
+	rc.deadline = deadline
+	return rc
+}
 
-	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
-	}
+func (rc *retryCheck) AndDeadline(deadline time.Time) *retryCheck {
+	return rc.WithDeadline(deadline)
+}
 
-	rc.failHandler(msg[0])
+// WithinTotal bounds the whole retry loop, sleeps included, to budget. The
+// clock starts when Until, UntilAny or UntilAll is called.
+func (rc *retryCheck) WithinTotal(budget time.Duration) *retryCheck {
+	rc.budget = budget
+	return rc
 }
 
-func (rc *retryCheck) UntilAny(c []Condition, msg ...string) {
-	if len(c) < 1 {
-		rc.failHandler("Provide at least one condition to match")
-		return
-	}
+// AbortWhen stops retrying as soon as a session that did not meet the
+// condition being waited for matches c. Use it for failures that no amount of
+// retrying will fix.
+func (rc *retryCheck) AbortWhen(c Condition) *retryCheck {
+	rc.abortWhen = append(rc.abortWhen, c)
+	return rc
+}
 
-	if rc.checkAny(c...) {
-		return
-	}
+func (rc *retryCheck) AndAbortWhen(c Condition) *retryCheck {
+	return rc.AbortWhen(c)
+}
 
-	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
-	}
+// FailFast aborts on the cf cli failures in PermanentCFFailure.
+func (rc *retryCheck) FailFast() *retryCheck {
+	return rc.AbortWhen(PermanentCFFailure)
+}
 
-	rc.failHandler(msg[0])
+// Until retries the session until c is met. The returned RetryOutcome holds
+// the history of every attempt, whether or not the fail handler was called.
+func (rc *retryCheck) Until(c Condition, msg ...string) RetryOutcome {
+	return rc.until(rc.check(c), msg)
 }
 
-func (rc *retryCheck) UntilAll(c []Condition, msg ...string) {
+func (rc *retryCheck) UntilAny(c []Condition, msg ...string) RetryOutcome {
 	if len(c) < 1 {
 		rc.failHandler("Provide at least one condition to match")
-		return
-	}
-
-	if rc.checkAll(c...) {
-		return
-	}
-
-	if len(msg) == 0 {
-		msg = []string{fmt.Sprintf("Exceeded %d retries", rc.maxRetries)}
+		return RetryOutcome{Reason: NoConditions}
 	}
 
-	rc.failHandler(msg[0])
+	return rc.until(rc.checkAny(c...), msg)
 }
 
-func (rc *retryCheck) check(c Condition) bool {
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
-
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
-
-		if c(session) {
-			return true
-		}
+func (rc *retryCheck) UntilAll(c []Condition, msg ...string) RetryOutcome {
+	if len(c) < 1 {
+		rc.failHandler("Provide at least one condition to match")
+		return RetryOutcome{Reason: NoConditions}
 	}
 
-	return false
+	return rc.until(rc.checkAll(c...), msg)
 }
 
-func (rc *retryCheck) checkAny(conditions ...Condition) bool {
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
+func (rc *retryCheck) until(outcome RetryOutcome, msg []string) RetryOutcome {
+	rc.finish(outcome, msg)
+	return outcome
+}
 
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
+func (rc *retryCheck) check(c Condition) RetryOutcome {
+	return rc.run(c)
+}
 
+func (rc *retryCheck) checkAny(conditions ...Condition) RetryOutcome {
+	return rc.run(func(session *gexec.Session) bool {
 		for _, condition := range conditions {
 			if condition(session) {
 				return true
 			}
 		}
-	}
-	return false
+		return false
+	})
 }
 
-func (rc *retryCheck) checkAll(conditions ...Condition) bool {
-RetryLoop:
-	for retry := 0; retry <= rc.maxRetries; retry++ {
-		time.Sleep(rc.backoff(uint(retry)))
-
-		session := rc.sessionProvider().Wait(rc.sessionTimeout)
-
+func (rc *retryCheck) checkAll(conditions ...Condition) RetryOutcome {
+	return rc.run(func(session *gexec.Session) bool {
 		for _, condition := range conditions {
 			if !condition(session) {
-				continue RetryLoop
+				return false
 			}
 		}
 		return true
-	}
-	return false
+	})
 }
 
-type Condition func(session *gexec.Session) bool
+func (rc *retryCheck) run(c Condition) RetryOutcome {
+	return rc.loop(func(deadline time.Time) (Attempt, verdict) {
+		start := rc.clock.Now()
+		session := rc.sessionProvider()
+
+		switch rc.waitForSession(session, rc.capToDeadline(rc.sessionTimeout, deadline)) {
+		case sessionTimedOut:
+			killed := rc.reap(session)
+			attempt := newAttempt(session, start, rc.clock.Now(), true)
+			attempt.Killed = killed
+			return attempt, unmet
+		case sessionInterrupted:
+			killed := rc.reap(session)
+			attempt := newAttempt(session, start, rc.clock.Now(), false)
+			attempt.Killed = killed
+			attempt.Interrupted = true
+			return attempt, interrupted
+		}
 
-func Succeeds(session *gexec.Session) bool {
-	return session.ExitCode() == 0
+		attempt := newAttempt(session, start, rc.clock.Now(), false)
+		conditionMet, expectations := unmetExpectations(c, session)
+		attempt.Unmet = expectations
+
+		switch {
+		case conditionMet:
+			return attempt, met
+		case rc.shouldAbort(session):
+			return attempt, abort
+		default:
+			return attempt, unmet
+		}
+	})
 }
 
-func MatchesOutput(regex *regexp.Regexp) Condition {
-	return func(session *gexec.Session) bool {
-		return regex.Match(session.Out.Contents())
+// reap stops a session that overran its timeout or was interrupted, so that
+// it cannot linger alongside the next attempt. It reports whether SIGKILL was needed. Only the
+// session's own process is signalled, which covers the cf cli and curl.
+func (rc *retryCheck) reap(session *gexec.Session) (killed bool) {
+	session.Terminate()
+	if rc.awaitExit(session, rc.gracePeriod) {
+		return false
 	}
-}
 
-func MatchesErrorOutput(regex *regexp.Regexp) Condition {
-	return func(session *gexec.Session) bool {
-		return regex.Match(session.Err.Contents())
-	}
+	session.Kill()
+	rc.awaitExit(session, rc.gracePeriod)
+	return true
 }
 
-func MatchesStdOrErrorOutput(regex *regexp.Regexp) Condition {
-	return func(session *gexec.Session) bool {
-		return regex.Match(session.Out.Contents()) || regex.Match(session.Err.Contents())
+func (rc *retryCheck) shouldAbort(session *gexec.Session) bool {
+	for _, condition := range rc.abortWhen {
+		if condition(session) {
+			return true
+		}
 	}
-}
 
-type Backoff func(retryCount uint) time.Duration
+	return false
+}
 
-func None(baseline time.Duration) Backoff {
-	return func(retryCount uint) time.Duration {
-		if retryCount == 0 {
-			return 0
-		}
+type sessionState int
 
-		return baseline
-	}
-}
+const (
+	sessionExited sessionState = iota
+	sessionTimedOut
+	sessionInterrupted
+)
 
-func Linear(baseline time.Duration) Backoff {
-	return func(retryCount uint) time.Duration {
-		return time.Duration(retryCount) * baseline
+// waitForSession waits for the session to exit, for timeout to pass, or for
+// the loop's context to be done, whichever comes first.
+func (rc *retryCheck) waitForSession(session *gexec.Session, timeout time.Duration) sessionState {
+	ctx, cancel := context.WithCancel(rc.context())
+	defer cancel()
+
+	select {
+	case <-session.Exited:
+		return sessionExited
+	case <-rc.clock.After(ctx, timeout):
+		return sessionTimedOut
+	case <-rc.context().Done():
+		return sessionInterrupted
 	}
 }
 
-func Exponential(baseline time.Duration) Backoff {
-	return func(retryCount uint) time.Duration {
-		if retryCount == 0 {
-			return 0
-		}
+// awaitExit waits up to timeout for the session to exit and reports whether
+// it did. Unlike gexec.Session.Wait it does not fail the running spec when the
+// timeout is reached; the attempt simply counts as failed.
+func (rc *retryCheck) awaitExit(session *gexec.Session, timeout time.Duration) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		return time.Duration(math.Pow(2, float64(retryCount))) * baseline
+	select {
+	case <-session.Exited:
+		return true
+	case <-rc.clock.After(ctx, timeout):
+		return false
 	}
 }
 
@@ -2,6 +2,7 @@ package retry_test
 
 import (
 	"math"
+	"math/rand/v2"
 	"os/exec"
 	"regexp"
 	"time"
@@ -31,6 +32,7 @@ var (
 	maxRetries int
 	attempts   int
 	failed     bool
+	failMsg    string
 	conditions []retry.Condition
 	fn         func() *gexec.Session
 	successFn  = func() *gexec.Session {
@@ -43,6 +45,7 @@ var (
 	}
 	failHandler = func(msg string, i ...int) {
 		failed = true
+		failMsg = msg
 	}
 )
 
@@ -123,6 +126,215 @@ var _ = Describe("retry", func() {
 		})
 	})
 
+	Describe("time budget", func() {
+		BeforeEach(func() {
+			attempts = 0
+			failed = false
+			failMsg = ""
+		})
+
+		Context("when the budget runs out before the retries", func() {
+			It("stops retrying and says the budget ran out", func() {
+				retry.Session(failureFn).WithMaxRetries(100).AndBackoff(retry.None(50*time.Millisecond)).WithinTotal(200*time.Millisecond).AndFailHandler(failHandler).Until(retry.Succeeds, "custom message")
+
+				Expect(failed).To(BeTrue())
+				Expect(attempts).To(BeNumerically("<", 101))
+				Expect(failMsg).To(HavePrefix("custom message"))
+				Expect(failMsg).To(ContainSubstring("Exceeded time budget of 200ms"))
+			})
+
+			It("caps the sleep to the remaining budget", func() {
+				start := time.Now()
+				retry.Session(failureFn).WithMaxRetries(3).AndBackoff(retry.None(time.Hour)).WithinTotal(100 * time.Millisecond).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+				Expect(attempts).To(Equal(1))
+				Expect(failMsg).To(ContainSubstring("Exceeded time budget"))
+			})
+		})
+
+		Context("when the deadline has already passed", func() {
+			It("does not start an attempt", func() {
+				retry.Session(failureFn).WithMaxRetries(3).AndDeadline(time.Now().Add(-time.Second)).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+				Expect(attempts).To(Equal(0))
+				Expect(failMsg).To(Equal("Exceeded time budget"))
+			})
+		})
+
+		Context("when the retries run out before the budget", func() {
+			It("says the retry count ran out", func() {
+				retry.Session(failureFn).WithMaxRetries(2).AndBackoff(retry.None(time.Millisecond)).WithinTotal(time.Minute).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+				Expect(attempts).To(Equal(3))
+				Expect(failMsg).To(HavePrefix("Exceeded 2 retries\n"))
+			})
+		})
+	})
+
+	Describe("attempt history", func() {
+		BeforeEach(func() {
+			attempts = 0
+			failed = false
+			failMsg = ""
+		})
+
+		It("records every attempt", func() {
+			outcome := retry.Session(failureFn).WithMaxRetries(4).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+			Expect(outcome.Reason).To(Equal(retry.RetriesExhausted))
+			Expect(outcome.Succeeded()).To(BeFalse())
+			Expect(outcome.Attempts).To(HaveLen(5))
+
+			last, ok := outcome.LastAttempt()
+			Expect(ok).To(BeTrue())
+			Expect(last.Command).To(Equal("ls not-a-file-that-exists"))
+			Expect(last.ExitCode).NotTo(BeZero())
+			Expect(last.TimedOut).To(BeFalse())
+			Expect(last.Stderr).To(ContainSubstring("not-a-file-that-exists"))
+			Expect(last.Start).NotTo(BeZero())
+		})
+
+		It("attaches the most recent attempts to the failure message", func() {
+			retry.Session(failureFn).WithMaxRetries(4).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds, "custom message")
+
+			Expect(failMsg).To(HavePrefix("custom message\nExceeded 4 retries\nLast 3 of 5 attempts:"))
+			Expect(failMsg).To(ContainSubstring("#5 `ls not-a-file-that-exists` exit"))
+			Expect(failMsg).NotTo(ContainSubstring("#2 "))
+		})
+
+		It("records the successful attempt", func() {
+			outcome := retry.Session(successFn).WithMaxRetries(4).AndBackoff(retry.None(time.Millisecond)).Until(retry.Succeeds)
+
+			Expect(outcome.Succeeded()).To(BeTrue())
+			Expect(outcome.Attempts).To(HaveLen(1))
+			Expect(outcome.Attempts[0].Stdout).To(Equal("hello"))
+		})
+
+		It("marks attempts that outlive the session timeout", func() {
+			hangingFn := func() *gexec.Session {
+				s, err := gexec.Start(exec.Command("sleep", "1"), GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				return s
+			}
+
+			outcome := retry.Session(hangingFn).WithMaxRetries(0).WithSessionTimeout(10 * time.Millisecond).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+			Expect(outcome.Attempts).To(HaveLen(1))
+			Expect(outcome.Attempts[0].TimedOut).To(BeTrue())
+			Expect(failMsg).To(ContainSubstring("timed out"))
+		})
+
+		It("hands outcomes to a tracker, even when the loop fails", func() {
+			var outcomes []retry.RetryOutcome
+			stop := retry.Track(&outcomes)
+
+			retry.Session(successFn).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).Until(retry.Succeeds)
+			retry.Session(failureFn).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds)
+			stop()
+			retry.Session(successFn).WithMaxRetries(1).AndBackoff(retry.None(time.Millisecond)).Until(retry.Succeeds)
+
+			Expect(outcomes).To(HaveLen(2))
+			Expect(outcomes[0].Succeeded()).To(BeTrue())
+			Expect(outcomes[1].Reason).To(Equal(retry.RetriesExhausted))
+		})
+	})
+
+	Describe("sessions that overrun their timeout", func() {
+		var sessions []*gexec.Session
+
+		startSession := func(script string) func() *gexec.Session {
+			return func() *gexec.Session {
+				s, err := gexec.Start(exec.Command("sh", "-c", script), GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				sessions = append(sessions, s)
+				return s
+			}
+		}
+
+		BeforeEach(func() {
+			sessions = nil
+			failed = false
+			failMsg = ""
+		})
+
+		It("terminates them before the next attempt starts", func() {
+			outcome := retry.Session(startSession("exec sleep 10")).WithMaxRetries(1).WithSessionTimeout(20 * time.Millisecond).
+				AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+			Expect(sessions).To(HaveLen(2))
+			for _, s := range sessions {
+				Expect(s.ExitCode()).To(Equal(128 + 15))
+			}
+			Expect(outcome.Attempts[0].TimedOut).To(BeTrue())
+			Expect(outcome.Attempts[0].Killed).To(BeFalse())
+		})
+
+		It("kills them when they ignore SIGTERM", func() {
+			outcome := retry.Session(startSession("trap '' TERM; exec sleep 10")).WithMaxRetries(0).WithSessionTimeout(20 * time.Millisecond).
+				AndGracePeriod(50 * time.Millisecond).AndFailHandler(failHandler).Until(retry.Succeeds)
+
+			Expect(sessions[0].ExitCode()).To(Equal(128 + 9))
+			Expect(outcome.Attempts[0].Killed).To(BeTrue())
+			Expect(failMsg).To(ContainSubstring("timed out and was killed"))
+		})
+
+		It("does not evaluate the condition against them", func() {
+			outcome := retry.Session(startSession("echo partial; exec sleep 10")).WithMaxRetries(0).WithSessionTimeout(100 * time.Millisecond).
+				AndFailHandler(failHandler).Until(retry.MatchesOutput(regexp.MustCompile("partial")))
+
+			Expect(outcome.Succeeded()).To(BeFalse())
+			Expect(outcome.Attempts[0].TimedOut).To(BeTrue())
+		})
+	})
+
+	Describe("aborting", func() {
+		var notLoggedInFn = func() *gexec.Session {
+			attempts += 1
+			s, err := gexec.Start(exec.Command("sh", "-c", "echo 'Not logged in. Use cf login to log in.' >&2; exit 1"), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			return s
+		}
+
+		BeforeEach(func() {
+			attempts = 0
+			failed = false
+			failMsg = ""
+		})
+
+		It("stops at the first session matching an abort condition", func() {
+			outcome := retry.Session(failureFn).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).
+				AbortWhen(retry.MatchesErrorOutput(regexp.MustCompile("No such file"))).Until(retry.Succeeds, "custom message")
+
+			Expect(attempts).To(Equal(1))
+			Expect(outcome.Reason).To(Equal(retry.Aborted))
+			Expect(failMsg).To(HavePrefix("custom message\nAborted after 1 attempts: the failure is not retryable"))
+		})
+
+		It("prefers the condition over the abort condition", func() {
+			outcome := retry.Session(successFn).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).
+				AbortWhen(retry.MatchesOutput(regexp.MustCompile("hello"))).Until(retry.Succeeds)
+
+			Expect(outcome.Succeeded()).To(BeTrue())
+			Expect(failed).To(BeFalse())
+		})
+
+		It("fails fast on permanent cf cli failures", func() {
+			outcome := retry.Session(notLoggedInFn).WithMaxRetries(5).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).
+				FailFast().Until(retry.Succeeds)
+
+			Expect(attempts).To(Equal(1))
+			Expect(outcome.Reason).To(Equal(retry.Aborted))
+		})
+
+		It("keeps retrying failures that are not permanent", func() {
+			retry.Session(failureFn).WithMaxRetries(2).AndBackoff(retry.None(time.Millisecond)).AndFailHandler(failHandler).
+				FailFast().Until(retry.Succeeds)
+
+			Expect(attempts).To(Equal(3))
+		})
+	})
+
 	Describe("UntilAny", func() {
 		var (
 			fn = successFn
@@ -263,5 +475,72 @@ var _ = Describe("retry", func() {
 				}
 			})
 		})
+
+		Describe("FullJitter", func() {
+			It("stays between zero and the exponential backoff", func() {
+				backoff := retry.FullJitter(baseline, rand.New(rand.NewPCG(1, 2)))
+
+				Expect(backoff(0)).To(Equal(time.Duration(0)))
+
+				for i := 1; i < 10; i++ {
+					Expect(backoff(uint(i))).To(BeNumerically(">=", 0))
+					Expect(backoff(uint(i))).To(BeNumerically("<", time.Duration(math.Pow(2, float64(i)))*baseline))
+				}
+			})
+
+			It("is reproducible with a seeded source", func() {
+				first := retry.FullJitter(baseline, rand.New(rand.NewPCG(1, 2)))
+				second := retry.FullJitter(baseline, rand.New(rand.NewPCG(1, 2)))
+
+				for i := 1; i < 10; i++ {
+					Expect(first(uint(i))).To(Equal(second(uint(i))))
+				}
+			})
+
+			It("does not overflow for large retry counts", func() {
+				backoff := retry.FullJitter(baseline, rand.New(rand.NewPCG(1, 2)))
+
+				Expect(backoff(200)).To(BeNumerically(">=", 0))
+			})
+		})
+
+		Describe("DecorrelatedJitter", func() {
+			var maxDelay = 10 * time.Second
+
+			It("stays between the baseline and the maximum", func() {
+				backoff := retry.DecorrelatedJitter(baseline, maxDelay, rand.New(rand.NewPCG(1, 2)))
+
+				Expect(backoff(0)).To(Equal(time.Duration(0)))
+
+				for i := 1; i < 50; i++ {
+					Expect(backoff(uint(i))).To(And(
+						BeNumerically(">=", baseline),
+						BeNumerically("<=", maxDelay),
+					))
+				}
+			})
+
+			It("restarts the schedule at retry zero", func() {
+				backoff := retry.DecorrelatedJitter(baseline, maxDelay, rand.New(rand.NewPCG(1, 2)))
+				for i := 0; i < 20; i++ {
+					backoff(uint(i))
+				}
+
+				Expect(backoff(0)).To(Equal(time.Duration(0)))
+				Expect(backoff(1)).To(BeNumerically("<=", 3*baseline))
+			})
+		})
+
+		Describe("Capped", func() {
+			It("limits the wrapped backoff", func() {
+				backoff := retry.Capped(retry.Exponential(baseline), 5*time.Second)
+
+				Expect(backoff(0)).To(Equal(time.Duration(0)))
+				Expect(backoff(1)).To(Equal(2 * time.Second))
+				Expect(backoff(2)).To(Equal(4 * time.Second))
+				Expect(backoff(3)).To(Equal(5 * time.Second))
+				Expect(backoff(10)).To(Equal(5 * time.Second))
+			})
+		})
 	})
 })
@@ -0,0 +1,637 @@
+// Package lifecycle is the smoke test flow for one service plan: create an
+// instance, bind it to the example app, read and write through it over each
+// enabled port, then tear everything down. It runs against any cf.Platform,
+// so it can be exercised offline with the fake platform.
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+)
+
+// App is the example app the smoke tests talk to Redis through.
+type App interface {
+	IsRunning() func()
+	Write(key, value string) func()
+	ReadAssert(key, expectedValue string) func()
+	ReadTLSAssert(tlsVersion, key, expectedValue string) func()
+
+	CheckList(key string, values ...string) func()
+	CheckHash(key string, fields map[string]string) func()
+	CheckSet(key string, members ...string) func()
+	CheckSortedSet(key string, scores map[string]float64) func()
+	CheckStream(key, group, consumer string, values ...string) func()
+	CheckExpiry(key, value string, ttl time.Duration) func()
+	CheckIncr(key string, concurrency int) func()
+}
+
+// DataTypes are the names of the data type checks that can be run through
+// the app for a plan.
+var DataTypes = []string{"lists", "hashes", "sets", "sorted_sets", "streams", "expiry", "incr"}
+
+// ValidateDataTypes rejects any data type check, keyed by plan name, that is
+// not one of DataTypes.
+func ValidateDataTypes(dataTypes map[string][]string) error {
+	for plan, names := range dataTypes {
+		for _, name := range names {
+			if !slices.Contains(DataTypes, name) {
+				return fmt.Errorf("unknown data type %q for plan %s, expected one of %s", name, plan, strings.Join(DataTypes, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Probe reaches Redis directly from the test runner rather than through the
+// app.
+type Probe interface {
+	Check(key, value string) func()
+}
+
+// Sentinel checks the sentinels of an instance from the test runner.
+type Sentinel interface {
+	CheckMaster() func()
+	Failover(key, value string) func()
+}
+
+// TLSCheck checks from the test runner which TLS versions an instance
+// accepts.
+type TLSCheck interface {
+	Check() func()
+}
+
+// CertCheck inspects the certificates of an instance's TLS ports, passing
+// what it finds to note for the step's report.
+type CertCheck interface {
+	Check(note func(string)) func()
+}
+
+// TLSVersions are the versions whose handshake is checked when an instance
+// has a TLS port.
+var TLSVersions = []string{"tlsv1", "tlsv1.1", "tlsv1.2", "tlsv1.3"}
+
+// Spec holds what one spec creates. Names are expected to be unique per spec.
+type Spec struct {
+	Platform cf.Platform
+	App      App
+	Report   *reporter.SmokeTestReport
+
+	ServiceName string
+	OrgName     string
+	SpaceName   string
+
+	AppName             string
+	ServiceInstanceName string
+	SecurityGroupName   string
+	ServiceKeyName      string
+
+	// Probe, if set, is run by Run alongside the app's checks.
+	Probe Probe
+	// Sentinel, if set, checks the master of sentinel instances in Run. It
+	// is required by RunFailover.
+	Sentinel Sentinel
+	// TLSCheck and CertCheck, if set, are run by Run for instances with TLS
+	// ports.
+	TLSCheck  TLSCheck
+	CertCheck CertCheck
+
+	// DataTypes are the data type checks Run makes through the app for each
+	// plan, by plan name.
+	DataTypes map[string][]string
+
+	// Parameters are passed to the broker for each plan, by plan name.
+	Parameters map[string]PlanParameters
+
+	// ServiceKey is filled in from the instance's service key by Run.
+	ServiceKey cf.Credentials
+}
+
+// PlanParameters are the arbitrary parameters passed with each operation on
+// an instance of one plan.
+type PlanParameters struct {
+	Provision  cf.Parameters `json:"provision"`
+	Update     cf.Parameters `json:"update"`
+	ServiceKey cf.Parameters `json:"service_key"`
+	Binding    cf.Parameters `json:"binding"`
+}
+
+// SharedSpace is the second space RunShare shares the instance into, and the
+// app it binds there.
+type SharedSpace struct {
+	SpaceName         string
+	AppName           string
+	App               App
+	PushArgs          []string
+	SecurityGroupName string
+}
+
+// PlanUpdate is a move between two plans, an upgrade to the latest
+// maintenance_info, or both.
+type PlanUpdate struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Upgrade bool   `json:"upgrade"`
+}
+
+// Validate rejects an update that would change nothing: one that moves to no
+// other plan, does not upgrade and has no update parameters for its plan.
+func (u PlanUpdate) Validate(parameters map[string]PlanParameters) error {
+	if u.From == "" {
+		return errors.New("plan update has no from plan")
+	}
+	if u.To == "" && !u.Upgrade && len(parameters[u.From].Update) == 0 {
+		return fmt.Errorf("plan update of %s has no to plan, no upgrade and no update parameters", u.From)
+	}
+	return nil
+}
+
+func (u PlanUpdate) String() string {
+	switch {
+	case u.To != "" && u.Upgrade:
+		return fmt.Sprintf("%s to %s with upgrade", u.From, u.To)
+	case u.To != "":
+		return fmt.Sprintf("%s to %s", u.From, u.To)
+	default:
+		return fmt.Sprintf("%s upgrade", u.From)
+	}
+}
+
+// Run creates an instance of planName and checks the app can use it. The
+// spec is marked skipped in the report if the plan has no capacity left.
+func (s *Spec) Run(planName string) {
+	if !s.provision(planName) {
+		return
+	}
+
+	if s.Probe != nil {
+		s.perform([]*reporter.Step{
+			reporter.NewStep(
+				"Probe Redis directly from the test runner",
+				s.Probe.Check("probekey", "probevalue"),
+			),
+		})
+	}
+
+	if s.Sentinel != nil && s.ServiceKey.IsSentinel() {
+		s.perform([]*reporter.Step{
+			reporter.NewStep(
+				"Check the sentinels agree on a working master",
+				s.Sentinel.CheckMaster(),
+			),
+		})
+	}
+
+	if !s.ServiceKey.TLSEnforced() {
+		if s.ServiceKey.IsSentinelTLS() {
+			s.perform([]*reporter.Step{
+				reporter.NewStep("Enable tls", s.Platform.SetEnv(s.AppName, "tls_enabled", "true")),
+				reporter.NewStep("Restage app", s.Platform.Restage(s.AppName)),
+			})
+		}
+		s.perform([]*reporter.Step{
+			reporter.NewStep(
+				"Write a key/value pair to Redis",
+				s.App.Write("mykey", "myvalue"),
+			),
+			reporter.NewStep(
+				"Read the key/value pair back",
+				s.App.ReadAssert("mykey", "myvalue"),
+			),
+		})
+	}
+
+	if s.ServiceKey.TLSEnabled() {
+		tlsSpecSteps := []*reporter.Step{
+			reporter.NewStep("Enable tls", s.Platform.SetEnv(s.AppName, "tls_enabled", "true")),
+			reporter.NewStep("Restage app", s.Platform.Restage(s.AppName)),
+			reporter.NewStep(
+				"TLS: Write a key/value pair to Redis",
+				s.App.Write("mykey", "myvalue2"),
+			),
+			reporter.NewStep(
+				"TLS: Read the key/value pair back",
+				s.App.ReadAssert("mykey", "myvalue2"),
+			),
+		}
+		for _, version := range TLSVersions {
+			tlsSpecSteps = append(tlsSpecSteps, s.tlsStep(version, "mykey", "myvalue2"))
+		}
+		s.perform(tlsSpecSteps)
+	}
+
+	if dataTypes := s.DataTypes[planName]; len(dataTypes) > 0 {
+		var dataTypeSteps []*reporter.Step
+		for _, dataType := range dataTypes {
+			dataTypeSteps = append(dataTypeSteps, s.dataTypeStep(dataType))
+		}
+		s.perform(dataTypeSteps)
+	}
+
+	if s.ServiceKey.TLSEnabled() || s.ServiceKey.IsSentinelTLS() {
+		var runnerSteps []*reporter.Step
+		if s.TLSCheck != nil {
+			runnerSteps = append(runnerSteps, reporter.NewStep(
+				"Check the TLS versions the instance accepts from the test runner",
+				s.TLSCheck.Check(),
+			))
+		}
+		if s.CertCheck != nil {
+			certStep := reporter.NewStep("Inspect the certificates of the instance's TLS ports", nil)
+			certStep.Task = s.CertCheck.Check(certStep.Note)
+			runnerSteps = append(runnerSteps, certStep)
+		}
+		s.perform(runnerSteps)
+	}
+}
+
+// RunUpdate creates an instance of update.From, writes to it, updates it and
+// checks the data is still readable afterwards.
+func (s *Spec) RunUpdate(update PlanUpdate) {
+	if update.To != "" {
+		s.perform([]*reporter.Step{
+			reporter.NewStep(
+				fmt.Sprintf("Enable service plan access for '%s' org", s.OrgName),
+				s.Platform.EnableServiceAccessForPlan(s.OrgName, s.ServiceName, update.To),
+			),
+		})
+	}
+
+	if !s.provision(update.From) {
+		return
+	}
+
+	if s.ServiceKey.TLSEnforced() || s.ServiceKey.IsSentinelTLS() {
+		s.perform([]*reporter.Step{
+			reporter.NewStep("Enable tls", s.Platform.SetEnv(s.AppName, "tls_enabled", "true")),
+			reporter.NewStep("Restage app", s.Platform.Restage(s.AppName)),
+		})
+	}
+
+	finalPlan := update.From
+	if update.To != "" {
+		finalPlan = update.To
+	}
+	updateParams := s.Parameters[finalPlan].Update
+
+	updateSteps := []*reporter.Step{
+		reporter.NewStep(
+			"Write a key/value pair to Redis",
+			s.App.Write("updatekey", "written-before-update"),
+		),
+	}
+	switch {
+	case update.To != "":
+		updateSteps = append(updateSteps, reporter.NewStep(
+			fmt.Sprintf("Update the '%s' plan instance '%s' to the '%s' plan", update.From, s.ServiceInstanceName, update.To),
+			s.Platform.UpdateService(s.ServiceInstanceName, update.To, updateParams, false),
+		))
+	case len(updateParams) > 0:
+		updateSteps = append(updateSteps, reporter.NewStep(
+			fmt.Sprintf("Update the parameters of the '%s' plan instance '%s'", update.From, s.ServiceInstanceName),
+			s.Platform.UpdateService(s.ServiceInstanceName, "", updateParams, false),
+		))
+	}
+	if update.Upgrade {
+		updateSteps = append(updateSteps, reporter.NewStep(
+			fmt.Sprintf("Upgrade the instance '%s'", s.ServiceInstanceName),
+			s.Platform.UpdateService(s.ServiceInstanceName, "", nil, true),
+		))
+	}
+	updateSteps = append(updateSteps, reporter.NewStep(
+		"Read the key/value pair back after the update",
+		s.App.ReadAssert("updatekey", "written-before-update"),
+	))
+	if len(updateParams) > 0 {
+		expected := cf.Parameters{}
+		for _, params := range []cf.Parameters{s.Parameters[update.From].Provision, updateParams} {
+			for name, value := range params {
+				expected[name] = value
+			}
+		}
+		updateSteps = append(updateSteps, s.verifyParametersStep(expected))
+	}
+
+	s.perform(updateSteps)
+}
+
+// RunFailover creates a sentinel instance of planName and fails its master
+// over. It checks writes resume on the new master, and that the app reads
+// back what it wrote before the failover.
+func (s *Spec) RunFailover(planName string) {
+	if !s.provision(planName) {
+		return
+	}
+
+	failoverSteps := []*reporter.Step{
+		reporter.NewStep(
+			"Check the instance is reached through sentinels",
+			func() {
+				Expect(s.ServiceKey.IsSentinel()).To(BeTrue(), fmt.Sprintf(`{"FailReason": "The service key of the '%s' plan instance lists no sentinels"}`, planName))
+			},
+		),
+	}
+	if s.ServiceKey.IsSentinelTLS() {
+		failoverSteps = append(failoverSteps,
+			reporter.NewStep("Enable tls", s.Platform.SetEnv(s.AppName, "tls_enabled", "true")),
+			reporter.NewStep("Restage app", s.Platform.Restage(s.AppName)),
+		)
+	}
+	failoverSteps = append(failoverSteps,
+		reporter.NewStep(
+			"Check the sentinels agree on a working master",
+			s.Sentinel.CheckMaster(),
+		),
+		reporter.NewStep(
+			"Write a key/value pair to Redis",
+			s.App.Write("failoverkey", "written-before-failover"),
+		),
+		reporter.NewStep(
+			"Fail the master over and wait for writes on the new master",
+			s.Sentinel.Failover("failoverprobe", "written-after-failover"),
+		),
+		reporter.NewStep(
+			"Read the key/value pair back after the failover",
+			s.App.ReadAssert("failoverkey", "written-before-failover"),
+		),
+		reporter.NewStep(
+			"Write a key/value pair through the app after the failover",
+			s.App.Write("failoverkey", "written-after-failover"),
+		),
+		reporter.NewStep(
+			"Read the new value back",
+			s.App.ReadAssert("failoverkey", "written-after-failover"),
+		),
+	)
+
+	s.perform(failoverSteps)
+}
+
+// RunShare creates an instance of planName, shares it into another space and
+// checks an app there reads what the app in the instance's own space wrote.
+// It then unshares the instance and checks the other app's binding is gone.
+func (s *Spec) RunShare(planName string, shared SharedSpace) {
+	if !s.provision(planName) {
+		return
+	}
+
+	tls := s.ServiceKey.TLSEnforced() || s.ServiceKey.IsSentinelTLS()
+	if tls {
+		s.perform([]*reporter.Step{
+			reporter.NewStep("Enable tls", s.Platform.SetEnv(s.AppName, "tls_enabled", "true")),
+			reporter.NewStep("Restage app", s.Platform.Restage(s.AppName)),
+		})
+	}
+
+	shareSteps := []*reporter.Step{
+		reporter.NewStep(
+			fmt.Sprintf("Create the space '%s' to share the instance with", shared.SpaceName),
+			s.Platform.CreateSpace(shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Create and bind security group '%s' for the shared space", shared.SecurityGroupName),
+			s.Platform.CreateAndBindSecurityGroup(shared.SecurityGroupName, s.ServiceInstanceName, s.ServiceKeyName, s.OrgName, shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Share the instance '%s' with the space '%s'", s.ServiceInstanceName, shared.SpaceName),
+			s.Platform.ShareService(s.ServiceInstanceName, s.OrgName, shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Target the space '%s'", shared.SpaceName),
+			s.Platform.TargetOrgAndSpace(s.OrgName, shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Push the redis sample app '%s' to the space '%s'", shared.AppName, shared.SpaceName),
+			s.Platform.Push(shared.AppName, shared.PushArgs...),
+		),
+	}
+	if tls {
+		shareSteps = append(shareSteps, reporter.NewStep(
+			"Enable tls in the shared space's app",
+			s.Platform.SetEnv(shared.AppName, "tls_enabled", "true"),
+		))
+	}
+	shareSteps = append(shareSteps,
+		reporter.NewStep(
+			fmt.Sprintf("Bind the redis sample app '%s' to the shared instance '%s'", shared.AppName, s.ServiceInstanceName),
+			s.Platform.BindService(shared.AppName, s.ServiceInstanceName, s.Parameters[planName].Binding),
+		),
+		reporter.NewStep(
+			"Start the app in the shared space",
+			s.Platform.Start(shared.AppName),
+		),
+		reporter.NewStep(
+			"Verify that the app in the shared space is responding",
+			shared.App.IsRunning(),
+		),
+		reporter.NewStep(
+			"Write a key/value pair to Redis",
+			s.App.Write("sharedkey", "written-in-owning-space"),
+		),
+		reporter.NewStep(
+			"Read the key/value pair back from the shared space",
+			shared.App.ReadAssert("sharedkey", "written-in-owning-space"),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Target the space '%s'", s.SpaceName),
+			s.Platform.TargetOrgAndSpace(s.OrgName, s.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Unshare the instance '%s' from the space '%s'", s.ServiceInstanceName, shared.SpaceName),
+			s.Platform.UnshareService(s.ServiceInstanceName, s.OrgName, shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Verify the binding of '%s' was removed", shared.AppName),
+			s.Platform.EnsureServiceUnbound(shared.AppName, s.ServiceInstanceName),
+		),
+	)
+
+	s.perform(shareSteps)
+}
+
+// TeardownShare targets the instance's own space again and unshares the
+// instance, removing the shared space's binding so Teardown can delete it.
+// The shared space and its app are left to be deleted with the org.
+func (s *Spec) TeardownShare(shared SharedSpace) {
+	s.perform([]*reporter.Step{
+		reporter.NewStep(
+			fmt.Sprintf("Target the space '%s'", s.SpaceName),
+			s.Platform.TargetOrgAndSpace(s.OrgName, s.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Unshare the instance '%s' from the space '%s'", s.ServiceInstanceName, shared.SpaceName),
+			s.Platform.UnshareService(s.ServiceInstanceName, s.OrgName, shared.SpaceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Delete security group '%s'", shared.SecurityGroupName),
+			s.Platform.DeleteSecurityGroup(shared.SecurityGroupName),
+		),
+	})
+}
+
+// provision creates an instance of planName, gives the app access to it and
+// starts the app. It reports false if the plan has no capacity left, in which
+// case the spec is marked skipped.
+func (s *Spec) provision(planName string) bool {
+	var skip bool
+	params := s.Parameters[planName]
+
+	enableServiceAccessStep := reporter.NewStep(
+		fmt.Sprintf("Enable service plan access for '%s' org", s.OrgName),
+		s.Platform.EnableServiceAccessForPlan(s.OrgName, s.ServiceName, planName),
+	)
+	serviceCreateStep := reporter.NewStep(
+		fmt.Sprintf("Create a '%s' plan instance of Redis\n    Please refer to http://docs.pivotal.io/redis/smoke-tests.html for more help on diagnosing this issue", planName),
+		s.Platform.CreateService(s.ServiceName, planName, s.ServiceInstanceName, params.Provision, &skip),
+	)
+
+	s.Report.RegisterSpecSteps([]*reporter.Step{enableServiceAccessStep, serviceCreateStep})
+	enableServiceAccessStep.Perform()
+	serviceCreateStep.Perform()
+
+	serviceCreateStep.Description = fmt.Sprintf("Create a '%s' plan instance of Redis", planName)
+
+	specSteps := []*reporter.Step{
+		reporter.NewStep(
+			fmt.Sprintf("Bind the redis sample app '%s' to the '%s' plan instance '%s' of Redis", s.AppName, planName, s.ServiceInstanceName),
+			s.Platform.BindService(s.AppName, s.ServiceInstanceName, params.Binding),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Create service key for the '%s' plan instance '%s' of Redis", planName, s.ServiceInstanceName),
+			s.Platform.CreateServiceKey(s.ServiceInstanceName, s.ServiceKeyName, params.ServiceKey),
+		),
+		reporter.NewStep(
+			"Read the Service Key",
+			s.Platform.GetServiceKey(s.ServiceInstanceName, s.ServiceKeyName, &s.ServiceKey),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Create and bind security group '%s' for running smoke tests", s.SecurityGroupName),
+			s.Platform.CreateAndBindSecurityGroup(s.SecurityGroupName, s.ServiceInstanceName, s.ServiceKeyName, s.OrgName, s.SpaceName),
+		),
+		reporter.NewStep(
+			"Start the app",
+			s.Platform.Start(s.AppName),
+		),
+		reporter.NewStep(
+			"Verify that the app is responding",
+			s.App.IsRunning(),
+		),
+	}
+
+	if len(params.Provision) > 0 {
+		specSteps = append(specSteps, s.verifyParametersStep(params.Provision))
+	}
+
+	s.Report.RegisterSpecSteps(specSteps)
+
+	if skip {
+		serviceCreateStep.Result = "SKIPPED"
+		return false
+	}
+	s.perform(specSteps)
+	return true
+}
+
+// Teardown removes everything Run and the spec setup created, dependents
+// first. It is safe to call after a partial or skipped Run.
+func (s *Spec) Teardown(planName string) {
+	s.perform([]*reporter.Step{
+		reporter.NewStep(
+			fmt.Sprintf("Unbind the %q plan instance", planName),
+			s.Platform.UnbindService(s.AppName, s.ServiceInstanceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Delete security group '%s'", s.SecurityGroupName),
+			s.Platform.DeleteSecurityGroup(s.SecurityGroupName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Delete the service key %s for the %q plan instance", s.ServiceKeyName, planName),
+			s.Platform.DeleteServiceKey(s.ServiceInstanceName, s.ServiceKeyName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Delete the %q plan instance", planName),
+			s.Platform.DeleteService(s.ServiceInstanceName),
+		),
+		reporter.NewStep(
+			fmt.Sprintf("Ensure service instance for plan %q has been deleted", planName),
+			s.Platform.EnsureServiceInstanceGone(s.ServiceInstanceName),
+		),
+		reporter.NewStep(
+			"Delete the app",
+			s.Platform.Delete(s.AppName),
+		),
+	})
+}
+
+// verifyParametersStep checks the broker holds the expected parameters for
+// the instance. It passes with a note if the broker does not allow fetching
+// them.
+func (s *Spec) verifyParametersStep(expected cf.Parameters) *reporter.Step {
+	return reporter.NewStep(
+		fmt.Sprintf("Verify the parameters of the instance '%s'", s.ServiceInstanceName),
+		func() {
+			var actual cf.Parameters
+			var supported bool
+			s.Platform.GetServiceParameters(s.ServiceInstanceName, &actual, &supported)()
+
+			if !supported {
+				fmt.Printf("The broker does not support fetching the parameters of service instance %s\n", s.ServiceInstanceName)
+				return
+			}
+
+			mismatches := actual.Mismatches(expected)
+			Expect(mismatches).To(BeEmpty(), fmt.Sprintf(`{"FailReason": "Service instance parameters differ from those requested: %s"}`, strings.Join(mismatches, ", ")))
+		},
+	)
+}
+
+// dataTypeStep checks one of DataTypes through the app.
+func (s *Spec) dataTypeStep(dataType string) *reporter.Step {
+	description := fmt.Sprintf("Check %s through the app", strings.ReplaceAll(dataType, "_", " "))
+
+	switch dataType {
+	case "lists":
+		return reporter.NewStep(description, s.App.CheckList("listkey", "first", "second", "third"))
+	case "hashes":
+		return reporter.NewStep(description, s.App.CheckHash("hashkey", map[string]string{"name": "redis", "kind": "hash"}))
+	case "sets":
+		return reporter.NewStep(description, s.App.CheckSet("setkey", "red", "green", "blue"))
+	case "sorted_sets":
+		return reporter.NewStep(description, s.App.CheckSortedSet("zsetkey", map[string]float64{"gold": 1, "silver": 2, "bronze": 3}))
+	case "streams":
+		return reporter.NewStep(description, s.App.CheckStream("streamkey", "smoke-tests", "consumer-1", "first", "second", "third"))
+	case "expiry":
+		return reporter.NewStep(description, s.App.CheckExpiry("ttlkey", "expiring", 5*time.Second))
+	case "incr":
+		return reporter.NewStep(description, s.App.CheckIncr("counterkey", 20))
+	}
+
+	return reporter.NewStep(fmt.Sprintf("Check the data type '%s'", dataType), func() {
+		Expect(DataTypes).To(ContainElement(dataType), fmt.Sprintf(`{"FailReason": "Unknown data type '%s', expected one of %s"}`, dataType, strings.Join(DataTypes, ", ")))
+	})
+}
+
+func (s *Spec) tlsStep(version, key, value string) *reporter.Step {
+	tlsMessage := strings.ToUpper(version) + " clients are disabled"
+	valueCheck := "protocol not supported"
+	if s.ServiceKey.HasTLSVersion(version) {
+		tlsMessage = strings.ToUpper(version) + " clients are enabled"
+		valueCheck = value
+	}
+	return reporter.NewStep(tlsMessage, s.App.ReadTLSAssert(version, key, valueCheck))
+}
+
+// perform registers steps with the report and runs them in order.
+func (s *Spec) perform(steps []*reporter.Step) {
+	s.Report.RegisterSpecSteps(steps)
+	for _, step := range steps {
+		step.Perform()
+	}
+}
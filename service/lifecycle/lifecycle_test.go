@@ -0,0 +1,679 @@
+package lifecycle_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/fake"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/lifecycle"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+)
+
+var _ = Describe("Spec", func() {
+	var (
+		platform *fake.Platform
+		report   *reporter.SmokeTestReport
+		spec     *lifecycle.Spec
+	)
+
+	results := func() map[string]string {
+		results := map[string]string{}
+		for _, step := range report.SpecSteps() {
+			results[step.Description] = step.Result
+		}
+		return results
+	}
+
+	BeforeEach(func() {
+		platform = fake.New()
+		platform.FailHandler = func(message string, _ ...int) { panic(message) }
+		platform.Plans = map[string]fake.Plan{
+			"dedicated-vm": {
+				Credentials: cf.Credentials{Host: "10.0.0.1", Port: 6379},
+			},
+		}
+
+		report = new(reporter.SmokeTestReport)
+		spec = &lifecycle.Spec{
+			Platform:            platform,
+			App:                 platform.App("some-app"),
+			Report:              report,
+			ServiceName:         "p-redis",
+			OrgName:             "some-org",
+			SpaceName:           "some-space",
+			AppName:             "some-app",
+			ServiceInstanceName: "some-instance",
+			SecurityGroupName:   "some-security-group",
+			ServiceKeyName:      "some-key",
+		}
+
+		platform.API("api.example.com", false)()
+		platform.Auth("admin", "admin")()
+		platform.TargetOrgAndSpace("some-org", "some-space")()
+		platform.Push("some-app", "--no-start")()
+	})
+
+	It("binds, reads and writes through the standard port, then tears down dependents first", func() {
+		spec.Run("dedicated-vm")
+
+		instance, ok := platform.Instance("some-instance")
+		Expect(ok).To(BeTrue())
+		Expect(instance.Data).To(Equal(map[string]string{"mykey": "myvalue"}))
+		Expect(platform.Env("some-app", "tls_enabled")).To(BeEmpty())
+		Expect(spec.ServiceKey.Host).To(Equal("10.0.0.1"))
+
+		spec.Teardown("dedicated-vm")
+
+		Expect(platform.Instances()).To(BeEmpty())
+		Expect(platform.Apps()).To(BeEmpty())
+		Expect(platform.Operations()[4:]).To(Equal([]string{
+			"EnableServiceAccessForPlan",
+			"CreateService",
+			"BindService",
+			"CreateServiceKey",
+			"GetServiceKey",
+			"CreateAndBindSecurityGroup",
+			"Start",
+			"UnbindService",
+			"DeleteSecurityGroup",
+			"DeleteServiceKey",
+			"DeleteService",
+			"EnsureServiceInstanceGone",
+			"Delete",
+		}))
+		for description, result := range results() {
+			Expect(result).To(Equal("PASSED"), description)
+		}
+	})
+
+	It("waits for the instance to be provisioned", func() {
+		platform.Plans["dedicated-vm"] = fake.Plan{
+			Credentials:    cf.Credentials{Host: "10.0.0.1", Port: 6379},
+			ProvisionPolls: 3,
+		}
+
+		spec.Run("dedicated-vm")
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.LastOperation.State).To(Equal(cf.OperationSucceeded))
+		Expect(instance.Polls).To(Equal(4))
+	})
+
+	It("skips the remaining steps when the plan's quota is exhausted", func() {
+		platform.Plans["dedicated-vm"] = fake.Plan{Exhausted: true}
+
+		spec.Run("dedicated-vm")
+
+		Expect(platform.Instances()).To(BeEmpty())
+		Expect(platform.Operations()).NotTo(ContainElement("BindService"))
+		Expect(results()).To(HaveKeyWithValue("Create a 'dedicated-vm' plan instance of Redis", "SKIPPED"))
+		Expect(results()).To(HaveKeyWithValue("Start the app", "DIDN'T RUN"))
+	})
+
+	It("stops at the first failing step and reports the broker's description", func() {
+		platform.Plans["dedicated-vm"] = fake.Plan{ProvisionError: "no capacity in az1"}
+
+		Expect(func() { spec.Run("dedicated-vm") }).To(PanicWith(ContainSubstring("no capacity in az1")))
+		Expect(results()).To(HaveKeyWithValue(ContainSubstring("Create a 'dedicated-vm' plan instance"), "FAILED"))
+		Expect(platform.Operations()).NotTo(ContainElement("BindService"))
+	})
+
+	It("tears down after a partial run", func() {
+		platform.FailOn("Start", "app crashed")
+
+		Expect(func() { spec.Run("dedicated-vm") }).To(PanicWith(ContainSubstring("app crashed")))
+		Expect(results()).To(HaveKeyWithValue("Start the app", "FAILED"))
+		Expect(results()).To(HaveKeyWithValue("Verify that the app is responding", "DIDN'T RUN"))
+
+		spec.Teardown("dedicated-vm")
+
+		Expect(platform.Instances()).To(BeEmpty())
+		_, exists := platform.SecurityGroup("some-security-group")
+		Expect(exists).To(BeFalse())
+	})
+
+	It("leaves a report of the failed deprovision", func() {
+		platform.Plans["dedicated-vm"] = fake.Plan{
+			Credentials:      cf.Credentials{Host: "10.0.0.1", Port: 6379},
+			DeprovisionError: "failed to delete VM",
+		}
+		spec.Run("dedicated-vm")
+
+		Expect(func() { spec.Teardown("dedicated-vm") }).To(PanicWith(ContainSubstring("delete failed")))
+		Expect(results()).To(HaveKeyWithValue(`Ensure service instance for plan "dedicated-vm" has been deleted`, "FAILED"))
+	})
+
+	Context("when the instance has a TLS port", func() {
+		BeforeEach(func() {
+			platform.Plans["dedicated-vm"] = fake.Plan{
+				Credentials: cf.Credentials{
+					Host:        "10.0.0.1",
+					Port:        6379,
+					TLSPort:     16379,
+					TLSVersions: []string{"tlsv1.2", "tlsv1.3"},
+				},
+			}
+		})
+
+		It("checks both ports and which TLS versions are enabled", func() {
+			spec.Run("dedicated-vm")
+
+			Expect(platform.Env("some-app", "tls_enabled")).To(Equal("true"))
+			Expect(results()).To(SatisfyAll(
+				HaveKeyWithValue("Read the key/value pair back", "PASSED"),
+				HaveKeyWithValue("TLS: Read the key/value pair back", "PASSED"),
+				HaveKeyWithValue("TLSV1 clients are disabled", "PASSED"),
+				HaveKeyWithValue("TLSV1.1 clients are disabled", "PASSED"),
+				HaveKeyWithValue("TLSV1.2 clients are enabled", "PASSED"),
+				HaveKeyWithValue("TLSV1.3 clients are enabled", "PASSED"),
+			))
+		})
+
+		It("skips the standard port when TLS is enforced", func() {
+			plan := platform.Plans["dedicated-vm"]
+			plan.Credentials.Port = 0
+			platform.Plans["dedicated-vm"] = plan
+
+			spec.Run("dedicated-vm")
+
+			Expect(results()).NotTo(HaveKey("Read the key/value pair back"))
+			Expect(results()).To(HaveKeyWithValue("TLS: Read the key/value pair back", "PASSED"))
+		})
+	})
+
+	Context("when the plan has data type checks", func() {
+		BeforeEach(func() {
+			spec.DataTypes = map[string][]string{"dedicated-vm": {"lists", "sorted_sets", "streams", "expiry", "incr"}}
+		})
+
+		It("runs each through the app as its own step", func() {
+			spec.Run("dedicated-vm")
+
+			Expect(results()).To(SatisfyAll(
+				HaveKeyWithValue("Check lists through the app", "PASSED"),
+				HaveKeyWithValue("Check sorted sets through the app", "PASSED"),
+				HaveKeyWithValue("Check streams through the app", "PASSED"),
+				HaveKeyWithValue("Check expiry through the app", "PASSED"),
+				HaveKeyWithValue("Check incr through the app", "PASSED"),
+				Not(HaveKey("Check hashes through the app")),
+			))
+
+			instance, _ := platform.Instance("some-instance")
+			Expect(instance.Data).To(SatisfyAll(
+				HaveKeyWithValue("listkey", "first,second,third"),
+				HaveKeyWithValue("zsetkey", "bronze:3,gold:1,silver:2"),
+				HaveKeyWithValue("counterkey", "20"),
+				Not(HaveKey("ttlkey")),
+			))
+		})
+
+		It("only runs the checks enabled for the plan", func() {
+			spec.DataTypes = map[string][]string{"other-plan": {"hashes"}}
+
+			spec.Run("dedicated-vm")
+
+			Expect(results()).NotTo(HaveKey(HaveSuffix("through the app")))
+		})
+
+		It("fails the check whose command the instance has disabled", func() {
+			plan := platform.Plans["dedicated-vm"]
+			plan.DisabledCommands = []string{"XREADGROUP"}
+			platform.Plans["dedicated-vm"] = plan
+
+			Expect(func() { spec.Run("dedicated-vm") }).To(PanicWith(ContainSubstring("ERR unknown command 'XREADGROUP'")))
+			Expect(results()).To(HaveKeyWithValue("Check sorted sets through the app", "PASSED"))
+			Expect(results()).To(HaveKeyWithValue("Check streams through the app", "FAILED"))
+			Expect(results()).To(HaveKeyWithValue("Check expiry through the app", "DIDN'T RUN"))
+		})
+
+		It("fails for data types it does not know", func() {
+			spec.DataTypes = map[string][]string{"dedicated-vm": {"geospatial"}}
+
+			err := InterceptGomegaFailure(func() { spec.Run("dedicated-vm") })
+			Expect(err).To(MatchError(ContainSubstring("Unknown data type 'geospatial'")))
+			Expect(results()).To(HaveKeyWithValue("Check the data type 'geospatial'", "FAILED"))
+		})
+	})
+
+	Context("when the plan has parameters", func() {
+		BeforeEach(func() {
+			spec.Parameters = map[string]lifecycle.PlanParameters{
+				"dedicated-vm": {
+					Provision:  cf.Parameters{"maxmemory-policy": "noeviction"},
+					ServiceKey: cf.Parameters{"read-only": true},
+					Binding:    cf.Parameters{"timeout": 5.0},
+				},
+			}
+		})
+
+		It("passes them to the broker and verifies the instance's", func() {
+			spec.Run("dedicated-vm")
+
+			instance, _ := platform.Instance("some-instance")
+			Expect(instance.Parameters).To(Equal(cf.Parameters{"maxmemory-policy": "noeviction"}))
+			Expect(instance.KeyParameters).To(HaveKeyWithValue("some-key", cf.Parameters{"read-only": true}))
+			Expect(instance.BindingParameters).To(HaveKeyWithValue("some-app", cf.Parameters{"timeout": 5.0}))
+			Expect(platform.Calls()).To(ContainElement(fake.Call{
+				Operation: "CreateService",
+				Args:      []string{"p-redis", "dedicated-vm", "some-instance", "-c", `{"maxmemory-policy":"noeviction"}`},
+			}))
+			Expect(results()).To(HaveKeyWithValue("Verify the parameters of the instance 'some-instance'", "PASSED"))
+		})
+
+		It("passes the verification when the broker cannot fetch them", func() {
+			plan := platform.Plans["dedicated-vm"]
+			plan.ParametersNotRetrievable = true
+			platform.Plans["dedicated-vm"] = plan
+
+			spec.Run("dedicated-vm")
+
+			Expect(results()).To(HaveKeyWithValue("Verify the parameters of the instance 'some-instance'", "PASSED"))
+		})
+	})
+
+	It("does not verify parameters that were not requested", func() {
+		spec.Run("dedicated-vm")
+
+		Expect(platform.Operations()).NotTo(ContainElement("GetServiceParameters"))
+	})
+
+	It("enables TLS before the standard port checks for sentinel TLS", func() {
+		platform.Plans["dedicated-vm"] = fake.Plan{
+			Credentials: cf.Credentials{
+				Sentinels: []cf.HostPort{{Host: "10.0.0.1", Port: 26379, TLSPort: 26380}},
+			},
+		}
+
+		spec.Run("dedicated-vm")
+
+		Expect(platform.Operations()).To(ContainElements("SetEnv", "Restage"))
+		Expect(results()).To(HaveKeyWithValue("Read the key/value pair back", "PASSED"))
+	})
+
+	Context("with checks from the test runner", func() {
+		var check *fakeRunnerCheck
+
+		plainPlan := fake.Plan{
+			Credentials: cf.Credentials{Host: "10.0.0.1", Port: 6379},
+		}
+		tlsPlan := fake.Plan{
+			Credentials: cf.Credentials{Host: "10.0.0.1", Port: 6379, TLSPort: 16379, TLSVersions: []string{"tlsv1.2", "tlsv1.3"}},
+		}
+		sentinelPlan := fake.Plan{
+			Credentials: cf.Credentials{MasterName: "mymaster", Sentinels: []cf.HostPort{{Host: "10.0.0.1", Port: 26379}}},
+		}
+
+		BeforeEach(func() {
+			check = newFakeRunnerCheck(platform, "some-instance")
+			spec.Probe = fakeProbe{check}
+			spec.Sentinel = check
+			spec.TLSCheck = fakeTLSCheck{check}
+			spec.CertCheck = fakeCertCheck{check}
+		})
+
+		DescribeTable("runs each check the instance has ports for as its own step",
+			func(plan fake.Plan, step string) {
+				platform.Plans["dedicated-vm"] = plan
+
+				spec.Run("dedicated-vm")
+
+				Expect(results()).To(HaveKeyWithValue(step, "PASSED"))
+			},
+			Entry("the probe", plainPlan, "Probe Redis directly from the test runner"),
+			Entry("the TLS versions", tlsPlan, "Check the TLS versions the instance accepts from the test runner"),
+			Entry("the certificates", tlsPlan, "Inspect the certificates of the instance's TLS ports"),
+			Entry("the sentinels' master", sentinelPlan, "Check the sentinels agree on a working master"),
+		)
+
+		DescribeTable("stops with the error of a failing check",
+			func(plan fake.Plan, method, step string) {
+				platform.Plans["dedicated-vm"] = plan
+				check.fail(method, "some check error")
+
+				Expect(func() { spec.Run("dedicated-vm") }).To(PanicWith(ContainSubstring("some check error")))
+				Expect(results()).To(HaveKeyWithValue(step, "FAILED"))
+			},
+			Entry("the probe", plainPlan, "Probe", "Probe Redis directly from the test runner"),
+			Entry("the TLS versions", tlsPlan, "TLSCheck", "Check the TLS versions the instance accepts from the test runner"),
+			Entry("the certificates", tlsPlan, "CertCheck", "Inspect the certificates of the instance's TLS ports"),
+			Entry("the sentinels' master", sentinelPlan, "CheckMaster", "Check the sentinels agree on a working master"),
+		)
+
+		DescribeTable("skips checks the instance has no ports for",
+			func(step string) {
+				platform.Plans["dedicated-vm"] = plainPlan
+
+				spec.Run("dedicated-vm")
+
+				Expect(results()).NotTo(HaveKey(step))
+			},
+			Entry("the TLS versions", "Check the TLS versions the instance accepts from the test runner"),
+			Entry("the certificates", "Inspect the certificates of the instance's TLS ports"),
+			Entry("the sentinels' master", "Check the sentinels agree on a working master"),
+		)
+
+		It("probes the instance before the app's checks", func() {
+			check.fail("Probe", "connection refused")
+
+			Expect(func() { spec.Run("dedicated-vm") }).To(PanicWith(ContainSubstring("connection refused")))
+			instance, _ := platform.Instance("some-instance")
+			Expect(instance.Data).NotTo(HaveKey("mykey"))
+		})
+
+		It("keeps what the certificate inspection noted in the step's report", func() {
+			platform.Plans["dedicated-vm"] = tlsPlan
+
+			spec.Run("dedicated-vm")
+
+			var certStep *reporter.Step
+			for _, step := range report.SpecSteps() {
+				if step.Description == "Inspect the certificates of the instance's TLS ports" {
+					certStep = step
+				}
+			}
+			Expect(certStep).NotTo(BeNil())
+			Expect(certStep.Notes).To(ConsistOf(ContainSubstring("10.0.0.1:16379 certificate 0")))
+		})
+	})
+})
+
+var _ = Describe("Spec.RunFailover", func() {
+	var (
+		platform *fake.Platform
+		check    *fakeRunnerCheck
+		report   *reporter.SmokeTestReport
+		spec     *lifecycle.Spec
+	)
+
+	BeforeEach(func() {
+		platform = fake.New()
+		platform.FailHandler = func(message string, _ ...int) { panic(message) }
+		platform.Plans = map[string]fake.Plan{
+			"sentinel": {
+				Credentials: cf.Credentials{
+					MasterName: "mymaster",
+					Sentinels:  []cf.HostPort{{Host: "10.0.0.1", Port: 26379}, {Host: "10.0.0.2", Port: 26379}},
+				},
+			},
+		}
+
+		check = newFakeRunnerCheck(platform, "some-instance")
+		report = new(reporter.SmokeTestReport)
+		spec = &lifecycle.Spec{
+			Platform:            platform,
+			App:                 platform.App("some-app"),
+			Sentinel:            check,
+			Report:              report,
+			ServiceName:         "p-redis",
+			OrgName:             "some-org",
+			SpaceName:           "some-space",
+			AppName:             "some-app",
+			ServiceInstanceName: "some-instance",
+			SecurityGroupName:   "some-security-group",
+			ServiceKeyName:      "some-key",
+		}
+
+		platform.API("api.example.com", false)()
+		platform.Auth("admin", "admin")()
+		platform.TargetOrgAndSpace("some-org", "some-space")()
+		platform.Push("some-app", "--no-start")()
+	})
+
+	It("fails the master over and reads and writes through the app afterwards", func() {
+		spec.RunFailover("sentinel")
+
+		for _, step := range report.SpecSteps() {
+			Expect(step.Result).To(Equal("PASSED"), step.Description)
+		}
+
+		Expect(check.failovers).To(Equal(1))
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.Data).To(Equal(map[string]string{
+			"failoverkey":   "written-after-failover",
+			"failoverprobe": "written-after-failover",
+		}))
+	})
+
+	It("stops with the sentinel's error when the failover fails", func() {
+		check.fail("Failover", "NOGOODSLAVE No suitable replica to promote")
+
+		Expect(func() { spec.RunFailover("sentinel") }).To(PanicWith(ContainSubstring("NOGOODSLAVE")))
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.Data).To(Equal(map[string]string{"failoverkey": "written-before-failover"}))
+	})
+
+	It("enables TLS first when the sentinels use TLS", func() {
+		plan := platform.Plans["sentinel"]
+		plan.Credentials.Sentinels = []cf.HostPort{{Host: "10.0.0.1", TLSPort: 26380}}
+		platform.Plans["sentinel"] = plan
+
+		spec.RunFailover("sentinel")
+
+		Expect(platform.Env("some-app", "tls_enabled")).To(Equal("true"))
+	})
+})
+
+var _ = Describe("Spec.RunUpdate", func() {
+	var (
+		platform *fake.Platform
+		report   *reporter.SmokeTestReport
+		spec     *lifecycle.Spec
+	)
+
+	BeforeEach(func() {
+		platform = fake.New()
+		platform.FailHandler = func(message string, _ ...int) { panic(message) }
+		platform.Plans = map[string]fake.Plan{
+			"cache-small": {
+				Credentials:        cf.Credentials{Host: "10.0.0.1", Port: 6379},
+				MaintenanceVersion: "1.0.0",
+			},
+			"cache-medium": {
+				Credentials:        cf.Credentials{Host: "10.0.0.1", Port: 6379},
+				UpdatePolls:        2,
+				MaintenanceVersion: "1.0.0",
+			},
+		}
+
+		report = new(reporter.SmokeTestReport)
+		spec = &lifecycle.Spec{
+			Platform:            platform,
+			App:                 platform.App("some-app"),
+			Report:              report,
+			ServiceName:         "p-redis",
+			OrgName:             "some-org",
+			SpaceName:           "some-space",
+			AppName:             "some-app",
+			ServiceInstanceName: "some-instance",
+			SecurityGroupName:   "some-security-group",
+			ServiceKeyName:      "some-key",
+		}
+
+		platform.API("api.example.com", false)()
+		platform.Auth("admin", "admin")()
+		platform.TargetOrgAndSpace("some-org", "some-space")()
+		platform.Push("some-app", "--no-start")()
+	})
+
+	It("moves the instance to the new plan and reads back what was written before", func() {
+		spec.RunUpdate(lifecycle.PlanUpdate{From: "cache-small", To: "cache-medium"})
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.Plan).To(Equal("cache-medium"))
+		Expect(instance.LastOperation).To(Equal(cf.LastOperation{Type: "update", State: cf.OperationSucceeded}))
+		Expect(instance.Data).To(HaveKeyWithValue("updatekey", "written-before-update"))
+
+		for _, step := range report.SpecSteps() {
+			Expect(step.Result).To(Equal("PASSED"), step.Description)
+		}
+	})
+
+	It("upgrades the instance when the plan has a newer maintenance version", func() {
+		platform.EnableServiceAccessForPlan("some-org", "p-redis", "cache-small")()
+		platform.CreateService("p-redis", "cache-small", "some-instance", nil, new(bool))()
+
+		plan := platform.Plans["cache-small"]
+		plan.MaintenanceVersion = "1.1.0"
+		platform.Plans["cache-small"] = plan
+
+		spec.RunUpdate(lifecycle.PlanUpdate{From: "cache-small", Upgrade: true})
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.MaintenanceVersion).To(Equal("1.1.0"))
+		Expect(platform.Calls()).To(ContainElement(fake.Call{Operation: "UpdateService", Args: []string{"some-instance", "", "true"}}))
+	})
+
+	It("passes the update parameters and verifies they were merged into the instance's", func() {
+		spec.Parameters = map[string]lifecycle.PlanParameters{
+			"cache-small":  {Provision: cf.Parameters{"maxmemory-policy": "noeviction"}},
+			"cache-medium": {Update: cf.Parameters{"maxclients": 1000.0}},
+		}
+
+		spec.RunUpdate(lifecycle.PlanUpdate{From: "cache-small", To: "cache-medium"})
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.Parameters).To(Equal(cf.Parameters{"maxmemory-policy": "noeviction", "maxclients": 1000.0}))
+		Expect(platform.Calls()).To(ContainElement(fake.Call{
+			Operation: "UpdateService",
+			Args:      []string{"some-instance", "cache-medium", "false", "-c", `{"maxclients":1000}`},
+		}))
+		for _, step := range report.SpecSteps() {
+			Expect(step.Result).To(Equal("PASSED"), step.Description)
+		}
+	})
+
+	It("fails with the broker's description when the update fails", func() {
+		plan := platform.Plans["cache-medium"]
+		plan.UpdateError = "cannot shrink persistent disk"
+		platform.Plans["cache-medium"] = plan
+
+		Expect(func() {
+			spec.RunUpdate(lifecycle.PlanUpdate{From: "cache-small", To: "cache-medium"})
+		}).To(PanicWith(ContainSubstring("update failed: cannot shrink persistent disk")))
+	})
+})
+
+var _ = Describe("ValidateDataTypes", func() {
+	It("accepts the known data types", func() {
+		Expect(lifecycle.ValidateDataTypes(map[string][]string{"cache-small": lifecycle.DataTypes})).To(Succeed())
+	})
+
+	It("rejects a data type it does not know", func() {
+		Expect(lifecycle.ValidateDataTypes(map[string][]string{"cache-small": {"lists", "geospatial"}})).To(MatchError(
+			`unknown data type "geospatial" for plan cache-small, expected one of lists, hashes, sets, sorted_sets, streams, expiry, incr`,
+		))
+	})
+})
+
+var _ = Describe("PlanUpdate.Validate", func() {
+	parameters := map[string]lifecycle.PlanParameters{
+		"cache-small": {Update: cf.Parameters{"maxclients": 1000.0}},
+	}
+
+	DescribeTable("accepts an update that changes something",
+		func(update lifecycle.PlanUpdate) {
+			Expect(update.Validate(parameters)).To(Succeed())
+		},
+		Entry("to another plan", lifecycle.PlanUpdate{From: "cache-medium", To: "cache-large"}),
+		Entry("an upgrade", lifecycle.PlanUpdate{From: "cache-medium", Upgrade: true}),
+		Entry("update parameters for its plan", lifecycle.PlanUpdate{From: "cache-small"}),
+	)
+
+	It("rejects an update with no from plan", func() {
+		Expect(lifecycle.PlanUpdate{To: "cache-large"}.Validate(parameters)).To(MatchError("plan update has no from plan"))
+	})
+
+	It("rejects an update that changes nothing", func() {
+		Expect(lifecycle.PlanUpdate{From: "cache-medium"}.Validate(parameters)).To(MatchError(
+			"plan update of cache-medium has no to plan, no upgrade and no update parameters",
+		))
+	})
+})
+
+var _ = Describe("Spec.RunShare", func() {
+	var (
+		platform *fake.Platform
+		report   *reporter.SmokeTestReport
+		spec     *lifecycle.Spec
+		shared   lifecycle.SharedSpace
+	)
+
+	BeforeEach(func() {
+		platform = fake.New()
+		platform.FailHandler = func(message string, _ ...int) { panic(message) }
+		platform.Plans = map[string]fake.Plan{
+			"dedicated-vm": {
+				Credentials: cf.Credentials{Host: "10.0.0.1", Port: 6379},
+			},
+		}
+
+		report = new(reporter.SmokeTestReport)
+		spec = &lifecycle.Spec{
+			Platform:            platform,
+			App:                 platform.App("some-app"),
+			Report:              report,
+			ServiceName:         "p-redis",
+			OrgName:             "some-org",
+			SpaceName:           "some-space",
+			AppName:             "some-app",
+			ServiceInstanceName: "some-instance",
+			SecurityGroupName:   "some-security-group",
+			ServiceKeyName:      "some-key",
+		}
+		shared = lifecycle.SharedSpace{
+			SpaceName:         "other-space",
+			AppName:           "other-app",
+			App:               platform.App("other-app"),
+			PushArgs:          []string{"--no-start"},
+			SecurityGroupName: "other-security-group",
+		}
+
+		platform.API("api.example.com", false)()
+		platform.Auth("admin", "admin")()
+		platform.TargetOrgAndSpace("some-org", "some-space")()
+		platform.Push("some-app", "--no-start")()
+	})
+
+	It("reads from the shared space what was written in the owning space, then removes the binding on unshare", func() {
+		spec.RunShare("dedicated-vm", shared)
+
+		for _, step := range report.SpecSteps() {
+			Expect(step.Result).To(Equal("PASSED"), step.Description)
+		}
+
+		instance, _ := platform.Instance("some-instance")
+		Expect(instance.Data).To(HaveKeyWithValue("sharedkey", "written-in-owning-space"))
+		Expect(instance.SharedSpaces).To(BeEmpty())
+		Expect(instance.BoundApps).To(Equal([]string{"some-app"}))
+		spaces, _ := platform.SecurityGroup("other-security-group")
+		Expect(spaces).To(Equal([]string{"some-org/other-space"}))
+		Expect(platform.Operations()).To(ContainElements("ShareService", "UnshareService", "EnsureServiceUnbound"))
+	})
+
+	It("stops before binding in the other space when the share fails", func() {
+		platform.FailOn("ShareService", "service instance sharing is disabled")
+
+		Expect(func() {
+			spec.RunShare("dedicated-vm", shared)
+		}).To(PanicWith(ContainSubstring("Failed to share some-instance instance with space other-space: service instance sharing is disabled")))
+		Expect(platform.Calls()).NotTo(ContainElement(fake.Call{Operation: "BindService", Args: []string{"other-app", "some-instance"}}))
+	})
+
+	It("leaves the instance deletable after a partial run", func() {
+		platform.FailOn("Start", "staging failed")
+
+		Expect(func() {
+			spec.RunShare("dedicated-vm", shared)
+		}).To(Panic())
+		platform.Recover("Start")
+
+		spec.TeardownShare(shared)
+		spec.Teardown("dedicated-vm")
+
+		Expect(platform.Instances()).To(BeEmpty())
+		_, ok := platform.SecurityGroup("other-security-group")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,84 @@
+package lifecycle_test
+
+import (
+	"fmt"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/cf/fake"
+)
+
+// fakeRunnerCheck stands in for every check the redis package runs from the
+// test runner. A check fails with the error set for it by fail, keyed by the
+// lifecycle interface method; otherwise it writes what the real check would
+// to the instance. fakeProbe, fakeTLSCheck and fakeCertCheck adapt it to the
+// interfaces whose Check methods differ.
+type fakeRunnerCheck struct {
+	platform     *fake.Platform
+	instanceName string
+	errs         map[string]string
+	notes        []string
+	failovers    int
+}
+
+func newFakeRunnerCheck(platform *fake.Platform, instanceName string) *fakeRunnerCheck {
+	return &fakeRunnerCheck{
+		platform:     platform,
+		instanceName: instanceName,
+		errs:         map[string]string{},
+		notes:        []string{"10.0.0.1:16379 certificate 0 \"redis\": SHA-256 00:11:22, not after 2030-01-01T00:00:00Z"},
+	}
+}
+
+func (c *fakeRunnerCheck) fail(method, err string) {
+	c.errs[method] = err
+}
+
+func (c *fakeRunnerCheck) run(method string, pass func(data map[string]string)) func() {
+	return func() {
+		if err, ok := c.errs[method]; ok {
+			c.platform.FailHandler(fmt.Sprintf(`{"FailReason": "%s failed: %s"}`, method, err), 1)
+			return
+		}
+		instance, ok := c.platform.Instance(c.instanceName)
+		if !ok {
+			c.platform.FailHandler(fmt.Sprintf(`{"FailReason": "%s failed: no instance %s"}`, method, c.instanceName), 1)
+			return
+		}
+		if pass != nil {
+			pass(instance.Data)
+		}
+	}
+}
+
+func (c *fakeRunnerCheck) CheckMaster() func() {
+	return c.run("CheckMaster", nil)
+}
+
+// Failover keeps the instance's data, as a promoted replica would.
+func (c *fakeRunnerCheck) Failover(key, value string) func() {
+	return c.run("Failover", func(data map[string]string) {
+		c.failovers++
+		data[key] = value
+	})
+}
+
+type fakeProbe struct{ *fakeRunnerCheck }
+
+func (p fakeProbe) Check(key, value string) func() {
+	return p.run("Probe", func(data map[string]string) { data[key] = value })
+}
+
+type fakeTLSCheck struct{ *fakeRunnerCheck }
+
+func (c fakeTLSCheck) Check() func() {
+	return c.run("TLSCheck", nil)
+}
+
+type fakeCertCheck struct{ *fakeRunnerCheck }
+
+func (c fakeCertCheck) Check(note func(string)) func() {
+	return c.run("CertCheck", func(map[string]string) {
+		for _, n := range c.notes {
+			note(n)
+		}
+	})
+}
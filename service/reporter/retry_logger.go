@@ -0,0 +1,38 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+)
+
+// NewRetryLogger returns a retry.Observer that writes a line to w for every
+// attempt that will be retried, and for every retry loop that gives up.
+func NewRetryLogger(w io.Writer) retry.Observer {
+	return retry.Observer{
+		OnAttempt: func(event retry.AttemptEvent) {
+			if event.Met || event.Number == event.MaxAttempts {
+				return
+			}
+			fmt.Fprintf(w, "Retrying %s: attempt %d/%d %s, next attempt in %s\n",
+				describeCommand(event.Attempt), event.Number, event.MaxAttempts, event.Attempt.Status(), event.NextSleep)
+		},
+		OnGiveUp: func(event retry.GiveUpEvent) {
+			last, ok := event.Outcome.LastAttempt()
+			if !ok {
+				fmt.Fprintf(w, "Gave up before any attempt: %s\n", event.Outcome.Reason)
+				return
+			}
+			fmt.Fprintf(w, "Gave up on %s after %d attempts: %s\n",
+				describeCommand(last), len(event.Outcome.Attempts), event.Outcome.Reason)
+		},
+	}
+}
+
+func describeCommand(attempt retry.Attempt) string {
+	if attempt.Command == "" {
+		return "operation"
+	}
+	return fmt.Sprintf("`%s`", attempt.Command)
+}
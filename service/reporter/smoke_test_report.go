@@ -3,12 +3,15 @@ package reporter
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/ginkgo/v2/config"
 	"github.com/onsi/ginkgo/v2/types"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
 )
 
 type Step struct {
@@ -16,14 +19,32 @@ type Step struct {
 	Result      string
 	Task        func()
 	Duration    time.Duration
+	Retries     []retry.RetryOutcome
+	// Notes are what the task found worth reporting, printed under the
+	// step's result.
+	Notes []string
+	// Clock times the step. It defaults to the wall clock.
+	Clock retry.Clock
+}
+
+// Note adds a line to the step's report. Tasks are given it to report what
+// they find, e.g. certificate details, whether or not they pass.
+func (step *Step) Note(note string) {
+	step.Notes = append(step.Notes, note)
 }
 
 func (step *Step) Perform() {
+	clock := step.Clock
+	if clock == nil {
+		clock = retry.RealClock
+	}
+
 	step.Result = "FAILED"
-	start := time.Now()
+	defer retry.Track(&step.Retries)()
+	start := clock.Now()
 	step.Task()
 	step.Result = "PASSED"
-	step.Duration = time.Since(start)
+	step.Duration = clock.Now().Sub(start)
 }
 
 func NewStep(description string, task func()) *Step {
@@ -59,6 +80,11 @@ func (report *SmokeTestReport) RegisterSpecSteps(steps []*Step) {
 	report.specSteps = append(report.specSteps, steps...)
 }
 
+// SpecSteps returns the steps registered for the running spec.
+func (report *SmokeTestReport) SpecSteps() []*Step {
+	return report.specSteps
+}
+
 func (report *SmokeTestReport) ClearSpecSteps() {
 	report.specSteps = []*Step{}
 }
@@ -119,6 +145,12 @@ func (report *SmokeTestReport) SpecDidComplete(summary *types.SpecSummary) {
 	count := len(report.specSteps)
 	for i, step := range report.specSteps {
 		fmt.Printf("[%d/%d] %s: %s Duration[%s] \n", i+1, count, step.Description, step.Result, step.Duration)
+		for _, note := range step.Notes {
+			fmt.Printf("    %s\n", note)
+		}
+		if step.Result == "FAILED" {
+			report.printRetryHistory(step)
+		}
 	}
 	fmt.Println()
 }
@@ -155,13 +187,22 @@ func (report *SmokeTestReport) SuiteDidEnd(summary *types.SuiteSummary) {
 
 			failMessage := matchJSON.FindStringSubmatch(failure.message)
 			if failMessage != nil {
-				fmt.Printf("> %s\n", failMessage[1])
+				fmt.Printf("> %s\n", unquoteFailReason(failMessage[1]))
 			}
 		}
 		fmt.Printf("\nFor help with troubleshooting, visit: https://docs.pivotal.io/redis/smoke-tests.html\n\n")
 	}
 }
 
+// unquoteFailReason undoes the escaping of reasons that were quoted because
+// they hold free text. Other reasons are returned as they are.
+func unquoteFailReason(reason string) string {
+	if unquoted, err := strconv.Unquote(`"` + reason + `"`); err == nil {
+		return unquoted
+	}
+	return reason
+}
+
 func (report *SmokeTestReport) getTitleFromComponents(summary *types.SpecSummary) (title string) {
 	if len(summary.ComponentTexts) > 0 {
 		title = summary.ComponentTexts[len(summary.ComponentTexts)-1]
@@ -169,6 +210,18 @@ func (report *SmokeTestReport) getTitleFromComponents(summary *types.SpecSummary
 	return
 }
 
+func (report *SmokeTestReport) printRetryHistory(step *Step) {
+	if len(step.Retries) == 0 {
+		return
+	}
+
+	lastOutcome := step.Retries[len(step.Retries)-1]
+	if history := lastOutcome.History(); history != "" {
+		fmt.Printf("    Gave up: %s\n", lastOutcome.Reason)
+		fmt.Println("    " + strings.ReplaceAll(history, "\n", "\n    "))
+	}
+}
+
 func (report *SmokeTestReport) printMessageTitle(message string) {
 	border := strings.Repeat("-", len(message)+2)
 	fmt.Printf("\n\n|%s|\n", border)
@@ -0,0 +1,63 @@
+package reporter_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
+)
+
+var _ = Describe("Step", func() {
+	var clock *retry.FakeClock
+
+	BeforeEach(func() {
+		clock = retry.NewFakeClock(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	})
+
+	It("times the task with its clock", func() {
+		step := reporter.NewStep("Create a service instance", func() {
+			clock.Advance(5 * time.Minute)
+		})
+		step.Clock = clock
+
+		step.Perform()
+
+		Expect(step.Result).To(Equal("PASSED"))
+		Expect(step.Duration).To(Equal(5 * time.Minute))
+	})
+
+	It("keeps the outcome of the retries the task ran, even when it fails", func() {
+		step := reporter.NewStep("Ping redis", func() {
+			retry.Do(func(ctx context.Context) error {
+				return errors.New("connection refused")
+			}).WithClock(clock).WithMaxRetries(2).AndBackoff(retry.Linear(time.Second)).
+				AndFailHandler(func(msg string, _ ...int) { panic(msg) }).Run()
+		})
+		step.Clock = clock
+
+		Expect(step.Perform).To(Panic())
+
+		Expect(step.Result).To(Equal("FAILED"))
+		Expect(step.Retries).To(HaveLen(1))
+		Expect(step.Retries[0].Attempts).To(HaveLen(3))
+		Expect(clock.Sleeps()).To(Equal([]time.Duration{0, time.Second, 2 * time.Second}))
+	})
+
+	It("keeps the notes the task made, even when it fails", func() {
+		step := reporter.NewStep("Inspect certificates", nil)
+		step.Task = func() {
+			step.Note("not after 2030-01-01T00:00:00Z")
+			panic("certificate is not valid for host")
+		}
+
+		Expect(step.Perform).To(Panic())
+
+		Expect(step.Result).To(Equal("FAILED"))
+		Expect(step.Notes).To(Equal([]string{"not after 2030-01-01T00:00:00Z"}))
+	})
+})
@@ -2,6 +2,9 @@ package service_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"strings"
 	"testing"
@@ -12,29 +15,48 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/lifecycle"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
 )
 
 type retryConfig struct {
-	BaselineMilliseconds uint   `json:"baseline_interval_milliseconds"`
-	Attempts             uint   `json:"max_attempts"`
-	BackoffAlgorithm     string `json:"backoff"`
+	BaselineMilliseconds    uint   `json:"baseline_interval_milliseconds"`
+	MaxIntervalMilliseconds uint   `json:"max_interval_milliseconds"`
+	Attempts                uint   `json:"max_attempts"`
+	BackoffAlgorithm        string `json:"backoff"`
 }
 
 func (rc retryConfig) Backoff() retry.Backoff {
 	baseline := time.Duration(rc.BaselineMilliseconds) * time.Millisecond
+	maxInterval := time.Duration(rc.MaxIntervalMilliseconds) * time.Millisecond
+
+	var backoff retry.Backoff
 
 	algorithm := strings.ToLower(rc.BackoffAlgorithm)
 
 	switch algorithm {
 	case "linear":
-		return retry.Linear(baseline)
+		backoff = retry.Linear(baseline)
 	case "exponential":
-		return retry.Linear(baseline)
+		backoff = retry.Exponential(baseline)
+	case "full_jitter":
+		backoff = retry.FullJitter(baseline)
+	case "decorrelated_jitter":
+		if maxInterval == 0 {
+			maxInterval = time.Duration(math.MaxInt64)
+		}
+		backoff = retry.DecorrelatedJitter(baseline, maxInterval)
 	default:
-		return retry.None(baseline)
+		backoff = retry.None(baseline)
 	}
+
+	if maxInterval > 0 {
+		backoff = retry.Capped(backoff, maxInterval)
+	}
+
+	return backoff
 }
 
 func (rc retryConfig) MaxRetries() int {
@@ -50,6 +72,106 @@ type redisTestConfig struct {
 	TLSEnabled  bool        `json:"tls_enabled"`
 	TLSVersions []string    `json:"tls_versions"`
 	UseHttpApp  bool        `json:"use_http_app_smoke_tests"`
+	// Backend is "cli" (the default) to drive Cloud Foundry through the cf
+	// cli, or "api" to call the Cloud Controller v3 API directly.
+	Backend string `json:"cf_backend"`
+	// AsyncTimeoutMinutes bounds how long to wait for a service instance to
+	// be created or deleted. AsyncPollIntervalSeconds is how often to check.
+	AsyncTimeoutMinutes      uint `json:"async_timeout_minutes"`
+	AsyncPollIntervalSeconds uint `json:"async_poll_interval_seconds"`
+	// PlanUpdates are the plan moves and upgrades to check, e.g.
+	// {"from": "cache-small", "to": "cache-medium", "upgrade": true}.
+	PlanUpdates []lifecycle.PlanUpdate `json:"plan_updates"`
+	// PlanParameters are the arbitrary parameters passed to the broker for
+	// each plan, keyed by plan name.
+	PlanParameters map[string]lifecycle.PlanParameters `json:"plan_parameters"`
+	// SharingPlanNames are the plans whose instances are checked for
+	// sharing with, and unsharing from, a second space.
+	SharingPlanNames []string `json:"sharing_plan_names"`
+	// DNSServer is the host:port of the DNS server used to resolve instance
+	// hosts for security groups. It defaults to the system's.
+	DNSServer         string `json:"dns_server"`
+	DNSTimeoutSeconds uint   `json:"dns_timeout_seconds"`
+	// DirectProbe also talks to each instance directly from the test
+	// runner, using the service key's credentials.
+	DirectProbe bool `json:"direct_probe"`
+	// DirectTLSChecks handshakes with each instance's TLS ports from the
+	// test runner and inspects the certificates they present.
+	DirectTLSChecks bool `json:"direct_tls_checks"`
+	// DirectSentinelChecks asks each sentinel instance's sentinels for its
+	// master from the test runner.
+	DirectSentinelChecks bool `json:"direct_sentinel_checks"`
+	// FailoverPlanNames are the sentinel plans whose master is failed over.
+	// Writes must resume within FailoverTimeoutSeconds, by default 120.
+	// They need DirectSentinelChecks.
+	FailoverPlanNames      []string `json:"failover_plan_names"`
+	FailoverTimeoutSeconds uint     `json:"failover_timeout_seconds"`
+	// CABundlePath is a PEM file of the CAs instance certificates are
+	// verified against, in place of the CA in the service key.
+	CABundlePath string `json:"ca_bundle_path"`
+	CABundle     string `json:"-"`
+	// Certificates expiring within CertExpiryWarningDays, by default 30,
+	// are warned about. Those expiring within CertExpiryFailureDays fail.
+	CertExpiryWarningDays uint `json:"cert_expiry_warning_days"`
+	CertExpiryFailureDays uint `json:"cert_expiry_failure_days"`
+	// DataTypes are the data type checks made through the app for each
+	// plan, keyed by plan name. See lifecycle.DataTypes for the names.
+	DataTypes map[string][]string `json:"data_types"`
+}
+
+func (c redisTestConfig) FailoverBudget() time.Duration {
+	if c.FailoverTimeoutSeconds == 0 {
+		return 2 * time.Minute
+	}
+	return time.Duration(c.FailoverTimeoutSeconds) * time.Second
+}
+
+func (c redisTestConfig) CertExpiryWarning() time.Duration {
+	if c.CertExpiryWarningDays == 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(c.CertExpiryWarningDays) * 24 * time.Hour
+}
+
+func (c redisTestConfig) CertExpiryFailure() time.Duration {
+	return time.Duration(c.CertExpiryFailureDays) * 24 * time.Hour
+}
+
+func newPlatform(shortTimeout, longTimeout time.Duration) smokeTestCF.Platform {
+	if redisConfig.AsyncTimeoutMinutes > 0 {
+		longTimeout = time.Duration(redisConfig.AsyncTimeoutMinutes) * time.Minute
+	}
+	pollInterval := time.Duration(redisConfig.AsyncPollIntervalSeconds) * time.Second
+	resolver := smokeTestCF.Resolver{
+		Server:  redisConfig.DNSServer,
+		Timeout: time.Duration(redisConfig.DNSTimeoutSeconds) * time.Second,
+	}
+
+	switch strings.ToLower(redisConfig.Backend) {
+	case "", "cli":
+		return &smokeTestCF.CF{
+			ShortTimeout: shortTimeout,
+			LongTimeout:  longTimeout,
+			RetryBackoff: redisConfig.Retry.Backoff(),
+			MaxRetries:   redisConfig.Retry.MaxRetries(),
+			Resolver:     resolver,
+
+			AsyncPollInterval: pollInterval,
+		}
+	case "api":
+		return &smokeTestCF.CCV3{
+			ShortTimeout: shortTimeout,
+			LongTimeout:  longTimeout,
+			RetryBackoff: redisConfig.Retry.Backoff(),
+			MaxRetries:   redisConfig.Retry.MaxRetries(),
+			AppsDomain:   redisConfig.Config.AppsDomain,
+			Resolver:     resolver,
+
+			AsyncPollInterval: pollInterval,
+		}
+	default:
+		panic(fmt.Sprintf("unknown cf_backend %q, expected \"cli\" or \"api\"", redisConfig.Backend))
+	}
 }
 
 func loadRedisTestConfig(path string) redisTestConfig {
@@ -68,6 +190,33 @@ func loadRedisTestConfig(path string) redisTestConfig {
 
 	testConfig.Config.TimeoutScale = 3
 
+	if err := lifecycle.ValidateDataTypes(testConfig.DataTypes); err != nil {
+		panic(fmt.Errorf("invalid data_types: %w", err))
+	}
+	// The data type checks are held until the example app pinned at
+	// assets/cf-redis-example-app serves their endpoints.
+	if len(testConfig.DataTypes) > 0 {
+		panic(errors.New("data_types is not supported yet: the example app does not serve the data type endpoints"))
+	}
+
+	if len(testConfig.FailoverPlanNames) > 0 && !testConfig.DirectSentinelChecks {
+		panic(errors.New("failover_plan_names needs direct_sentinel_checks"))
+	}
+
+	for _, update := range testConfig.PlanUpdates {
+		if err := update.Validate(testConfig.PlanParameters); err != nil {
+			panic(fmt.Errorf("invalid plan_updates: %w", err))
+		}
+	}
+
+	if testConfig.CABundlePath != "" {
+		bundle, err := os.ReadFile(testConfig.CABundlePath)
+		if err != nil {
+			panic(err)
+		}
+		testConfig.CABundle = string(bundle)
+	}
+
 	return testConfig
 }
 
@@ -83,6 +232,7 @@ var (
 
 func TestService(t *testing.T) {
 	smokeTestReporter = new(reporter.SmokeTestReport)
+	defer retry.SetDefaultObserver(reporter.NewRetryLogger(os.Stdout))()
 
 	testReporter := []Reporter{
 		Reporter(smokeTestReporter),
@@ -7,146 +7,54 @@ import (
 
 	"github.com/pborman/uuid"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/redis"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/retry"
+	"github.com/pivotal-cf/cf-redis-smoke-tests/service/lifecycle"
 	"github.com/pivotal-cf/cf-redis-smoke-tests/service/reporter"
 
-	smokeTestCF "github.com/pivotal-cf/cf-redis-smoke-tests/cf"
-
 	. "github.com/onsi/ginkgo/v2"
 )
 
 var _ = Describe("Redis On-Demand", func() {
 	var (
-		testCF = smokeTestCF.CF{
-			ShortTimeout: time.Minute * 6,
-			LongTimeout:  time.Minute * 15,
-			RetryBackoff: redisConfig.Retry.Backoff(),
-			MaxRetries:   redisConfig.Retry.MaxRetries(),
-		}
+		shortTimeout = time.Minute * 6
+		testCF       = newPlatform(shortTimeout, time.Minute*15)
 
 		retryInterval = time.Second
 
-		appPath             = "../assets/cf-redis-example-app"
-		serviceInstanceName string
-		appName             string
-		planName            string
-		securityGroupName   string
-		serviceKeyName      string
-		serviceKey          smokeTestCF.Credentials
-
-		CreateTlsSpecStep = func(app *redis.App, version string, key string, value string) *reporter.Step {
-			tlsMessage := strings.ToUpper(version) + " clients are disabled"
-			valueCheck := "protocol not supported"
-			if hasTLSVersion(serviceKey, version) {
-				tlsMessage = strings.ToUpper(version) + " clients are enabled"
-				valueCheck = value
-			}
-			return reporter.NewStep(tlsMessage, app.ReadTLSAssert(version, key, valueCheck))
-		}
+		appPath  = "../assets/cf-redis-example-app"
+		spec     *lifecycle.Spec
+		shared   lifecycle.SharedSpace
+		planName string
 
 		AssertLifeCycleBehavior = func(planName string) {
-			It("creates, binds to, writes to, reads from, unbinds, and destroys", func() {
-				var skip bool
+			It("creates, binds to, writes to, reads from, unbinds, and destroys", func(ctx SpecContext) {
+				defer retry.SetDefaultContext(ctx)()
 
-				uri := fmt.Sprintf("https://%s.%s", appName, redisConfig.Config.AppsDomain)
-
-				if redisConfig.UseHttpApp {
-					uri = fmt.Sprintf("http://%s.%s", appName, redisConfig.Config.AppsDomain)
-				}
-
-				app := redis.NewApp(uri, testCF.ShortTimeout, retryInterval)
+				spec.Run(planName)
+			})
+		}
 
-				enableServiceAccessStep := reporter.NewStep(
-					fmt.Sprintf("Enable service plan access for '%s' org", wfh.GetOrganizationName()),
-					testCF.EnableServiceAccessForPlan(wfh.GetOrganizationName(), redisConfig.ServiceName, planName),
-				)
-				serviceCreateStep := reporter.NewStep(
-					fmt.Sprintf("Create a '%s' plan instance of Redis\n    Please refer to http://docs.pivotal.io/redis/smoke-tests.html for more help on diagnosing this issue", planName),
-					testCF.CreateService(redisConfig.ServiceName, planName, serviceInstanceName, &skip),
-				)
+		AssertUpdateBehavior = func(update lifecycle.PlanUpdate) {
+			It("keeps its data across the update", func(ctx SpecContext) {
+				defer retry.SetDefaultContext(ctx)()
 
-				smokeTestReporter.RegisterSpecSteps([]*reporter.Step{enableServiceAccessStep, serviceCreateStep})
-				enableServiceAccessStep.Perform()
-				serviceCreateStep.Perform()
+				spec.RunUpdate(update)
+			})
+		}
 
-				serviceCreateStep.Description = fmt.Sprintf("Create a '%s' plan instance of Redis", planName)
+		AssertFailoverBehavior = func(planName string) {
+			It("resumes writes on a new master after a sentinel failover", func(ctx SpecContext) {
+				defer retry.SetDefaultContext(ctx)()
 
-				specSteps := []*reporter.Step{
-					reporter.NewStep(
-						fmt.Sprintf("Bind the redis sample app '%s' to the '%s' plan instance '%s' of Redis", appName, planName, serviceInstanceName),
-						testCF.BindService(appName, serviceInstanceName),
-					),
-					reporter.NewStep(
-						fmt.Sprintf("Create service key for the '%s' plan instance '%s' of Redis", planName, serviceInstanceName),
-						testCF.CreateServiceKey(serviceInstanceName, serviceKeyName),
-					),
-					reporter.NewStep(
-						"Read the Service Key",
-						testCF.GetServiceKey(serviceInstanceName, &serviceKey),
-					),
-					reporter.NewStep(
-						fmt.Sprintf("Create and bind security group '%s' for running smoke tests", securityGroupName),
-						testCF.CreateAndBindSecurityGroup(securityGroupName, serviceInstanceName, wfh.GetOrganizationName(), wfh.TestSpace.SpaceName()),
-					),
-					reporter.NewStep(
-						"Start the app",
-						testCF.Start(appName),
-					),
-					reporter.NewStep(
-						"Verify that the app is responding",
-						app.IsRunning(),
-					),
-				}
+				spec.RunFailover(planName)
+			})
+		}
 
-				smokeTestReporter.RegisterSpecSteps(specSteps)
+		AssertSharingBehavior = func(planName string) {
+			It("shares the instance with another space and cleans up its binding on unshare", func(ctx SpecContext) {
+				defer retry.SetDefaultContext(ctx)()
 
-				if skip {
-					serviceCreateStep.Result = "SKIPPED"
-				} else {
-					performSteps(specSteps)
-				}
-
-				if !skip && !tlsEnforced(serviceKey) {
-					if isSentinelTls(serviceKey) {
-						standardPortSpecs := []*reporter.Step{
-							reporter.NewStep("Enable tls", testCF.SetEnv(appName, "tls_enabled", "true")),
-							reporter.NewStep("Restage app", testCF.Restage(appName)),
-						}
-						smokeTestReporter.RegisterSpecSteps(standardPortSpecs)
-						performSteps(standardPortSpecs)
-					}
-					standardPortSpecs := []*reporter.Step{
-						reporter.NewStep(
-							"Write a key/value pair to Redis",
-							app.Write("mykey", "myvalue"),
-						),
-						reporter.NewStep(
-							"Read the key/value pair back",
-							app.ReadAssert("mykey", "myvalue"),
-						),
-					}
-					smokeTestReporter.RegisterSpecSteps(standardPortSpecs)
-					performSteps(standardPortSpecs)
-				}
-				if !skip && tlsEnabled(serviceKey) {
-					tlsSpecSteps := []*reporter.Step{
-						reporter.NewStep("Enable tls", testCF.SetEnv(appName, "tls_enabled", "true")),
-						reporter.NewStep("Restage app", testCF.Restage(appName)),
-						reporter.NewStep(
-							"TLS: Write a key/value pair to Redis",
-							app.Write("mykey", "myvalue2"),
-						),
-						reporter.NewStep(
-							"TLS: Read the key/value pair back",
-							app.ReadAssert("mykey", "myvalue2"),
-						),
-						CreateTlsSpecStep(app, "tlsv1", "mykey", "myvalue2"),
-						CreateTlsSpecStep(app, "tlsv1.1", "mykey", "myvalue2"),
-						CreateTlsSpecStep(app, "tlsv1.2", "mykey", "myvalue2"),
-						CreateTlsSpecStep(app, "tlsv1.3", "mykey", "myvalue2"),
-					}
-					smokeTestReporter.RegisterSpecSteps(tlsSpecSteps)
-					performSteps(tlsSpecSteps)
-				}
+				spec.RunShare(planName, shared)
 			})
 		}
 	)
@@ -159,14 +67,74 @@ var _ = Describe("Redis On-Demand", func() {
 				})
 			}
 		})
-		BeforeEach(func() {
-			appName = randomName()
-			serviceInstanceName = randomName()
-			securityGroupName = randomName()
-			serviceKeyName = randomName()
+		Context("plan updates", func() {
+			for _, update := range redisConfig.PlanUpdates {
+				Context("from "+update.String()+":", func() {
+					AssertUpdateBehavior(update)
+				})
+			}
+		})
+		Context("failover", func() {
+			for _, planName := range redisConfig.FailoverPlanNames {
+				Context("for "+strings.ToUpper(planName)+" plans:", func() {
+					AssertFailoverBehavior(planName)
+				})
+			}
+		})
+		Context("sharing", func() {
+			for _, planName := range redisConfig.SharingPlanNames {
+				Context("for "+strings.ToUpper(planName)+" plans:", func() {
+					AssertSharingBehavior(planName)
+				})
+			}
+
+			AfterEach(func(ctx SpecContext) {
+				defer retry.SetDefaultContext(ctx)()
+
+				spec.TeardownShare(shared)
+			})
+		})
+		BeforeEach(func(ctx SpecContext) {
+			defer retry.SetDefaultContext(ctx)()
 
 			cfTestConfig := redisConfig.Config
 
+			appURI := func(appName string) string {
+				if redisConfig.UseHttpApp {
+					return fmt.Sprintf("http://%s.%s", appName, cfTestConfig.AppsDomain)
+				}
+				return fmt.Sprintf("https://%s.%s", appName, cfTestConfig.AppsDomain)
+			}
+
+			appName := randomName()
+			spec = &lifecycle.Spec{
+				Platform:            testCF,
+				App:                 redis.NewApp(appURI(appName), shortTimeout, retryInterval),
+				Report:              smokeTestReporter,
+				ServiceName:         redisConfig.ServiceName,
+				OrgName:             wfh.GetOrganizationName(),
+				SpaceName:           wfh.TestSpace.SpaceName(),
+				AppName:             appName,
+				ServiceInstanceName: randomName(),
+				SecurityGroupName:   randomName(),
+				ServiceKeyName:      randomName(),
+				Parameters:          redisConfig.PlanParameters,
+				DataTypes:           redisConfig.DataTypes,
+			}
+			if redisConfig.DirectSentinelChecks {
+				spec.Sentinel = redis.NewSentinelCheck(&spec.ServiceKey, shortTimeout, redisConfig.FailoverBudget(), retryInterval)
+			}
+			if redisConfig.DirectTLSChecks {
+				spec.TLSCheck = redis.NewTLSCheck(&spec.ServiceKey, shortTimeout, retryInterval)
+				spec.CertCheck = redis.NewCertCheck(&spec.ServiceKey, shortTimeout, retryInterval).
+					WithCABundle(redisConfig.CABundle).
+					WithExpiryWarning(redisConfig.CertExpiryWarning()).
+					AndExpiryFailure(redisConfig.CertExpiryFailure())
+			}
+			if redisConfig.DirectProbe {
+				spec.Probe = redis.NewProbe(&spec.ServiceKey, shortTimeout, retryInterval)
+			}
+
 			pushArgs := []string{
 				"-m", "256M",
 				"-p", appPath,
@@ -174,6 +142,15 @@ var _ = Describe("Redis On-Demand", func() {
 				"--no-start",
 			}
 
+			sharedAppName := randomName()
+			shared = lifecycle.SharedSpace{
+				SpaceName:         randomName(),
+				AppName:           sharedAppName,
+				App:               redis.NewApp(appURI(sharedAppName), shortTimeout, retryInterval),
+				PushArgs:          pushArgs,
+				SecurityGroupName: randomName(),
+			}
+
 			var loginStep *reporter.Step
 			if cfTestConfig.AdminClient != "" && cfTestConfig.AdminClientSecret != "" {
 				loginStep = reporter.NewStep(
@@ -194,8 +171,8 @@ var _ = Describe("Redis On-Demand", func() {
 				),
 				loginStep,
 				reporter.NewStep(
-					fmt.Sprintf("Target '%s' org and '%s' space", wfh.GetOrganizationName(), wfh.TestSpace.SpaceName()),
-					testCF.TargetOrgAndSpace(wfh.GetOrganizationName(), wfh.TestSpace.SpaceName()),
+					fmt.Sprintf("Target '%s' org and '%s' space", spec.OrgName, spec.SpaceName),
+					testCF.TargetOrgAndSpace(spec.OrgName, spec.SpaceName),
 				),
 				reporter.NewStep(
 					"Push the redis sample app to Cloud Foundry",
@@ -208,36 +185,10 @@ var _ = Describe("Redis On-Demand", func() {
 			performSteps(specSteps)
 		})
 
-		AfterEach(func() {
-			specSteps := []*reporter.Step{
-				reporter.NewStep(
-					fmt.Sprintf("Unbind the %q plan instance", planName),
-					testCF.UnbindService(appName, serviceInstanceName),
-				),
-				reporter.NewStep(
-					fmt.Sprintf("Delete security group '%s'", securityGroupName),
-					testCF.DeleteSecurityGroup(securityGroupName),
-				),
-				reporter.NewStep(
-					fmt.Sprintf("Delete the service key %s for the %q plan instance", serviceKeyName, planName),
-					testCF.DeleteServiceKey(serviceInstanceName, serviceKeyName),
-				),
-				reporter.NewStep(
-					fmt.Sprintf("Delete the %q plan instance", planName),
-					testCF.DeleteService(serviceInstanceName),
-				),
-				reporter.NewStep(
-					fmt.Sprintf("Ensure service instance for plan %q has been deleted", planName),
-					testCF.EnsureServiceInstanceGone(serviceInstanceName),
-				),
-				reporter.NewStep(
-					"Delete the app",
-					testCF.Delete(appName),
-				),
-			}
+		AfterEach(func(ctx SpecContext) {
+			defer retry.SetDefaultContext(ctx)()
 
-			smokeTestReporter.RegisterSpecSteps(specSteps)
-			performSteps(specSteps)
+			spec.Teardown(planName)
 		})
 	})
 })
@@ -246,30 +197,6 @@ func randomName() string {
 	return uuid.NewRandom().String()
 }
 
-func hasTLSVersion(serviceKey smokeTestCF.Credentials, version string) bool {
-	for _, v := range serviceKey.TLS_Versions {
-		if version == v {
-			return true
-		}
-	}
-	return false
-}
-
-func tlsEnabled(serviceKey smokeTestCF.Credentials) bool {
-	return serviceKey.TLS_Port > 0
-}
-
-func tlsEnforced(serviceKey smokeTestCF.Credentials) bool {
-	return serviceKey.TLS_Port > 0 && serviceKey.Port == 0
-}
-
-func isSentinelTls(serviceKey smokeTestCF.Credentials) bool {
-	if len(serviceKey.Sentinels) > 0 {
-		return serviceKey.Sentinels[0].TLSPort > 0
-	}
-	return false
-}
-
 func performSteps(specSteps []*reporter.Step) {
 	for _, task := range specSteps {
 		task.Perform()